@@ -14,6 +14,7 @@
 package promqlbuilder
 
 import (
+	"github.com/perses/promql-builder/variable"
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/promql/parser/posrange"
 )
@@ -33,7 +34,7 @@ func (a *AggregationBuilder) String() string {
 	return a.internal.String()
 }
 func (a *AggregationBuilder) Pretty(level int) string {
-	return a.internal.Pretty(level)
+	return defaultPrettier.pretty(a, level)
 }
 func (a *AggregationBuilder) PositionRange() posrange.PositionRange {
 	return a.internal.PositionRange()
@@ -60,6 +61,12 @@ func create(aggregateOp parser.ItemType, vector parser.Expr) *AggregationBuilder
 	return b
 }
 
+// NewAggregation returns the aggregation with the given operator, like parser.TOPK. The parameter is nil for the
+// aggregations that have none, and can be any expression for the others, like a variable or scalar(foo).
+func NewAggregation(op parser.ItemType, vector parser.Expr, param parser.Expr) *AggregationBuilder {
+	return createWithParam(op, vector, param)
+}
+
 func createWithParam(aggregateOp parser.ItemType, vector parser.Expr, param parser.Expr) *AggregationBuilder {
 	b := &AggregationBuilder{
 		internal: &parser.AggregateExpr{},
@@ -78,6 +85,11 @@ func BottomK(vector parser.Expr, k float64) *AggregationBuilder {
 	return createWithParam(parser.BOTTOMK, vector, NewNumber(k))
 }
 
+// BottomKAsVariable is like BottomK but the parameter k is a dashboard variable like "$k".
+func BottomKAsVariable(vector parser.Expr, k string) *AggregationBuilder {
+	return createWithParam(parser.BOTTOMK, vector, variable.New(k))
+}
+
 func Count(vector parser.Expr) *AggregationBuilder {
 	return create(parser.COUNT, vector)
 }
@@ -102,14 +114,29 @@ func Quantile(vector parser.Expr, quantile float64) *AggregationBuilder {
 	return createWithParam(parser.QUANTILE, vector, NewNumber(quantile))
 }
 
+// QuantileAsVariable is like Quantile but the quantile is a dashboard variable like "$quantile".
+func QuantileAsVariable(vector parser.Expr, quantile string) *AggregationBuilder {
+	return createWithParam(parser.QUANTILE, vector, variable.New(quantile))
+}
+
 func LimitK(vector parser.Expr, k float64) *AggregationBuilder {
 	return createWithParam(parser.LIMITK, vector, NewNumber(k))
 }
 
+// LimitKAsVariable is like LimitK but the parameter k is a dashboard variable like "$k".
+func LimitKAsVariable(vector parser.Expr, k string) *AggregationBuilder {
+	return createWithParam(parser.LIMITK, vector, variable.New(k))
+}
+
 func LimitRatio(vector parser.Expr, ratio float64) *AggregationBuilder {
 	return createWithParam(parser.LIMIT_RATIO, vector, NewNumber(ratio))
 }
 
+// LimitRatioAsVariable is like LimitRatio but the ratio is a dashboard variable like "$ratio".
+func LimitRatioAsVariable(vector parser.Expr, ratio string) *AggregationBuilder {
+	return createWithParam(parser.LIMIT_RATIO, vector, variable.New(ratio))
+}
+
 func Stddev(vector parser.Expr) *AggregationBuilder {
 	return create(parser.STDDEV, vector)
 }
@@ -125,3 +152,8 @@ func Sum(vector parser.Expr) *AggregationBuilder {
 func TopK(vector parser.Expr, k float64) *AggregationBuilder {
 	return createWithParam(parser.TOPK, vector, NewNumber(k))
 }
+
+// TopKAsVariable is like TopK but the parameter k is a dashboard variable like "$k".
+func TopKAsVariable(vector parser.Expr, k string) *AggregationBuilder {
+	return createWithParam(parser.TOPK, vector, variable.New(k))
+}
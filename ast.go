@@ -17,6 +17,9 @@ import (
 	"fmt"
 
 	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 )
@@ -124,6 +127,8 @@ func Children(node parser.Node) []parser.Node {
 		return ret
 	case *parser.SubqueryExpr:
 		return []parser.Node{n.Expr}
+	case *subquery.VariableBuilder:
+		return []parser.Node{n.InternalSubquery.Expr}
 	case *parser.ParenExpr:
 		return []parser.Node{n.Expr}
 	case *parser.UnaryExpr:
@@ -134,7 +139,9 @@ func Children(node parser.Node) []parser.Node {
 		return n.Children()
 	case *parser.StepInvariantExpr:
 		return []parser.Node{n.Expr}
-	case *parser.NumberLiteral, *parser.StringLiteral, *parser.VectorSelector:
+	case *vector.VariableBuilder:
+		return []parser.Node{n.InternalVector}
+	case *parser.NumberLiteral, *parser.StringLiteral, *parser.VectorSelector, *variable.Expr:
 		// nothing to do
 		return []parser.Node{}
 	default:
@@ -142,6 +149,115 @@ func Children(node parser.Node) []parser.Node {
 	}
 }
 
+// BinaryExprOf returns the binary operation held by a *parser.BinaryExpr, a *BinaryBuilder or a
+// *BinaryWithVectorMatching, and nil for any other node.
+func BinaryExprOf(node parser.Node) *parser.BinaryExpr {
+	switch n := node.(type) {
+	case *parser.BinaryExpr:
+		return n
+	case *BinaryBuilder:
+		return n.internal
+	case *BinaryWithVectorMatching:
+		return n.binaryOpt.internal
+	default:
+		return nil
+	}
+}
+
+// AggregateExprOf returns the aggregation held by a *parser.AggregateExpr or an *AggregationBuilder, and nil for any
+// other node.
+func AggregateExprOf(node parser.Node) *parser.AggregateExpr {
+	switch n := node.(type) {
+	case *parser.AggregateExpr:
+		return n
+	case *AggregationBuilder:
+		return n.internal
+	default:
+		return nil
+	}
+}
+
+// setChildren replaces the children of a node, in the same order as returned by Children.
+func setChildren(node parser.Node, children []parser.Node) error {
+	if len(children) != len(Children(node)) {
+		return fmt.Errorf("expected %d children for %T, got %d", len(Children(node)), node, len(children))
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	exprs := make([]parser.Expr, len(children))
+	for i, child := range children {
+		e, ok := child.(parser.Expr)
+		if !ok {
+			return fmt.Errorf("child %d of %T must be an expression, got %T", i, node, child)
+		}
+		exprs[i] = e
+	}
+	switch n := node.(type) {
+	case *parser.EvalStmt:
+		n.Expr = exprs[0]
+	case parser.Expressions:
+		copy(n, exprs)
+	case *parser.AggregateExpr:
+		setAggregationChildren(n, exprs)
+	case *AggregationBuilder:
+		setAggregationChildren(n.internal, exprs)
+	case *parser.BinaryExpr:
+		n.LHS, n.RHS = exprs[0], exprs[1]
+	case *BinaryBuilder:
+		n.internal.LHS, n.internal.RHS = exprs[0], exprs[1]
+	case *BinaryWithVectorMatching:
+		n.binaryOpt.internal.LHS, n.binaryOpt.internal.RHS = exprs[0], exprs[1]
+	case *parser.Call:
+		copy(n.Args, exprs)
+	case *parser.SubqueryExpr:
+		n.Expr = exprs[0]
+	case *subquery.VariableBuilder:
+		n.InternalSubquery.Expr = exprs[0]
+	case *parser.ParenExpr:
+		n.Expr = exprs[0]
+	case *parser.UnaryExpr:
+		n.Expr = exprs[0]
+	case *parser.StepInvariantExpr:
+		n.Expr = exprs[0]
+	case *parser.MatrixSelector:
+		n.VectorSelector = exprs[0]
+	case *matrix.Builder:
+		vs, ok := exprs[0].(*parser.VectorSelector)
+		if !ok {
+			return fmt.Errorf("a range vector can only wrap a vector selector, got %T", exprs[0])
+		}
+		n.InternalMatrix.VectorSelector = vs
+	case *vector.VariableBuilder:
+		vs, ok := exprs[0].(*parser.VectorSelector)
+		if !ok {
+			return fmt.Errorf("a vector with variables can only wrap a vector selector, got %T", exprs[0])
+		}
+		n.InternalVector = vs
+	default:
+		return fmt.Errorf("promql.setChildren: unhandled node type %T", node)
+	}
+	return nil
+}
+
+func setAggregationChildren(n *parser.AggregateExpr, exprs []parser.Expr) {
+	switch {
+	case n.Expr == nil:
+		n.Param = exprs[0]
+	case n.Param == nil:
+		n.Expr = exprs[0]
+	default:
+		n.Expr, n.Param = exprs[0], exprs[1]
+	}
+}
+
+// rewrite calls fn on every node of the expression, children first, and replaces each node by the result of fn.
+// The expression is modified in place, so callers usually pass a copy made with DeepCopyExpr.
+func rewrite(expr parser.Expr, fn func(parser.Expr) (parser.Expr, error)) (parser.Expr, error) {
+	t := &transformer{fn: func(node parser.Expr, _ string) (parser.Expr, error) { return fn(node) }}
+	return t.transform(expr, rootPath)
+}
+
 // DeepCopyExpr copies an expression and all its children recursively.
 // Handler promqlbuilder node types as well.
 func DeepCopyExpr(expr parser.Expr) parser.Expr {
@@ -185,7 +301,14 @@ func DeepCopyExpr(expr parser.Expr) parser.Expr {
 				Range:          e.InternalMatrix.Range,
 				EndPos:         e.InternalMatrix.EndPos,
 			},
-			RangeAsVariable: e.RangeAsVariable,
+			RangeAsVariable:  e.RangeAsVariable,
+			OffsetAsVariable: e.OffsetAsVariable,
+		}
+
+	case *vector.VariableBuilder:
+		return &vector.VariableBuilder{
+			InternalVector:   DeepCopyExpr(e.InternalVector).(*parser.VectorSelector),
+			OffsetAsVariable: e.OffsetAsVariable,
 		}
 
 	case *parser.AggregateExpr:
@@ -278,6 +401,19 @@ func DeepCopyExpr(expr parser.Expr) parser.Expr {
 			EndPos:         e.EndPos,
 		}
 
+	case *subquery.VariableBuilder:
+		return &subquery.VariableBuilder{
+			InternalSubquery: DeepCopyExpr(e.InternalSubquery).(*parser.SubqueryExpr),
+			RangeAsVariable:  e.RangeAsVariable,
+			StepAsVariable:   e.StepAsVariable,
+			OffsetAsVariable: e.OffsetAsVariable,
+		}
+
+	case *variable.Expr:
+		return &variable.Expr{
+			Reference: e.Reference,
+		}
+
 	case *parser.ParenExpr:
 		return &parser.ParenExpr{
 			Expr:     DeepCopyExpr(e.Expr),
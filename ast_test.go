@@ -181,3 +181,25 @@ func TestInspect(t *testing.T) {
 		})
 	}
 }
+
+func TestNodePath(t *testing.T) {
+	expr := MustParse(`sum(rate(foo[5m])) / on (job) topk(3, bar)`)
+	var paths []string
+	Inspect(expr, func(node parser.Node, ancestors []parser.Node) error {
+		if node == nil {
+			return nil
+		}
+		paths = append(paths, fmt.Sprintf("%s %s", NodePath(ancestors, node), node))
+		return nil
+	})
+	assert.Equal(t, []string{
+		"$ sum(rate(foo[5m])) / on (job) topk(3, bar)",
+		"$.lhs sum(rate(foo[5m]))",
+		"$.lhs.expr rate(foo[5m])",
+		"$.lhs.expr.args[0] foo[5m]",
+		"$.lhs.expr.args[0].vector foo",
+		"$.rhs topk(3, bar)",
+		"$.rhs.expr bar",
+		"$.rhs.param 3",
+	}, paths)
+}
@@ -14,6 +14,8 @@
 package promqlbuilder
 
 import (
+	"math"
+
 	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/promql/parser/posrange"
 )
@@ -29,10 +31,10 @@ func (b *BinaryBuilder) PromQLExpr() {
 	b.internal.PromQLExpr()
 }
 func (b *BinaryBuilder) String() string {
-	return b.internal.String()
+	return b.parenthesized().String()
 }
 func (b *BinaryBuilder) Pretty(level int) string {
-	return b.internal.Pretty(level)
+	return defaultPrettier.pretty(b, level)
 }
 func (b *BinaryBuilder) PositionRange() posrange.PositionRange {
 	return b.internal.PositionRange()
@@ -76,7 +78,7 @@ func (b *BinaryWithVectorMatching) String() string {
 	return b.binaryOpt.String()
 }
 func (b *BinaryWithVectorMatching) Pretty(level int) string {
-	return b.binaryOpt.Pretty(level)
+	return defaultPrettier.pretty(b, level)
 }
 func (b *BinaryWithVectorMatching) PositionRange() posrange.PositionRange {
 	return b.binaryOpt.PositionRange()
@@ -109,6 +111,41 @@ func (b *BinaryWithVectorMatching) FillRHS(v float64) *BinaryWithVectorMatching
 	return b
 }
 
+// parenthesized returns a copy of the binary expression where the operands are wrapped in parentheses
+// when the PromQL precedence rules would otherwise change how the expression is read.
+// For example, Mul(Add(a, b), c) is rendered as "(a + b) * c".
+func (b *BinaryBuilder) parenthesized() *parser.BinaryExpr {
+	e := *b.internal
+	if operandNeedsParens(e.Op, e.LHS, false) {
+		e.LHS = Parenthesis(e.LHS)
+	}
+	if operandNeedsParens(e.Op, e.RHS, true) {
+		e.RHS = Parenthesis(e.RHS)
+	}
+	return &e
+}
+
+// operandNeedsParens returns true if the operand must be wrapped in parentheses to be read as a single operand of op.
+func operandNeedsParens(op parser.ItemType, operand parser.Expr, right bool) bool {
+	switch n := operand.(type) {
+	case *parser.UnaryExpr:
+		// "-a ^ b" is read as "-(a ^ b)".
+		return op == parser.POW && !right
+	case *parser.NumberLiteral:
+		// A negative number is written with a minus sign, so "-2 ^ 2" is read as "-(2 ^ 2)" too.
+		return op == parser.POW && !right && math.Signbit(n.Val)
+	}
+	inner := BinaryExprOf(operand)
+	if inner == nil {
+		return false
+	}
+	if precedence(inner.Op) != precedence(op) {
+		return precedence(inner.Op) < precedence(op)
+	}
+	// With the same precedence, the operations are grouped following the associativity of the operator.
+	return right != isRightAssociative(op)
+}
+
 func createBinaryOperation(itemType parser.ItemType, left parser.Expr, right parser.Expr) *BinaryBuilder {
 	b := &BinaryBuilder{
 		internal: &parser.BinaryExpr{
@@ -199,3 +236,29 @@ func TrimUpper(left parser.Expr, right parser.Expr) *BinaryBuilder {
 func TrimLower(left parser.Expr, right parser.Expr) *BinaryBuilder {
 	return createBinaryOperation(parser.TRIM_LOWER, left, right)
 }
+
+// precedence returns the precedence of a binary operator, as defined by the PromQL grammar.
+// The higher it is, the stronger the operator binds its operands.
+func precedence(op parser.ItemType) int {
+	switch op {
+	case parser.LOR:
+		return 1
+	case parser.LAND, parser.LUNLESS:
+		return 2
+	case parser.EQLC, parser.NEQ, parser.LTE, parser.LSS, parser.GTE, parser.GTR, parser.TRIM_UPPER, parser.TRIM_LOWER:
+		return 3
+	case parser.ADD, parser.SUB:
+		return 4
+	case parser.MUL, parser.DIV, parser.MOD, parser.ATAN2:
+		return 5
+	case parser.POW:
+		return 6
+	default:
+		return 0
+	}
+}
+
+// isRightAssociative returns true if the binary operator is right associative, like "^".
+func isRightAssociative(op parser.ItemType) bool {
+	return op == parser.POW
+}
@@ -110,6 +110,11 @@ func TestPromQLBuilder(t *testing.T) {
 			expected: "count_values(\"config_hash\", alertmanager_config_hash)",
 			expr:     CountValues("config_hash", vector.New(vector.WithMetricName("alertmanager_config_hash"))),
 		},
+		{
+			name:     "aggregation with an expression as parameter",
+			expected: "topk(scalar(bar), foo)",
+			expr:     NewAggregation(parser.TOPK, vector.New(vector.WithMetricName("foo")), Scalar(vector.New(vector.WithMetricName("bar")))),
+		},
 		{
 			name:     "parenthesis",
 			expected: "(time() - foo[5d]) / 100",
@@ -318,3 +323,78 @@ func TestPretty(t *testing.T) {
 		})
 	}
 }
+
+func TestBinaryPrecedence(t *testing.T) {
+	a := vector.New(vector.WithMetricName("a"))
+	b := vector.New(vector.WithMetricName("b"))
+	c := vector.New(vector.WithMetricName("c"))
+	testSuite := []struct {
+		name     string
+		expected string
+		expr     parser.Expr
+	}{
+		{
+			name:     "lower precedence on the left",
+			expected: "(a + b) * c",
+			expr:     Mul(Add(a, b), c),
+		},
+		{
+			name:     "higher precedence on the left",
+			expected: "a * b + c",
+			expr:     Add(Mul(a, b), c),
+		},
+		{
+			name:     "lower precedence on the right",
+			expected: "a / (b - c)",
+			expr:     Div(a, Sub(b, c)),
+		},
+		{
+			name:     "same precedence on the left",
+			expected: "a - b + c",
+			expr:     Add(Sub(a, b), c),
+		},
+		{
+			name:     "same precedence on the right",
+			expected: "a - (b + c)",
+			expr:     Sub(a, Add(b, c)),
+		},
+		{
+			name:     "power is right associative",
+			expected: "(a ^ b) ^ a ^ c",
+			expr:     Pow(Pow(a, b), Pow(a, c)),
+		},
+		{
+			name:     "negation as base of a power",
+			expected: "(-a) ^ b",
+			expr:     Pow(&parser.UnaryExpr{Op: parser.SUB, Expr: a}, b),
+		},
+		{
+			name:     "negative number as base of a power",
+			expected: "(-2) ^ 2 + 2 ^ -2",
+			expr:     Add(Pow(NewNumber(-2), NewNumber(2)), Pow(NewNumber(2), NewNumber(-2))),
+		},
+		{
+			name:     "set operators",
+			expected: "a and (b or c) unless a",
+			expr:     Unless(And(a, Or(b, c)), a),
+		},
+		{
+			name:     "vector matching",
+			expected: "(a + b) / on (job) group_left () c",
+			expr:     Div(Add(a, b), c).On("job").GroupLeft(),
+		},
+		{
+			name:     "explicit parenthesis are kept",
+			expected: "(a * b) + c",
+			expr:     Add(Parenthesis(Mul(a, b)), c),
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+			s, err := StrictString(test.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, s)
+		})
+	}
+}
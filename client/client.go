@@ -0,0 +1,265 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client sends the expressions to the query endpoints of the Prometheus HTTP API,
+// https://prometheus.io/docs/prometheus/latest/querying/api/, and decodes the results.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	queryPath      = "/api/v1/query"
+	queryRangePath = "/api/v1/query_range"
+)
+
+// Query is an expression with the parameters of its evaluation. It is a range query when Step is set, an instant
+// query otherwise. The zero values are not sent, to use the defaults of the server.
+type Query struct {
+	Expr parser.Expr
+	// Time is the evaluation time of an instant query. When zero, the server uses the current time.
+	Time time.Time
+	// Start and End are the bounds of a range query, both included.
+	Start time.Time
+	End   time.Time
+	// Step is the duration between two evaluations of a range query.
+	Step time.Duration
+	// Timeout is the evaluation timeout. It is capped by the timeout of the server.
+	Timeout time.Duration
+	// Limit is the maximum number of series returned.
+	Limit int
+	// LookbackDelta overrides how far back a sample is searched for an instant vector selector.
+	LookbackDelta time.Duration
+}
+
+// IsRange returns true if the query is sent to the endpoint of the range queries.
+func (q *Query) IsRange() bool {
+	return q.Step > 0
+}
+
+// Path returns the path of the API endpoint, /api/v1/query or /api/v1/query_range.
+func (q *Query) Path() string {
+	if q.IsRange() {
+		return queryRangePath
+	}
+	return queryPath
+}
+
+// ResultType returns the type of the result returned by the server: always a matrix for a range query, and the type
+// of the expression for an instant query.
+func (q *Query) ResultType() model.ValueType {
+	if q.IsRange() {
+		return model.ValMatrix
+	}
+	switch q.Expr.Type() {
+	case parser.ValueTypeScalar:
+		return model.ValScalar
+	case parser.ValueTypeString:
+		return model.ValString
+	case parser.ValueTypeMatrix:
+		return model.ValMatrix
+	default:
+		return model.ValVector
+	}
+}
+
+// Values returns the form values of the request. It returns an error when the parameters are not consistent or when
+// the expression still contains dashboard variables.
+func (q *Query) Values() (url.Values, error) {
+	if q.Expr == nil {
+		return nil, errors.New("missing expression")
+	}
+	if vars := promqlbuilder.Variables(q.Expr); len(vars) > 0 {
+		return nil, fmt.Errorf("the expression uses the variables $%s, interpolate them with promqlbuilder.Interpolate before sending it", strings.Join(vars, ", $"))
+	}
+	if q.Step < 0 {
+		return nil, fmt.Errorf("negative step %s", q.Step)
+	}
+	values := url.Values{}
+	values.Set("query", q.Expr.String())
+	if q.IsRange() {
+		if q.Start.IsZero() || q.End.IsZero() {
+			return nil, errors.New("a range query needs a start and an end")
+		}
+		if q.End.Before(q.Start) {
+			return nil, errors.New("the end of a range query cannot be before its start")
+		}
+		if !q.Time.IsZero() {
+			return nil, errors.New("a range query has no evaluation time, use start and end")
+		}
+		values.Set("start", formatTime(q.Start))
+		values.Set("end", formatTime(q.End))
+		values.Set("step", formatDuration(q.Step))
+	} else {
+		if !q.Start.IsZero() || !q.End.IsZero() {
+			return nil, errors.New("an instant query has no start and end, set a step for a range query")
+		}
+		if !q.Time.IsZero() {
+			values.Set("time", formatTime(q.Time))
+		}
+	}
+	if q.Timeout > 0 {
+		values.Set("timeout", formatDuration(q.Timeout))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.LookbackDelta > 0 {
+		values.Set("lookback_delta", formatDuration(q.LookbackDelta))
+	}
+	return values, nil
+}
+
+// NewRequest returns the POST request sending the query to the Prometheus server at the given URL.
+func (q *Query) NewRequest(ctx context.Context, baseURL string) (*http.Request, error) {
+	values, err := q.Values()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+q.Path(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// Response is the result of a query.
+type Response struct {
+	// Value is a model.Vector, a model.Matrix, a *model.Scalar or a *model.String, as given by Query.ResultType.
+	Value    model.Value
+	Warnings []string
+	Infos    []string
+}
+
+// Error is an error returned by the Prometheus API, like a query that cannot be parsed or evaluated.
+type Error struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// apiResponse is the envelope of every response of the Prometheus API.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+	Infos     []string        `json:"infos,omitempty"`
+}
+
+type queryData struct {
+	ResultType model.ValueType `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// DecodeResponse decodes the response of the server to the query. The status code and the body of an error are
+// returned as *Error.
+func (q *Query) DecodeResponse(resp *http.Response) (*Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var envelope apiResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("unexpected response with status %d: %w", resp.StatusCode, err)
+	}
+	if envelope.Status != "success" {
+		return nil, &Error{StatusCode: resp.StatusCode, Type: envelope.ErrorType, Message: envelope.Error}
+	}
+	var data queryData
+	if err := json.Unmarshal(envelope.Data, &data); err != nil {
+		return nil, err
+	}
+	if expected := q.ResultType(); data.ResultType != expected {
+		return nil, fmt.Errorf("expected a result of type %s, got %s", expected, data.ResultType)
+	}
+	var value model.Value
+	switch data.ResultType {
+	case model.ValVector:
+		var v model.Vector
+		err = json.Unmarshal(data.Result, &v)
+		value = v
+	case model.ValMatrix:
+		var m model.Matrix
+		err = json.Unmarshal(data.Result, &m)
+		value = m
+	case model.ValScalar:
+		s := &model.Scalar{}
+		err = json.Unmarshal(data.Result, s)
+		value = s
+	case model.ValString:
+		s := &model.String{}
+		err = json.Unmarshal(data.Result, s)
+		value = s
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Value: value, Warnings: envelope.Warnings, Infos: envelope.Infos}, nil
+}
+
+// Client sends queries to a Prometheus server.
+type Client struct {
+	// URL is the address of the server, like "http://localhost:9090".
+	URL string
+	// HTTPClient is used to send the requests. When nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Do sends the query and decodes its result.
+func (c *Client) Do(ctx context.Context, q *Query) (*Response, error) {
+	req, err := q.NewRequest(ctx, c.URL)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return q.DecodeResponse(resp)
+}
+
+// formatTime formats the time as a Unix timestamp in seconds, like the Prometheus Go client.
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64)
+}
+
+// formatDuration formats the duration as a number of seconds.
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,183 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/evaltest"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryValues(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		query    Query
+		path     string
+		expected url.Values
+	}{
+		{
+			name: "instant query",
+			query: Query{
+				Expr:          promqlbuilder.Sum(vector.New(vector.WithMetricName("up"))).By("job"),
+				Time:          time.Unix(1700000000, 500e6),
+				Timeout:       30 * time.Second,
+				Limit:         10,
+				LookbackDelta: time.Minute,
+			},
+			path: "/api/v1/query",
+			expected: url.Values{
+				"query":          {"sum by (job) (up)"},
+				"time":           {"1700000000.5"},
+				"timeout":        {"30"},
+				"limit":          {"10"},
+				"lookback_delta": {"60"},
+			},
+		},
+		{
+			name: "range query",
+			query: Query{
+				Expr:  promqlbuilder.Rate(matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsString("5m"))),
+				Start: time.Unix(1700000000, 0),
+				End:   time.Unix(1700003600, 0),
+				Step:  15 * time.Second,
+			},
+			path: "/api/v1/query_range",
+			expected: url.Values{
+				"query": {"rate(foo[5m])"},
+				"start": {"1700000000"},
+				"end":   {"1700003600"},
+				"step":  {"15"},
+			},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := test.query.Values()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, values)
+			assert.Equal(t, test.path, test.query.Path())
+		})
+	}
+}
+
+func TestQueryValuesError(t *testing.T) {
+	up := vector.New(vector.WithMetricName("up"))
+	testSuite := []struct {
+		query Query
+		err   string
+	}{
+		{
+			query: Query{},
+			err:   "missing expression",
+		},
+		{
+			query: Query{Expr: promqlbuilder.Rate(matrix.New(up, matrix.WithRangeAsVariable("$__rate_interval")))},
+			err:   "the expression uses the variables $__rate_interval, interpolate them with promqlbuilder.Interpolate before sending it",
+		},
+		{
+			query: Query{Expr: up, Step: time.Minute},
+			err:   "a range query needs a start and an end",
+		},
+		{
+			query: Query{Expr: up, Start: time.Unix(2, 0), End: time.Unix(1, 0), Step: time.Minute},
+			err:   "the end of a range query cannot be before its start",
+		},
+		{
+			query: Query{Expr: up, Start: time.Unix(1, 0)},
+			err:   "an instant query has no start and end, set a step for a range query",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.err, func(t *testing.T) {
+			_, err := test.query.Values()
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	server := NewFakeServer(evaltest.MustLoad(`
+load 1m
+  up{job="api",instance="a"} 1 1 1 0 0
+  up{job="api",instance="b"} 1 1 1 1 1
+`))
+	defer server.Close()
+	c := &Client{URL: server.URL}
+	up := vector.New(vector.WithMetricName("up"))
+
+	resp, err := c.Do(context.Background(), &Query{Expr: promqlbuilder.Sum(up).By("job"), Time: evaltest.At(4 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, model.Vector{{
+		Metric:    model.Metric{"job": "api"},
+		Value:     1,
+		Timestamp: model.TimeFromUnix(240),
+	}}, resp.Value)
+
+	resp, err = c.Do(context.Background(), &Query{Expr: promqlbuilder.Sum(up), Start: evaltest.At(2 * time.Minute), End: evaltest.At(4 * time.Minute), Step: 2 * time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, model.Matrix{{
+		Metric: model.Metric{},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(120), Value: 2}, {Timestamp: model.TimeFromUnix(240), Value: 1}},
+	}}, resp.Value)
+
+	resp, err = c.Do(context.Background(), &Query{Expr: promqlbuilder.Scalar(promqlbuilder.Count(up)), Time: evaltest.At(0)})
+	require.NoError(t, err)
+	assert.Equal(t, &model.Scalar{Value: 2, Timestamp: 0}, resp.Value)
+
+	resp, err = c.Do(context.Background(), &Query{Expr: up, Time: evaltest.At(0), Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, resp.Value, 1)
+	assert.Equal(t, []string{"results truncated due to limit of 1 series"}, resp.Warnings)
+
+	resp, err = c.Do(context.Background(), &Query{Expr: up, Time: evaltest.At(10 * time.Minute), LookbackDelta: time.Minute})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Value)
+}
+
+func TestFakeServerError(t *testing.T) {
+	server := NewFakeServer(evaltest.New())
+	defer server.Close()
+
+	resp, err := http.PostForm(server.URL+"/api/v1/query", url.Values{"query": {"sum("}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = (&Query{Expr: vector.New(vector.WithMetricName("up"))}).DecodeResponse(resp)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "bad_data", apiErr.Type)
+	assert.True(t, strings.HasPrefix(apiErr.Message, "invalid parameter 'query'"))
+}
+
+func TestDecodeResponseUnexpectedType(t *testing.T) {
+	server := NewFakeServer(evaltest.New())
+	defer server.Close()
+
+	resp, err := http.PostForm(server.URL+"/api/v1/query", url.Values{"query": {"1"}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = (&Query{Expr: vector.New(vector.WithMetricName("up"))}).DecodeResponse(resp)
+	assert.EqualError(t, err, "expected a result of type vector, got scalar")
+}
@@ -0,0 +1,261 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/evaltest"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// NewFakeServer starts a server answering the query endpoints of the Prometheus API with the series of the storage.
+// The caller must close it.
+func NewFakeServer(s *evaltest.Storage) *httptest.Server {
+	return httptest.NewServer(NewFakeHandler(s))
+}
+
+// NewFakeHandler returns the handler of the query endpoints of the Prometheus API, evaluating the queries against
+// the series of the storage. The parameters time, start, end, step, limit and lookback_delta are supported, the
+// timeout is ignored. The current time is used when no time is given.
+func NewFakeHandler(s *evaltest.Storage) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(queryPath, func(w http.ResponseWriter, r *http.Request) {
+		expr, options, limit, err := parseQueryParams(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		ts, err := parseTimeParam(r, "time", time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		value, err := s.Instant(expr, ts, options...)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "execution", err)
+			return
+		}
+		writeValue(w, value, limit)
+	})
+	mux.HandleFunc(queryRangePath, func(w http.ResponseWriter, r *http.Request) {
+		expr, options, limit, err := parseQueryParams(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		start, err := parseTimeParam(r, "start", time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		end, err := parseTimeParam(r, "end", time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", err)
+			return
+		}
+		step, err := parseDuration(r.FormValue("step"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_data", fmt.Errorf("invalid parameter 'step': %w", err))
+			return
+		}
+		if start.IsZero() || end.IsZero() || step <= 0 {
+			writeError(w, http.StatusBadRequest, "bad_data", errors.New("a range query needs a start, an end and a positive step"))
+			return
+		}
+		if end.Before(start) {
+			writeError(w, http.StatusBadRequest, "bad_data", errors.New("end timestamp must not be before start time"))
+			return
+		}
+		m, err := s.Range(expr, start, end, step, options...)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "execution", err)
+			return
+		}
+		writeValue(w, m, limit)
+	})
+	return mux
+}
+
+func parseQueryParams(r *http.Request) (parser.Expr, []evaltest.QueryOption, int, error) {
+	expr, err := promqlbuilder.Parse(r.FormValue("query"))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid parameter 'query': %w", err)
+	}
+	var options []evaltest.QueryOption
+	if value := r.FormValue("lookback_delta"); len(value) > 0 {
+		d, err := parseDuration(value)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid parameter 'lookback_delta': %w", err)
+		}
+		options = append(options, evaltest.WithLookbackDelta(d))
+	}
+	limit := 0
+	if value := r.FormValue("limit"); len(value) > 0 {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, nil, 0, fmt.Errorf("invalid parameter 'limit': %q is not a positive integer", value)
+		}
+	}
+	return expr, options, limit, nil
+}
+
+// parseTimeParam parses a time given as a Unix timestamp in seconds or in the RFC 3339 format, like Prometheus.
+func parseTimeParam(r *http.Request, name string, defaultValue time.Time) (time.Time, error) {
+	value := r.FormValue(name)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	if t, err := strconv.ParseFloat(value, 64); err == nil {
+		s, ns := math.Modf(t)
+		return time.Unix(int64(s), int64(math.Round(ns*1000)/1000*float64(time.Second))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid parameter '%s': cannot parse %q to a valid timestamp", name, value)
+}
+
+// parseDuration parses a duration given as a number of seconds or like "5m", like Prometheus.
+func parseDuration(value string) (time.Duration, error) {
+	if d, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	d, err := model.ParseDuration(value)
+	return time.Duration(d), err
+}
+
+func writeError(w http.ResponseWriter, status int, errorType string, err error) {
+	writeJSON(w, status, apiResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+func writeValue(w http.ResponseWriter, value parser.Value, limit int) {
+	var warnings []string
+	result, truncated := toModel(value, limit)
+	if truncated {
+		warnings = append(warnings, fmt.Sprintf("results truncated due to limit of %d series", limit))
+	}
+	data, err := json.Marshal(struct {
+		ResultType model.ValueType `json:"resultType"`
+		Result     model.Value     `json:"result"`
+	}{ResultType: result.Type(), Result: result})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResponse{Status: "success", Data: data, Warnings: warnings})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// toModel converts the result of the engine to the types of the API, keeping at most limit series when limit is
+// positive. It returns true if series were dropped.
+func toModel(value parser.Value, limit int) (model.Value, bool) {
+	truncated := false
+	switch v := value.(type) {
+	case promql.Vector:
+		if limit > 0 && len(v) > limit {
+			v, truncated = v[:limit], true
+		}
+		result := make(model.Vector, 0, len(v))
+		for _, s := range v {
+			result = append(result, &model.Sample{
+				Metric:    toMetric(s.Metric),
+				Value:     model.SampleValue(s.F),
+				Timestamp: model.Time(s.T),
+				Histogram: toHistogram(s.H),
+			})
+		}
+		return result, truncated
+	case promql.Matrix:
+		if limit > 0 && len(v) > limit {
+			v, truncated = v[:limit], true
+		}
+		result := make(model.Matrix, 0, len(v))
+		for _, s := range v {
+			stream := &model.SampleStream{Metric: toMetric(s.Metric)}
+			for _, p := range s.Floats {
+				stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.Time(p.T), Value: model.SampleValue(p.F)})
+			}
+			for _, p := range s.Histograms {
+				stream.Histograms = append(stream.Histograms, model.SampleHistogramPair{Timestamp: model.Time(p.T), Histogram: toHistogram(p.H)})
+			}
+			result = append(result, stream)
+		}
+		return result, truncated
+	case promql.Scalar:
+		return &model.Scalar{Value: model.SampleValue(v.V), Timestamp: model.Time(v.T)}, false
+	case promql.String:
+		return &model.String{Value: v.V, Timestamp: model.Time(v.T)}, false
+	default:
+		return nil, false
+	}
+}
+
+func toMetric(l labels.Labels) model.Metric {
+	metric := model.Metric{}
+	l.Range(func(l labels.Label) {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	})
+	return metric
+}
+
+// toHistogram converts a native histogram like the Prometheus API does.
+func toHistogram(h *histogram.FloatHistogram) *model.SampleHistogram {
+	if h == nil {
+		return nil
+	}
+	result := &model.SampleHistogram{Count: model.FloatString(h.Count), Sum: model.FloatString(h.Sum)}
+	it := h.AllBucketIterator()
+	for it.Next() {
+		bucket := it.At()
+		if bucket.Count == 0 {
+			continue
+		}
+		// 0 is a bucket open on the left and closed on the right, 1 the opposite, 2 open on both sides and 3 closed
+		// on both sides.
+		boundaries := int32(2)
+		if bucket.LowerInclusive {
+			boundaries = 1
+			if bucket.UpperInclusive {
+				boundaries = 3
+			}
+		} else if bucket.UpperInclusive {
+			boundaries = 0
+		}
+		result.Buckets = append(result.Buckets, &model.HistogramBucket{
+			Boundaries: boundaries,
+			Lower:      model.FloatString(bucket.Lower),
+			Upper:      model.FloatString(bucket.Upper),
+			Count:      model.FloatString(bucket.Count),
+		})
+	}
+	return result
+}
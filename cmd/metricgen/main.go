@@ -0,0 +1,66 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command metricgen prints the Go file declaring the typed definitions of the metrics of a Prometheus server or a
+// scrape, see the metric package. The input is a file, or the standard input when there is no argument, holding
+// either the JSON response of the /api/v1/metadata endpoint or metrics in the Prometheus or OpenMetrics text format.
+// The flag -openmetrics tells that the targets of the metadata are scraped in the OpenMetrics format, so that the suffix
+// _total is added to the names of the counters:
+//
+//	curl -s http://localhost:9090/api/v1/metadata | metricgen -package metrics > metrics.go
+//	curl -s http://localhost:8080/metrics | metricgen -package metrics > metrics.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/perses/promql-builder/metric"
+)
+
+func main() {
+	pkg := flag.String("package", "metrics", "name of the package of the generated file")
+	openMetrics := flag.Bool("openmetrics", false, "add the suffix _total to the counters of the metadata, named after their OpenMetrics family")
+	flag.Parse()
+
+	var data []byte
+	var err error
+	if flag.NArg() == 0 {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read the metrics: %s\n", err)
+		os.Exit(1)
+	}
+	var definitions []metric.Definition
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		definitions, err = metric.FromMetadata(data, *openMetrics)
+	} else {
+		definitions, err = metric.FromExposition(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to parse the metrics: %s\n", err)
+		os.Exit(1)
+	}
+	code, err := metric.GenerateGo(*pkg, definitions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate the code: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(code)
+}
@@ -0,0 +1,216 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command promql-builder formats, validates and converts PromQL queries.
+//
+//	promql-builder <command> [flags] [file...]
+//
+// The commands are:
+//
+//	fmt      print the queries pretty-printed, see the flags -width and -indent
+//	check    validate the queries
+//	to-go    print the Go code building the queries
+//	to-json  print the queries as JSON trees
+//	vars     print the dashboard variables referenced by the queries
+//
+// The queries are read from the standard input when no file is given. A file ending with .yaml, .yml or .json
+// is searched for the fields holding a query, "expr" and "query" by default, like in rule files or Perses dashboards.
+// Any other file contains a single query.
+//
+// The exit code is 1 when a query cannot be parsed or is not valid, and 2 when the command is misused.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v3"
+)
+
+// query is a PromQL query found in a source. Location is empty when the source contains a single query.
+type query struct {
+	source   string
+	location string
+	text     string
+}
+
+func (q query) name() string {
+	if len(q.location) == 0 {
+		return q.source
+	}
+	return q.source + ":" + q.location
+}
+
+// command runs on every parsed query and returns its output, or an error when the query is not valid.
+type command func(text string, expr parser.Expr) (string, error)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: promql-builder <fmt|check|to-go|to-json|vars> [flags] [file...]")
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	flags := flag.NewFlagSet("promql-builder "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keys := flags.String("keys", "expr,query", "comma-separated names of the YAML and JSON fields holding a query")
+	var cmd command
+	switch args[0] {
+	case "fmt":
+		width := flags.Int("width", 100, "length above which an expression is split on several lines")
+		indent := flags.String("indent", "  ", "string used to indent each level")
+		cmd = func(_ string, expr parser.Expr) (string, error) {
+			return promqlbuilder.Pretty(expr, promqlbuilder.WithMaxLineWidth(*width), promqlbuilder.WithIndent(*indent)), nil
+		}
+	case "check":
+		cmd = func(_ string, expr parser.Expr) (string, error) {
+			return "", promqlbuilder.Validate(expr)
+		}
+	case "to-go":
+		alias := flags.String("alias", "promqlbuilder", "name used to refer to the promqlbuilder package, empty for none")
+		cmd = func(text string, _ parser.Expr) (string, error) {
+			return promqlbuilder.GenerateGo(text, promqlbuilder.WithPackageAlias(*alias))
+		}
+	case "to-json":
+		cmd = func(_ string, expr parser.Expr) (string, error) {
+			data, err := json.MarshalIndent(promqlbuilder.Expression{Expr: expr}, "", "  ")
+			return string(data), err
+		}
+	case "vars":
+		cmd = func(_ string, expr parser.Expr) (string, error) {
+			return strings.Join(promqlbuilder.Variables(expr), "\n"), nil
+		}
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	queryKeys := strings.Split(*keys, ",")
+	for i, key := range queryKeys {
+		queryKeys[i] = strings.TrimSpace(key)
+	}
+	queries, err := readQueries(flags.Args(), stdin, queryKeys)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	status := 0
+	for _, q := range queries {
+		output, err := runQuery(cmd, q.text)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", q.name(), strings.ReplaceAll(err.Error(), "\n", "\n\t"))
+			status = 1
+			continue
+		}
+		if len(output) == 0 {
+			continue
+		}
+		if len(queries) > 1 {
+			fmt.Fprintf(stdout, "# %s\n", q.name())
+		}
+		fmt.Fprintln(stdout, strings.TrimRight(output, "\n"))
+	}
+	return status
+}
+
+func runQuery(cmd command, text string) (string, error) {
+	expr, err := promqlbuilder.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return cmd(text, expr)
+}
+
+// readQueries returns the queries of every file, or the query read from stdin when there is no file.
+func readQueries(files []string, stdin io.Reader, keys []string) ([]query, error) {
+	if len(files) == 0 {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the standard input: %w", err)
+		}
+		return []query{{source: "<stdin>", text: string(data)}}, nil
+	}
+	var queries []query
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+			found, err := findQueries(file, data, keys)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, found...)
+		default:
+			queries = append(queries, query{source: file, text: string(data)})
+		}
+	}
+	return queries, nil
+}
+
+// findQueries returns the string values of the fields named like one of the keys, in a YAML or JSON document.
+// Their location is the line of the value in the file.
+func findQueries(file string, data []byte, keys []string) ([]query, error) {
+	var queries []query
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if value.Kind == yaml.ScalarNode && value.Tag == "!!str" && slices.Contains(keys, key.Value) {
+					queries = append(queries, query{source: file, location: fmt.Sprint(value.Line), text: value.Value})
+				}
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return queries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		walk(&doc)
+	}
+}
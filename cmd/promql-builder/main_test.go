@@ -0,0 +1,107 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.yaml")
+	require.NoError(t, os.WriteFile(rules, []byte(`groups:
+  - name: example
+    rules:
+      - record: job:foo:rate5m
+        expr: sum by (job) (rate(foo{namespace="$ns"}[5m]))
+      - alert: FooTooHigh
+        expr: histogram_quantile(2, rate(foo_bucket[$__rate_interval])) > 1
+`), 0o600))
+	dashboard := filepath.Join(dir, "dashboard.json")
+	require.NoError(t, os.WriteFile(dashboard, []byte(`{"spec": {"plugin": {"spec": {"query": "up{job=\"$job\"}"}}}}`), 0o600))
+
+	testSuite := []struct {
+		name   string
+		args   []string
+		stdin  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "fmt from stdin",
+			args:   []string{"fmt"},
+			stdin:  "sum(rate(foo[5m]))/on(job)group_left bar",
+			stdout: "sum(rate(foo[5m])) / on (job) group_left () bar\n",
+		},
+		{
+			name:   "fmt with width and indent",
+			args:   []string{"fmt", "-width", "30", "-indent", "\t"},
+			stdin:  "sum(rate(foo[5m]))/on(job)group_left bar",
+			stdout: "\tsum(rate(foo[5m]))\n/ on (job) group_left ()\n\tbar\n",
+		},
+		{
+			name:   "check files",
+			args:   []string{"check", rules, dashboard},
+			status: 1,
+			stderr: rules + ":7: $.lhs.args[0]: quantile must be between 0 and 1, got 2\n",
+		},
+		{
+			name:   "vars",
+			args:   []string{"vars", rules, dashboard},
+			stdout: "# " + rules + ":5\nns\n# " + rules + ":7\n__rate_interval\n# " + dashboard + ":1\njob\n",
+		},
+		{
+			name:   "to-go",
+			args:   []string{"to-go", "-alias", "pb"},
+			stdin:  "up == 0",
+			stdout: "pb.Eqlc(vector.New(vector.WithMetricName(\"up\")), pb.NewNumber(0))\n",
+		},
+		{
+			name:   "to-json",
+			args:   []string{"to-json"},
+			stdin:  "up",
+			stdout: "{\n  \"kind\": \"vector\",\n  \"name\": \"up\"\n}\n",
+		},
+		{
+			name:   "parse error",
+			args:   []string{"check"},
+			stdin:  "rate(foo[5m]",
+			status: 1,
+			stderr: "<stdin>: 1:13: parse error: unclosed left parenthesis\n",
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"lint"},
+			status: 2,
+			stderr: "unknown command \"lint\"\nusage: promql-builder <fmt|check|to-go|to-json|vars> [flags] [file...]\n",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr)
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.stdout, stdout.String())
+			assert.Equal(t, test.stderr, stderr.String())
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command promql2go prints the Go code building a PromQL query with promqlbuilder.
+// The query is given as argument, or read from the standard input when there is no argument:
+//
+//	promql2go 'sum by (job) (rate(http_requests_total[5m]))'
+//	echo 'up == 0' | promql2go -alias pb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	promqlbuilder "github.com/perses/promql-builder"
+)
+
+func main() {
+	alias := flag.String("alias", "promqlbuilder", "name used to refer to the promqlbuilder package, empty for none")
+	flag.Parse()
+
+	query := strings.Join(flag.Args(), " ")
+	if flag.NArg() == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read the query: %s\n", err)
+			os.Exit(1)
+		}
+		query = string(data)
+	}
+	code, err := promqlbuilder.GenerateGo(query, promqlbuilder.WithPackageAlias(*alias))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate the code: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(code)
+}
@@ -0,0 +1,616 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"go/format"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// maxGoLineLength is the length above which the arguments of a call are written one per line.
+const maxGoLineLength = 100
+
+type GoOption func(g *goGenerator)
+
+// WithPackageAlias sets the name used to refer to the promqlbuilder package, "promqlbuilder" by default.
+// An empty alias generates code to be used inside the package itself or with a dot import.
+func WithPackageAlias(alias string) GoOption {
+	return func(g *goGenerator) {
+		g.alias = alias
+	}
+}
+
+type goGenerator struct {
+	alias string
+}
+
+// GenerateGo parses a PromQL query and returns the gofmt'd Go code building it with this library, like:
+//
+//	promqlbuilder.Sum(
+//		promqlbuilder.Rate(
+//			matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsString("5m")),
+//		),
+//	).By("job")
+//
+// The code uses the packages promqlbuilder, label, matrix, vector, subquery and variable, and sometimes time, math
+// and the Prometheus parser. It is up to the caller to import them, for example with goimports.
+// Functions without a dedicated helper, or with arguments the helper cannot take, are generated with NewFunction.
+func GenerateGo(query string, opts ...GoOption) (string, error) {
+	expr, err := Parse(query)
+	if err != nil {
+		return "", err
+	}
+	g := &goGenerator{alias: "promqlbuilder"}
+	for _, opt := range opts {
+		opt(g)
+	}
+	code, err := g.generate(expr, rootPath)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.Source([]byte(code.render(0)))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// goCode is a Go expression, either a literal or a call that can be split on several lines.
+type goCode struct {
+	// recv is the receiver when the call is a method call, like the aggregation for By.
+	recv *goCode
+	// key is set when the code is a field of a composite literal.
+	key  string
+	text string
+	// args is nil for a literal.
+	args        []*goCode
+	open, close string
+}
+
+func goLiteral(text string) *goCode {
+	return &goCode{text: text}
+}
+
+func goCall(fn string, args ...*goCode) *goCode {
+	return &goCode{text: fn, args: append([]*goCode{}, args...), open: "(", close: ")"}
+}
+
+func goMethod(recv *goCode, method string, args ...*goCode) *goCode {
+	call := goCall(method, args...)
+	call.recv = recv
+	return call
+}
+
+func (c *goCode) prefix(level int) string {
+	s := c.text
+	if c.recv != nil {
+		s = c.recv.render(level) + "." + s
+	}
+	if len(c.key) > 0 {
+		s = c.key + ": " + s
+	}
+	return s
+}
+
+// render returns the code, with the arguments of the calls that are too long written one per line.
+func (c *goCode) render(level int) string {
+	if c.args == nil {
+		return c.prefix(level)
+	}
+	parts := make([]string, len(c.args))
+	for i, arg := range c.args {
+		parts[i] = arg.render(level)
+	}
+	prefix := c.prefix(level)
+	flatArgs := c.open + strings.Join(parts, ", ") + c.close
+	lastLine := prefix[strings.LastIndexByte(prefix, '\n')+1:]
+	// The arguments of the methods, like the labels given to By, are kept on the line of the receiver.
+	fits := c.recv != nil || len(lastLine)+len(flatArgs)+level*4 <= maxGoLineLength
+	if len(c.args) == 0 || (!strings.Contains(flatArgs, "\n") && fits) {
+		return prefix + flatArgs
+	}
+	var b strings.Builder
+	b.WriteString(prefix + c.open + "\n")
+	for _, arg := range c.args {
+		b.WriteString(strings.Repeat("\t", level+1) + arg.render(level+1) + ",\n")
+	}
+	b.WriteString(strings.Repeat("\t", level) + c.close)
+	return b.String()
+}
+
+func (g *goGenerator) fn(name string) string {
+	if len(g.alias) == 0 {
+		return name
+	}
+	return g.alias + "." + name
+}
+
+func (g *goGenerator) generate(node parser.Expr, path string) (*goCode, error) {
+	switch n := node.(type) {
+	case *parser.StepInvariantExpr:
+		return g.generate(n.Expr, path)
+	case *parser.ParenExpr:
+		expr, err := g.generate(n.Expr, path+".expr")
+		if err != nil {
+			return nil, err
+		}
+		return goCall(g.fn("Parenthesis"), expr), nil
+	case *parser.UnaryExpr:
+		expr, err := g.generate(n.Expr, path+".expr")
+		if err != nil {
+			return nil, err
+		}
+		op := "parser.ADD"
+		if n.Op == parser.SUB {
+			op = "parser.SUB"
+		}
+		expr.key = "Expr"
+		return &goCode{text: "&parser.UnaryExpr", args: []*goCode{goLiteral("Op: " + op), expr}, open: "{", close: "}"}, nil
+	case *parser.AggregateExpr:
+		return g.generateAggregation(n, path)
+	case *AggregationBuilder:
+		return g.generateAggregation(n.internal, path)
+	case *parser.BinaryExpr:
+		return g.generateBinary(n, path)
+	case *BinaryBuilder:
+		return g.generateBinary(n.internal, path)
+	case *BinaryWithVectorMatching:
+		return g.generateBinary(n.binaryOpt.internal, path)
+	case *parser.Call:
+		return g.generateCall(n, path)
+	case *parser.MatrixSelector:
+		return g.generateMatrix(n, "", "", path)
+	case *matrix.Builder:
+		return g.generateMatrix(n.InternalMatrix, n.RangeAsVariable, n.OffsetAsVariable, path)
+	case *parser.SubqueryExpr:
+		return g.generateSubquery(n, "", "", "", path)
+	case *subquery.VariableBuilder:
+		return g.generateSubquery(n.InternalSubquery, n.RangeAsVariable, n.StepAsVariable, n.OffsetAsVariable, path)
+	case *parser.VectorSelector:
+		return generateVector(n), nil
+	case *vector.VariableBuilder:
+		return goCall("vector.NewWithVariables", generateVector(n.InternalVector),
+			goCall("vector.WithOffsetAsVariable", goString(n.OffsetAsVariable))), nil
+	case *parser.NumberLiteral:
+		return goCall(g.fn("NewNumber"), goFloat(n.Val)), nil
+	case *parser.StringLiteral:
+		return goCall(g.fn("NewString"), goString(n.Val)), nil
+	case *variable.Expr:
+		return goCall("variable.New", goString(n.Reference)), nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported node type %T", path, node)
+	}
+}
+
+// aggregationHelpers gives the name of the function building each aggregation.
+var aggregationHelpers = map[parser.ItemType]string{
+	parser.AVG:          "Avg",
+	parser.BOTTOMK:      "BottomK",
+	parser.COUNT:        "Count",
+	parser.COUNT_VALUES: "CountValues",
+	parser.GROUP:        "Group",
+	parser.LIMITK:       "LimitK",
+	parser.LIMIT_RATIO:  "LimitRatio",
+	parser.MAX:          "Max",
+	parser.MIN:          "Min",
+	parser.QUANTILE:     "Quantile",
+	parser.STDDEV:       "Stddev",
+	parser.STDVAR:       "Stdvar",
+	parser.SUM:          "Sum",
+	parser.TOPK:         "TopK",
+}
+
+func (g *goGenerator) generateAggregation(n *parser.AggregateExpr, path string) (*goCode, error) {
+	helper, ok := aggregationHelpers[n.Op]
+	if !ok {
+		return nil, fmt.Errorf("%s: no helper for the aggregation %q", path, n.Op)
+	}
+	expr, err := g.generate(n.Expr, path+".expr")
+	if err != nil {
+		return nil, err
+	}
+	var code *goCode
+	switch param := n.Param.(type) {
+	case nil:
+		code = goCall(g.fn(helper), expr)
+	case *parser.StringLiteral:
+		if n.Op != parser.COUNT_VALUES {
+			return nil, fmt.Errorf("%s.param: the parameter of %s must be a number", path, n.Op)
+		}
+		code = goCall(g.fn(helper), goString(param.Val), expr)
+	case *parser.NumberLiteral:
+		code = goCall(g.fn(helper), expr, goFloat(param.Val))
+	case *variable.Expr:
+		code = goCall(g.fn(helper+"AsVariable"), expr, goString(param.Reference))
+	default:
+		return nil, fmt.Errorf("%s.param: only a number or a variable can be generated as parameter of %s, got %T", path, n.Op, n.Param)
+	}
+	switch {
+	case n.Without:
+		code = goMethod(code, "Without", goStrings(n.Grouping)...)
+	case len(n.Grouping) > 0:
+		code = goMethod(code, "By", goStrings(n.Grouping)...)
+	}
+	return code, nil
+}
+
+// binaryHelpers gives the name of the function building each binary operation.
+var binaryHelpers = map[parser.ItemType]string{
+	parser.POW:        "Pow",
+	parser.MUL:        "Mul",
+	parser.DIV:        "Div",
+	parser.MOD:        "Mod",
+	parser.ATAN2:      "Atan2",
+	parser.ADD:        "Add",
+	parser.SUB:        "Sub",
+	parser.EQLC:       "Eqlc",
+	parser.GTE:        "Gte",
+	parser.GTR:        "Gtr",
+	parser.LTE:        "Lte",
+	parser.LSS:        "Lss",
+	parser.NEQ:        "Neq",
+	parser.LAND:       "And",
+	parser.LUNLESS:    "Unless",
+	parser.LOR:        "Or",
+	parser.EQL_REGEX:  "EqlRegex",
+	parser.NEQ_REGEX:  "NeqRegex",
+	parser.TRIM_UPPER: "TrimUpper",
+	parser.TRIM_LOWER: "TrimLower",
+}
+
+func (g *goGenerator) generateBinary(n *parser.BinaryExpr, path string) (*goCode, error) {
+	helper, ok := binaryHelpers[n.Op]
+	if !ok {
+		return nil, fmt.Errorf("%s: no helper for the binary operator %q", path, n.Op)
+	}
+	// The operands are parenthesized by the builder when needed.
+	lhs, err := g.generate(unwrapParens(n.LHS), path+".lhs")
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := g.generate(unwrapParens(n.RHS), path+".rhs")
+	if err != nil {
+		return nil, err
+	}
+	code := goCall(g.fn(helper), lhs, rhs)
+	if n.ReturnBool {
+		code = goMethod(code, "Bool")
+	}
+	vm := n.VectorMatching
+	if !hasVectorMatchingKeyword(vm) {
+		return code, nil
+	}
+	if vm.On {
+		code = goMethod(code, "On", goStrings(vm.MatchingLabels)...)
+	} else {
+		code = goMethod(code, "Ignoring", goStrings(vm.MatchingLabels)...)
+	}
+	switch vm.Card {
+	case parser.CardManyToOne:
+		code = goMethod(code, "GroupLeft", goStrings(vm.Include)...)
+	case parser.CardOneToMany:
+		code = goMethod(code, "GroupRight", goStrings(vm.Include)...)
+	}
+	if vm.FillValues.LHS != nil {
+		code = goMethod(code, "FillLHS", goFloat(*vm.FillValues.LHS))
+	}
+	if vm.FillValues.RHS != nil {
+		code = goMethod(code, "FillRHS", goFloat(*vm.FillValues.RHS))
+	}
+	return code, nil
+}
+
+func unwrapParens(expr parser.Expr) parser.Expr {
+	for {
+		paren, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
+
+// argKind is the Go type of an argument of a function helper.
+type argKind int
+
+const (
+	exprArg argKind = iota
+	rangeArg
+	floatArg
+	stringArg
+	floatsArg
+	stringsArg
+)
+
+// functionHelperArgs gives the arguments of the helpers that do not only take expressions.
+// The other helpers take an expression for each argument of the PromQL function.
+var functionHelperArgs = map[string][]argKind{
+	"clamp":                        {exprArg, floatArg, floatArg},
+	"clamp_max":                    {exprArg, floatArg},
+	"clamp_min":                    {exprArg, floatArg},
+	"double_exponential_smoothing": {rangeArg, floatArg, floatArg},
+	"histogram_fraction":           {floatArg, floatArg, exprArg},
+	"histogram_quantile":           {floatArg, exprArg},
+	"histogram_quantiles":          {exprArg, stringArg, floatsArg},
+	"label_join":                   {exprArg, stringArg, stringArg, stringsArg},
+	"label_replace":                {exprArg, stringArg, stringArg, stringArg, stringArg},
+	"predict_linear":               {rangeArg, floatArg},
+	"quantile_over_time":           {floatArg, rangeArg},
+	"round":                        {exprArg, floatArg},
+	"sort_by_label":                {exprArg, stringsArg},
+	"sort_by_label_desc":           {exprArg, stringsArg},
+	"vector":                       {floatArg},
+}
+
+// functionHelperNames gives the name of the helpers that are not the PromQL function name in camel case.
+var functionHelperNames = map[string]string{
+	"idelta": "IDelta",
+	"irate":  "IRate",
+	"pi":     "PI",
+}
+
+// functionHelperName returns the name of the helper building the PromQL function, like "HistogramQuantile".
+func functionHelperName(name string) string {
+	if helper, ok := functionHelperNames[name]; ok {
+		return helper
+	}
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "")
+}
+
+// functionArgKinds returns the arguments of the helper building the PromQL function.
+func functionArgKinds(fn *parser.Function) []argKind {
+	if kinds, ok := functionHelperArgs[fn.Name]; ok {
+		return kinds
+	}
+	kinds := make([]argKind, len(fn.ArgTypes))
+	for i, t := range fn.ArgTypes {
+		if t == parser.ValueTypeMatrix {
+			kinds[i] = rangeArg
+		}
+	}
+	return kinds
+}
+
+func (g *goGenerator) generateCall(n *parser.Call, path string) (*goCode, error) {
+	args := make([]*goCode, len(n.Args))
+	for i, arg := range n.Args {
+		code, err := g.generate(arg, fmt.Sprintf("%s.args[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		args[i] = code
+	}
+	if fn, ok := parser.Functions[n.Func.Name]; ok {
+		if code := g.generateHelperCall(fn, n.Args, args); code != nil {
+			return code, nil
+		}
+	}
+	return goCall(g.fn("NewFunction"), append([]*goCode{goString(n.Func.Name)}, args...)...), nil
+}
+
+// generateHelperCall returns the call of the helper building the function,
+// or nil if the arguments cannot be passed to the helper.
+func (g *goGenerator) generateHelperCall(fn *parser.Function, args []parser.Expr, codes []*goCode) *goCode {
+	kinds := functionArgKinds(fn)
+	variadic := len(kinds) > 0 && (kinds[len(kinds)-1] == floatsArg || kinds[len(kinds)-1] == stringsArg)
+	if len(args) != len(kinds) && (!variadic || len(args) < len(kinds)-1) {
+		return nil
+	}
+	helper := functionHelperName(fn.Name)
+	helperArgs := make([]*goCode, len(args))
+	for i, arg := range args {
+		kind := kinds[min(i, len(kinds)-1)]
+		switch a := arg.(type) {
+		case *parser.NumberLiteral:
+			if kind != floatArg && kind != floatsArg && kind != exprArg {
+				return nil
+			}
+			helperArgs[i] = codes[i]
+			if kind != exprArg {
+				helperArgs[i] = goFloat(a.Val)
+			}
+		case *parser.StringLiteral:
+			if kind != stringArg && kind != stringsArg && kind != exprArg {
+				return nil
+			}
+			helperArgs[i] = codes[i]
+			if kind != exprArg {
+				helperArgs[i] = goString(a.Val)
+			}
+		case *variable.Expr:
+			switch {
+			case kind == exprArg:
+				helperArgs[i] = codes[i]
+			case kind == floatArg && (fn.Name == "histogram_quantile" || fn.Name == "quantile_over_time") && i == 0:
+				helper += "AsVariable"
+				helperArgs[i] = goString(a.Reference)
+			default:
+				return nil
+			}
+		case *matrix.Builder, *parser.MatrixSelector, *parser.SubqueryExpr, *subquery.VariableBuilder:
+			if kind != rangeArg && kind != exprArg {
+				return nil
+			}
+			helperArgs[i] = codes[i]
+		default:
+			if kind != exprArg {
+				return nil
+			}
+			helperArgs[i] = codes[i]
+		}
+	}
+	return goCall(g.fn(helper), helperArgs...)
+}
+
+func (g *goGenerator) generateMatrix(n *parser.MatrixSelector, rangeAsVariable, offsetAsVariable string, path string) (*goCode, error) {
+	vs, ok := n.VectorSelector.(*parser.VectorSelector)
+	if !ok {
+		return nil, fmt.Errorf("%s.vector: a range vector can only wrap a vector selector, got %T", path, n.VectorSelector)
+	}
+	args := []*goCode{generateVector(vs)}
+	if len(rangeAsVariable) > 0 {
+		args = append(args, goCall("matrix.WithRangeAsVariable", goString(rangeAsVariable)))
+	} else {
+		args = append(args, goCall("matrix.WithRangeAsString", goString(model.Duration(n.Range).String())))
+	}
+	if len(offsetAsVariable) > 0 {
+		args = append(args, goCall("matrix.WithOffsetAsVariable", goString(offsetAsVariable)))
+	}
+	return goCall("matrix.New", args...), nil
+}
+
+func (g *goGenerator) generateSubquery(n *parser.SubqueryExpr, rangeAsVariable, stepAsVariable, offsetAsVariable string, path string) (*goCode, error) {
+	expr, err := g.generate(n.Expr, path+".expr")
+	if err != nil {
+		return nil, err
+	}
+	args := []*goCode{goCall("subquery.WithExpr", expr)}
+	switch {
+	case n.Step != 0:
+		args = append(args, goCall("subquery.WithRangeAndStep", goDuration(n.Range), goDuration(n.Step)))
+	case n.Range != 0:
+		args = append(args, goCall("subquery.WithRangeAsString", goString(model.Duration(n.Range).String())))
+	}
+	args = append(args, generateTimeModifiers("subquery", n.OriginalOffset, n.Timestamp, n.StartOrEnd)...)
+	code := goCall("subquery.New", args...)
+	if len(rangeAsVariable) == 0 && len(stepAsVariable) == 0 && len(offsetAsVariable) == 0 {
+		return code, nil
+	}
+	args = []*goCode{code}
+	switch {
+	case len(rangeAsVariable) > 0 && len(stepAsVariable) > 0:
+		args = append(args, goCall("subquery.WithRangeAndStepAsVariable", goString(rangeAsVariable), goString(stepAsVariable)))
+	case len(rangeAsVariable) > 0:
+		args = append(args, goCall("subquery.WithRangeAsVariable", goString(rangeAsVariable)))
+	case len(stepAsVariable) > 0:
+		args = append(args, goCall("subquery.WithStepAsVariable", goString(stepAsVariable)))
+	}
+	if len(offsetAsVariable) > 0 {
+		args = append(args, goCall("subquery.WithOffsetAsVariable", goString(offsetAsVariable)))
+	}
+	return goCall("subquery.NewWithVariables", args...), nil
+}
+
+// labelMatcherMethods gives the method of label.Builder creating each type of matcher.
+var labelMatcherMethods = map[labels.MatchType]string{
+	labels.MatchEqual:     "Equal",
+	labels.MatchNotEqual:  "NotEqual",
+	labels.MatchRegexp:    "EqualRegexp",
+	labels.MatchNotRegexp: "NotEqualRegexp",
+}
+
+func generateVector(n *parser.VectorSelector) *goCode {
+	var args []*goCode
+	if len(n.Name) > 0 {
+		args = append(args, goCall("vector.WithMetricName", goString(n.Name)))
+	}
+	var matchers []*goCode
+	for _, m := range n.LabelMatchers {
+		// The parser adds the metric name as a matcher, it is already set by WithMetricName.
+		if len(n.Name) > 0 && m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == n.Name {
+			continue
+		}
+		matchers = append(matchers, goMethod(goCall("label.New", goString(m.Name)), labelMatcherMethods[m.Type], goString(m.Value)))
+	}
+	if len(matchers) > 0 {
+		args = append(args, goCall("vector.WithLabelMatchers", matchers...))
+	}
+	args = append(args, generateTimeModifiers("vector", n.OriginalOffset, n.Timestamp, n.StartOrEnd)...)
+	return goCall("vector.New", args...)
+}
+
+// generateTimeModifiers returns the options of the package vector or subquery setting the offset and the @ modifier.
+func generateTimeModifiers(pkg string, offset time.Duration, timestamp *int64, startOrEnd parser.ItemType) []*goCode {
+	var args []*goCode
+	switch {
+	case offset > 0:
+		args = append(args, goCall(pkg+".WithOffsetAsString", goString(model.Duration(offset).String())))
+	case offset < 0:
+		args = append(args, goCall(pkg+".WithOffset", goDuration(offset)))
+	}
+	switch {
+	case timestamp != nil:
+		args = append(args, goCall(pkg+".WithAtSpecificTimeStamp", goLiteral(strconv.FormatInt(*timestamp, 10))))
+	case startOrEnd == parser.START:
+		args = append(args, goCall(pkg+".WithAtStart"))
+	case startOrEnd == parser.END:
+		args = append(args, goCall(pkg+".WithAtEnd"))
+	}
+	return args
+}
+
+func goString(s string) *goCode {
+	return goLiteral(strconv.Quote(s))
+}
+
+func goStrings(values []string) []*goCode {
+	codes := make([]*goCode, len(values))
+	for i, v := range values {
+		codes[i] = goString(v)
+	}
+	return codes
+}
+
+func goFloat(v float64) *goCode {
+	switch {
+	case math.IsNaN(v):
+		return goLiteral("math.NaN()")
+	case math.IsInf(v, 1):
+		return goLiteral("math.Inf(1)")
+	case math.IsInf(v, -1):
+		return goLiteral("math.Inf(-1)")
+	default:
+		return goLiteral(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+}
+
+// goDuration returns the duration as a Go expression like "90 * time.Second".
+func goDuration(d time.Duration) *goCode {
+	if d == 0 {
+		return goLiteral("0")
+	}
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "time.Hour"}, {time.Minute, "time.Minute"}, {time.Second, "time.Second"}, {time.Millisecond, "time.Millisecond"}} {
+		if d%unit.d != 0 {
+			continue
+		}
+		switch d / unit.d {
+		case 1:
+			return goLiteral(unit.name)
+		case -1:
+			return goLiteral("-" + unit.name)
+		default:
+			return goLiteral(fmt.Sprintf("%d * %s", d/unit.d, unit.name))
+		}
+	}
+	return goLiteral(strconv.FormatInt(int64(d), 10))
+}
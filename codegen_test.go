@@ -0,0 +1,189 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"go/ast"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateGo(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		query    string
+		opts     []GoOption
+		expected string
+	}{
+		{
+			name:  "aggregation of a rate",
+			query: `sum by (job) (rate(foo{job="a",code=~"5.."}[$__rate_interval]))`,
+			expected: `promqlbuilder.Sum(
+	promqlbuilder.Rate(
+		matrix.New(
+			vector.New(
+				vector.WithMetricName("foo"),
+				vector.WithLabelMatchers(
+					label.New("job").Equal("a"),
+					label.New("code").EqualRegexp("5.."),
+				),
+			),
+			matrix.WithRangeAsVariable("$__rate_interval"),
+		),
+	),
+).By("job")`,
+		},
+		{
+			name:  "vector matching",
+			query: `foo / on (job) group_left (team) bar > bool 1`,
+			expected: `promqlbuilder.Gtr(
+	promqlbuilder.Div(
+		vector.New(vector.WithMetricName("foo")),
+		vector.New(vector.WithMetricName("bar")),
+	).On("job").GroupLeft("team"),
+	promqlbuilder.NewNumber(1),
+).Bool()`,
+		},
+		{
+			name:  "package alias",
+			query: `topk(5, foo offset 1h) or vector(1)`,
+			opts:  []GoOption{WithPackageAlias("pb")},
+			expected: `pb.Or(
+	pb.TopK(vector.New(vector.WithMetricName("foo"), vector.WithOffsetAsString("1h")), 5),
+	pb.Vector(1),
+)`,
+		},
+		{
+			name:  "no package alias",
+			query: `-(a + b) * c`,
+			opts:  []GoOption{WithPackageAlias("")},
+			expected: `Mul(
+	&parser.UnaryExpr{
+		Op: parser.SUB,
+		Expr: Parenthesis(
+			Add(vector.New(vector.WithMetricName("a")), vector.New(vector.WithMetricName("b"))),
+		),
+	},
+	vector.New(vector.WithMetricName("c")),
+)`,
+		},
+		{
+			name:  "variables",
+			query: `histogram_quantile($q, max_over_time(rate(foo[5m])[$__range:1m] offset -1h)) + bar offset $offset`,
+			expected: `promqlbuilder.Add(
+	promqlbuilder.HistogramQuantileAsVariable(
+		"$q",
+		promqlbuilder.MaxOverTime(
+			subquery.NewWithVariables(
+				subquery.New(
+					subquery.WithExpr(
+						promqlbuilder.Rate(
+							matrix.New(
+								vector.New(vector.WithMetricName("foo")),
+								matrix.WithRangeAsString("5m"),
+							),
+						),
+					),
+					subquery.WithRangeAndStep(0, time.Minute),
+					subquery.WithOffset(-time.Hour),
+				),
+				subquery.WithRangeAsVariable("$__range"),
+			),
+		),
+	),
+	vector.NewWithVariables(
+		vector.New(vector.WithMetricName("bar")),
+		vector.WithOffsetAsVariable("$offset"),
+	),
+)`,
+		},
+		{
+			name:  "function arguments",
+			query: `label_replace(clamp_min(up, -Inf), "a", "$1", "b", "(.*)")`,
+			expected: `promqlbuilder.LabelReplace(
+	promqlbuilder.ClampMin(vector.New(vector.WithMetricName("up")), math.Inf(-1)),
+	"a",
+	"$1",
+	"b",
+	"(.*)",
+)`,
+		},
+		{
+			name:  "function without matching helper",
+			query: `round(foo) + clamp_max(foo, scalar(bar))`,
+			opts:  []GoOption{WithPackageAlias("pb")},
+			expected: `pb.Add(
+	pb.NewFunction("round", vector.New(vector.WithMetricName("foo"))),
+	pb.NewFunction(
+		"clamp_max",
+		vector.New(vector.WithMetricName("foo")),
+		pb.Scalar(vector.New(vector.WithMetricName("bar"))),
+	),
+)`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := GenerateGo(test.query, test.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, code)
+		})
+	}
+}
+
+func TestGenerateGoError(t *testing.T) {
+	_, err := GenerateGo(`topk(scalar(foo), bar)`)
+	assert.EqualError(t, err, "$.param: only a number or a variable can be generated as parameter of topk, got *parser.Call")
+}
+
+func TestGenerateGoUsesFunctionHelpers(t *testing.T) {
+	kindOf := func(param *ast.Field) argKind {
+		switch typ := param.Type.(type) {
+		case *ast.Ident:
+			switch typ.Name {
+			case "float64":
+				return floatArg
+			case "string":
+				return stringArg
+			default:
+				return rangeArg
+			}
+		case *ast.Ellipsis:
+			if typ.Elt.(*ast.Ident).Name == "float64" {
+				return floatsArg
+			}
+			return stringsArg
+		default:
+			return exprArg
+		}
+	}
+	helpers := functionHelpers(t)
+	for name, fn := range parser.Functions {
+		helper, ok := helpers[name]
+		if !ok {
+			continue
+		}
+		assert.Equalf(t, helper.Name.Name, functionHelperName(name), "wrong helper name for the PromQL function %q", name)
+		kinds := []argKind{}
+		for _, param := range helper.Type.Params.List {
+			for range param.Names {
+				kinds = append(kinds, kindOf(param))
+			}
+		}
+		assert.Equalf(t, kinds, functionArgKinds(fn), "wrong arguments for the helper %s", helper.Name.Name)
+	}
+}
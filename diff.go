@@ -0,0 +1,378 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ChangeKind is the kind of change reported by Diff.
+type ChangeKind string
+
+const (
+	// NodeChanged is reported when a node is replaced by a node of another kind, like a function call by a number.
+	NodeChanged ChangeKind = "node"
+	// MetricNameChanged is reported when the metric name of a vector selector changed.
+	MetricNameChanged ChangeKind = "metric_name"
+	// MatcherAdded is reported for every label matcher added to a vector selector.
+	MatcherAdded ChangeKind = "matcher_added"
+	// MatcherRemoved is reported for every label matcher removed from a vector selector.
+	MatcherRemoved ChangeKind = "matcher_removed"
+	// RangeChanged is reported when the range of a range vector or a subquery changed.
+	RangeChanged ChangeKind = "range"
+	// StepChanged is reported when the step of a subquery changed.
+	StepChanged ChangeKind = "step"
+	// OffsetChanged is reported when the offset or the @ modifier of a selector or a subquery changed.
+	OffsetChanged ChangeKind = "offset"
+	// GroupingChanged is reported when the grouping labels of an aggregation changed.
+	GroupingChanged ChangeKind = "grouping"
+	// FunctionChanged is reported when a function call is replaced by the call of another function,
+	// or when the number of arguments changed.
+	FunctionChanged ChangeKind = "function"
+	// OperatorChanged is reported when the operator of an aggregation, a binary or a unary operation changed.
+	OperatorChanged ChangeKind = "operator"
+	// VectorMatchingChanged is reported when the bool modifier or the vector matching of a binary operation changed.
+	VectorMatchingChanged ChangeKind = "vector_matching"
+	// ValueChanged is reported when a number, a string or a variable changed.
+	ValueChanged ChangeKind = "value"
+)
+
+// Change is a difference between two expressions, found by Diff.
+type Change struct {
+	// Path is the path of the changed node in the new expression, like "$.expr.args[0]".
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+	Old  string     `json:"old,omitempty"`
+	New  string     `json:"new,omitempty"`
+}
+
+func (c *Change) String() string {
+	switch {
+	case c.Kind == MatcherAdded:
+		return fmt.Sprintf("%s: label matcher %s added", c.Path, c.New)
+	case c.Kind == MatcherRemoved:
+		return fmt.Sprintf("%s: label matcher %s removed", c.Path, c.Old)
+	case len(c.Old) == 0:
+		return fmt.Sprintf("%s: %s added", c.Path, c.New)
+	case len(c.New) == 0:
+		return fmt.Sprintf("%s: %s removed", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s: %s changed from %s to %s", c.Path, strings.ReplaceAll(string(c.Kind), "_", " "), c.Old, c.New)
+	}
+}
+
+// ChangeList is the list of changes returned by Diff. It can be encoded in JSON with encoding/json.
+type ChangeList []*Change
+
+// String returns a human-readable description of the changes, one per line.
+func (changes ChangeList) String() string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diff walks both expressions and returns the changes between their nodes, in depth-first order.
+// Parentheses are ignored, so paths refer to the nodes of the new expression without its parentheses.
+// When a node is replaced by a node of another kind, a single NodeChanged change is reported for the whole subtree.
+func Diff(oldExpr, newExpr parser.Expr) ChangeList {
+	d := &differ{}
+	d.diff(rootPath, oldExpr, newExpr)
+	return d.changes
+}
+
+type differ struct {
+	changes ChangeList
+}
+
+func (d *differ) add(path string, kind ChangeKind, oldValue, newValue string) {
+	d.changes = append(d.changes, &Change{Path: path, Kind: kind, Old: oldValue, New: newValue})
+}
+
+func (d *differ) diff(path string, oldExpr, newExpr parser.Expr) {
+	oldExpr, newExpr = withoutParens(oldExpr), withoutParens(newExpr)
+	if oldKind, newKind := nodeKind(oldExpr), nodeKind(newExpr); oldKind != newKind {
+		d.add(path, NodeChanged, exprString(oldExpr), exprString(newExpr))
+		return
+	}
+	switch nodeKind(newExpr) {
+	case "aggregation":
+		d.diffAggregation(path, AggregateExprOf(oldExpr), AggregateExprOf(newExpr))
+	case "binary":
+		d.diffBinary(path, BinaryExprOf(oldExpr), BinaryExprOf(newExpr))
+	case "matrix":
+		d.diffMatrix(path, newMatrixView(oldExpr), newMatrixView(newExpr))
+		// The vector selector is compared with the range vector, as the builder holds its offset.
+		return
+	case "subquery":
+		d.diffSubquery(path, newSubqueryView(oldExpr), newSubqueryView(newExpr))
+	case "vector":
+		oldVector, oldOffset := vectorSelectorOf(oldExpr)
+		newVector, newOffset := vectorSelectorOf(newExpr)
+		d.diffVector(path, oldVector, oldOffset, newVector, newOffset)
+		return
+	}
+	switch newNode := newExpr.(type) {
+	case *parser.Call:
+		oldNode := oldExpr.(*parser.Call)
+		if oldNode.Func.Name != newNode.Func.Name || len(oldNode.Args) != len(newNode.Args) {
+			d.add(path, FunctionChanged, oldNode.String(), newNode.String())
+			return
+		}
+	case *parser.UnaryExpr:
+		if oldNode := oldExpr.(*parser.UnaryExpr); oldNode.Op != newNode.Op {
+			d.add(path, OperatorChanged, oldNode.Op.String(), newNode.Op.String())
+		}
+	case *parser.NumberLiteral, *parser.StringLiteral, *variable.Expr:
+		if oldValue, newValue := oldExpr.String(), newExpr.String(); oldValue != newValue {
+			d.add(path, ValueChanged, oldValue, newValue)
+		}
+	}
+	// The children only differ in number when the parameter of an aggregation is added or removed,
+	// which is reported by diffAggregation. The expression aggregated is always the first child.
+	oldChildren, newChildren := Children(oldExpr), Children(newExpr)
+	for i := 0; i < len(oldChildren) && i < len(newChildren); i++ {
+		oldChild, oldOk := oldChildren[i].(parser.Expr)
+		newChild, newOk := newChildren[i].(parser.Expr)
+		if oldOk && newOk {
+			d.diff(childPath(path, newExpr, i), oldChild, newChild)
+		}
+	}
+}
+
+func (d *differ) diffAggregation(path string, oldNode, newNode *parser.AggregateExpr) {
+	if oldNode.Op != newNode.Op {
+		d.add(path, OperatorChanged, oldNode.Op.String(), newNode.Op.String())
+	}
+	if oldGrouping, newGrouping := groupingString(oldNode), groupingString(newNode); oldGrouping != newGrouping {
+		d.add(path, GroupingChanged, oldGrouping, newGrouping)
+	}
+	if (oldNode.Param == nil) != (newNode.Param == nil) {
+		d.add(path+".param", NodeChanged, exprString(oldNode.Param), exprString(newNode.Param))
+	}
+}
+
+func (d *differ) diffBinary(path string, oldNode, newNode *parser.BinaryExpr) {
+	if oldNode.Op != newNode.Op {
+		d.add(path, OperatorChanged, oldNode.Op.String(), newNode.Op.String())
+	}
+	if oldMatching, newMatching := vectorMatchingString(oldNode), vectorMatchingString(newNode); oldMatching != newMatching {
+		d.add(path, VectorMatchingChanged, oldMatching, newMatching)
+	}
+}
+
+func (d *differ) diffMatrix(path string, oldView, newView matrixView) {
+	if oldRange, newRange := formatDurationOrVariable(oldView.matrix.Range, oldView.rangeAsVariable), formatDurationOrVariable(newView.matrix.Range, newView.rangeAsVariable); oldRange != newRange {
+		d.add(path, RangeChanged, oldRange, newRange)
+	}
+	oldVector, _ := oldView.matrix.VectorSelector.(*parser.VectorSelector)
+	newVector, _ := newView.matrix.VectorSelector.(*parser.VectorSelector)
+	d.diffVector(path+".vector", oldVector, oldView.offsetAsVariable, newVector, newView.offsetAsVariable)
+}
+
+func (d *differ) diffSubquery(path string, oldView, newView subqueryView) {
+	if oldRange, newRange := formatDurationOrVariable(oldView.subquery.Range, oldView.rangeAsVariable), formatDurationOrVariable(newView.subquery.Range, newView.rangeAsVariable); oldRange != newRange {
+		d.add(path, RangeChanged, oldRange, newRange)
+	}
+	if oldStep, newStep := formatDurationOrVariable(oldView.subquery.Step, oldView.stepAsVariable), formatDurationOrVariable(newView.subquery.Step, newView.stepAsVariable); oldStep != newStep {
+		d.add(path, StepChanged, oldStep, newStep)
+	}
+	oldTime := timeModifiersString(oldView.subquery.OriginalOffset, oldView.offsetAsVariable, oldView.subquery.Timestamp, oldView.subquery.StartOrEnd)
+	newTime := timeModifiersString(newView.subquery.OriginalOffset, newView.offsetAsVariable, newView.subquery.Timestamp, newView.subquery.StartOrEnd)
+	if oldTime != newTime {
+		d.add(path, OffsetChanged, oldTime, newTime)
+	}
+}
+
+func (d *differ) diffVector(path string, oldNode *parser.VectorSelector, oldOffset string, newNode *parser.VectorSelector, newOffset string) {
+	if oldNode == nil || newNode == nil {
+		return
+	}
+	oldName, oldMatchers := metricNameAndMatchers(oldNode)
+	newName, newMatchers := metricNameAndMatchers(newNode)
+	if oldName != newName {
+		d.add(path, MetricNameChanged, strconv.Quote(oldName), strconv.Quote(newName))
+	}
+	for _, m := range oldMatchers {
+		if !containsMatcher(newMatchers, m) {
+			d.add(path, MatcherRemoved, m.String(), "")
+		}
+	}
+	for _, m := range newMatchers {
+		if !containsMatcher(oldMatchers, m) {
+			d.add(path, MatcherAdded, "", m.String())
+		}
+	}
+	oldTime := timeModifiersString(oldNode.OriginalOffset, oldOffset, oldNode.Timestamp, oldNode.StartOrEnd)
+	newTime := timeModifiersString(newNode.OriginalOffset, newOffset, newNode.Timestamp, newNode.StartOrEnd)
+	if oldTime != newTime {
+		d.add(path, OffsetChanged, oldTime, newTime)
+	}
+}
+
+func containsMatcher(matchers []*labels.Matcher, m *labels.Matcher) bool {
+	for _, other := range matchers {
+		if other.Type == m.Type && other.Name == m.Name && other.Value == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutParens returns the expression inside the parentheses, if any.
+func withoutParens(expr parser.Expr) parser.Expr {
+	for {
+		switch e := expr.(type) {
+		case *parser.ParenExpr:
+			expr = e.Expr
+		case *parser.StepInvariantExpr:
+			expr = e.Expr
+		default:
+			return expr
+		}
+	}
+}
+
+// nodeKind returns the kind of the node, whether it is built or parsed.
+func nodeKind(expr parser.Expr) string {
+	switch expr.(type) {
+	case nil:
+		return "nil"
+	case *parser.AggregateExpr, *AggregationBuilder:
+		return "aggregation"
+	case *parser.BinaryExpr, *BinaryBuilder, *BinaryWithVectorMatching:
+		return "binary"
+	case *parser.MatrixSelector, *matrix.Builder:
+		return "matrix"
+	case *parser.SubqueryExpr, *subquery.VariableBuilder:
+		return "subquery"
+	case *parser.VectorSelector, *vector.VariableBuilder:
+		return "vector"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+type matrixView struct {
+	matrix           *parser.MatrixSelector
+	rangeAsVariable  string
+	offsetAsVariable string
+}
+
+func newMatrixView(expr parser.Expr) matrixView {
+	if m, ok := expr.(*matrix.Builder); ok {
+		return matrixView{matrix: m.InternalMatrix, rangeAsVariable: m.RangeAsVariable, offsetAsVariable: m.OffsetAsVariable}
+	}
+	return matrixView{matrix: expr.(*parser.MatrixSelector)}
+}
+
+type subqueryView struct {
+	subquery         *parser.SubqueryExpr
+	rangeAsVariable  string
+	stepAsVariable   string
+	offsetAsVariable string
+}
+
+func newSubqueryView(expr parser.Expr) subqueryView {
+	if s, ok := expr.(*subquery.VariableBuilder); ok {
+		return subqueryView{subquery: s.InternalSubquery, rangeAsVariable: s.RangeAsVariable, stepAsVariable: s.StepAsVariable, offsetAsVariable: s.OffsetAsVariable}
+	}
+	return subqueryView{subquery: expr.(*parser.SubqueryExpr)}
+}
+
+// vectorSelectorOf returns the vector selector of the node and its offset variable, whether it is built or parsed.
+func vectorSelectorOf(expr parser.Expr) (*parser.VectorSelector, string) {
+	if v, ok := expr.(*vector.VariableBuilder); ok {
+		return v.InternalVector, v.OffsetAsVariable
+	}
+	vs, _ := expr.(*parser.VectorSelector)
+	return vs, ""
+}
+
+func groupingString(n *parser.AggregateExpr) string {
+	modifier := "by"
+	if n.Without {
+		modifier = "without"
+	}
+	return fmt.Sprintf("%s (%s)", modifier, strings.Join(n.Grouping, ", "))
+}
+
+// vectorMatchingString returns the modifiers of the binary operation, as written in PromQL.
+func vectorMatchingString(n *parser.BinaryExpr) string {
+	var parts []string
+	if n.ReturnBool {
+		parts = append(parts, "bool")
+	}
+	if vm := n.VectorMatching; vm != nil && hasVectorMatchingKeyword(vm) {
+		modifier := "ignoring"
+		if vm.On {
+			modifier = "on"
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", modifier, strings.Join(vm.MatchingLabels, ", ")))
+		switch vm.Card {
+		case parser.CardManyToOne:
+			parts = append(parts, fmt.Sprintf("group_left (%s)", strings.Join(vm.Include, ", ")))
+		case parser.CardOneToMany:
+			parts = append(parts, fmt.Sprintf("group_right (%s)", strings.Join(vm.Include, ", ")))
+		}
+		if vm.FillValues.LHS != nil {
+			parts = append(parts, fmt.Sprintf("fill_left (%v)", *vm.FillValues.LHS))
+		}
+		if vm.FillValues.RHS != nil {
+			parts = append(parts, fmt.Sprintf("fill_right (%v)", *vm.FillValues.RHS))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+// timeModifiersString returns the offset and @ modifiers as written in PromQL.
+func timeModifiersString(offset time.Duration, offsetAsVariable string, timestamp *int64, startOrEnd parser.ItemType) string {
+	var parts []string
+	if offset != 0 || len(offsetAsVariable) > 0 {
+		parts = append(parts, "offset "+formatDurationOrVariable(offset, offsetAsVariable))
+	}
+	switch {
+	case timestamp != nil:
+		parts = append(parts, fmt.Sprintf("@ %.3f", float64(*timestamp)/1000.0))
+	case startOrEnd == parser.START:
+		parts = append(parts, "@ start()")
+	case startOrEnd == parser.END:
+		parts = append(parts, "@ end()")
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+func exprString(expr parser.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return expr.String()
+}
@@ -0,0 +1,111 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		old      parser.Expr
+		new      parser.Expr
+		expected string
+	}{
+		{
+			name: "built and parsed",
+			old: Sum(Rate(matrix.New(
+				vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("job").Equal("a"))),
+				matrix.WithRangeAsVariable("$__rate_interval"),
+			))).By("job"),
+			new:      MustParse(`sum by (job) ((rate(foo{job="a"}[$__rate_interval])))`),
+			expected: "",
+		},
+		{
+			name:     "metric name",
+			old:      MustParse(`foo{job="a"}`),
+			new:      MustParse(`{__name__="bar",job="a"}`),
+			expected: `$: metric name changed from "foo" to "bar"`,
+		},
+		{
+			name: "label matchers",
+			old:  MustParse(`rate(foo{job="a",env="prod"}[5m])`),
+			new:  MustParse(`rate(foo{env="prod",job=~"a|b"}[5m])`),
+			expected: `$.args[0].vector: label matcher job="a" removed
+$.args[0].vector: label matcher job=~"a|b" added`,
+		},
+		{
+			name: "range and offset",
+			old:  MustParse(`rate(foo[5m]) + max_over_time(rate(foo[1m])[1h:1m])`),
+			new:  MustParse(`rate(foo[$__rate_interval] offset 1d) + max_over_time(rate(foo[1m])[2h:] @ end())`),
+			expected: `$.lhs.args[0]: range changed from 5m to $__rate_interval
+$.lhs.args[0].vector: offset changed from none to offset 1d
+$.rhs.args[0]: range changed from 1h to 2h
+$.rhs.args[0]: step changed from 1m to 0s
+$.rhs.args[0]: offset changed from none to @ end()`,
+		},
+		{
+			name: "aggregation",
+			old:  MustParse(`sum by (job) (foo)`),
+			new:  MustParse(`topk without (instance) (5, foo)`),
+			expected: `$: operator changed from sum to topk
+$: grouping changed from by (job) to without (instance)
+$.param: 5 added`,
+		},
+		{
+			name: "binary operation",
+			old:  MustParse(`foo / bar > 1`),
+			new:  MustParse(`foo * on (job) group_left () bar > bool 2`),
+			expected: `$: vector matching changed from none to bool
+$.lhs: operator changed from / to *
+$.lhs: vector matching changed from none to on (job) group_left ()
+$.rhs: value changed from 1 to 2`,
+		},
+		{
+			name:     "function",
+			old:      MustParse(`sum(rate(foo[5m]))`),
+			new:      MustParse(`sum(increase(foo[5m]))`),
+			expected: `$.expr: function changed from rate(foo[5m]) to increase(foo[5m])`,
+		},
+		{
+			name:     "node",
+			old:      MustParse(`label_replace(foo, "a", "$1", "b", "(.*)")`),
+			new:      MustParse(`label_replace(vector(1), "a", "$1", "c", "(.*)")`),
+			expected: "$.args[0]: node changed from foo to vector(1)\n$.args[3]: value changed from \"b\" to \"c\"",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Diff(test.old, test.new).String())
+		})
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	data, err := json.Marshal(Diff(MustParse(`foo{job="a"}`), MustParse(`bar`)))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"path": "$", "kind": "metric_name", "old": "\"foo\"", "new": "\"bar\""},
+		{"path": "$", "kind": "matcher_removed", "old": "job=\"a\""}
+	]`, string(data))
+}
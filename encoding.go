@@ -0,0 +1,655 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v3"
+)
+
+// Expression wraps an expression so it can be stored as JSON or YAML, for example in a configuration file
+// or in a Perses dashboard spec, and edited without parsing PromQL.
+//
+// Every node is encoded as an object with a "kind" field, like:
+//
+//	{"kind": "aggregation", "op": "sum", "grouping": ["job"], "expr": {
+//	  "kind": "call", "func": "rate", "args": [{
+//	    "kind": "matrix", "range": "$__rate_interval", "vector": {"kind": "vector", "name": "foo"}
+//	  }]
+//	}}
+//
+// Ranges, steps and offsets are written like in PromQL ("5m", "-1h") or as a dashboard variable ("$__rate_interval").
+// The decoded tree uses the same node types as Parse: aggregations are *AggregationBuilder, binary operations are
+// *BinaryBuilder or *BinaryWithVectorMatching, range vectors are *matrix.Builder and the selectors and subqueries
+// using variables are *vector.VariableBuilder and *subquery.VariableBuilder.
+type Expression struct {
+	Expr parser.Expr
+}
+
+const (
+	kindAggregation = "aggregation"
+	kindBinary      = "binary"
+	kindCall        = "call"
+	kindMatrix      = "matrix"
+	kindNumber      = "number"
+	kindParen       = "paren"
+	kindString      = "string"
+	kindSubquery    = "subquery"
+	kindUnary       = "unary"
+	kindVariable    = "variable"
+	kindVector      = "vector"
+)
+
+// encodedExpr is the JSON and YAML representation of a node. Only the fields used by its kind are set.
+type encodedExpr struct {
+	Kind      string           `json:"kind" yaml:"kind"`
+	Op        string           `json:"op,omitempty" yaml:"op,omitempty"`
+	Func      string           `json:"func,omitempty" yaml:"func,omitempty"`
+	Name      string           `json:"name,omitempty" yaml:"name,omitempty"`
+	Matchers  []encodedMatcher `json:"matchers,omitempty" yaml:"matchers,omitempty"`
+	Value     *encodedNumber   `json:"value,omitempty" yaml:"value,omitempty"`
+	Text      string           `json:"text,omitempty" yaml:"text,omitempty"`
+	Reference string           `json:"reference,omitempty" yaml:"reference,omitempty"`
+	Grouping  []string         `json:"grouping,omitempty" yaml:"grouping,omitempty"`
+	Without   bool             `json:"without,omitempty" yaml:"without,omitempty"`
+	Bool      bool             `json:"bool,omitempty" yaml:"bool,omitempty"`
+	Matching  *encodedMatching `json:"matching,omitempty" yaml:"matching,omitempty"`
+	Range     string           `json:"range,omitempty" yaml:"range,omitempty"`
+	Step      string           `json:"step,omitempty" yaml:"step,omitempty"`
+	Offset    string           `json:"offset,omitempty" yaml:"offset,omitempty"`
+	At        string           `json:"at,omitempty" yaml:"at,omitempty"`
+	Expr      *encodedExpr     `json:"expr,omitempty" yaml:"expr,omitempty"`
+	Param     *encodedExpr     `json:"param,omitempty" yaml:"param,omitempty"`
+	LHS       *encodedExpr     `json:"lhs,omitempty" yaml:"lhs,omitempty"`
+	RHS       *encodedExpr     `json:"rhs,omitempty" yaml:"rhs,omitempty"`
+	Args      []*encodedExpr   `json:"args,omitempty" yaml:"args,omitempty"`
+	Vector    *encodedExpr     `json:"vector,omitempty" yaml:"vector,omitempty"`
+}
+
+type encodedMatcher struct {
+	Name  string `json:"name" yaml:"name"`
+	Type  string `json:"type" yaml:"type"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// encodedMatching is the vector matching of a binary operation. Card is "one-to-one", "many-to-one",
+// "one-to-many" or "many-to-many", like parser.VectorMatchCardinality.
+type encodedMatching struct {
+	Card      string         `json:"card,omitempty" yaml:"card,omitempty"`
+	On        bool           `json:"on,omitempty" yaml:"on,omitempty"`
+	Labels    []string       `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Include   []string       `json:"include,omitempty" yaml:"include,omitempty"`
+	FillLeft  *encodedNumber `json:"fill_left,omitempty" yaml:"fill_left,omitempty"`
+	FillRight *encodedNumber `json:"fill_right,omitempty" yaml:"fill_right,omitempty"`
+}
+
+// encodedNumber is a float encoded as a JSON number, or as the strings "+Inf", "-Inf" and "NaN"
+// that cannot be represented otherwise. YAML supports them natively.
+type encodedNumber float64
+
+func (n encodedNumber) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (n *encodedNumber) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		*n = encodedNumber(f)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*n = encodedNumber(f)
+	return nil
+}
+
+// MarshalJSON encodes the expression tree. A nil expression is encoded as null.
+func (e Expression) MarshalJSON() ([]byte, error) {
+	if e.Expr == nil {
+		return []byte("null"), nil
+	}
+	encoded, err := encodeExpr(e.Expr, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes an expression tree encoded by MarshalJSON.
+func (e *Expression) UnmarshalJSON(data []byte) error {
+	var encoded *encodedExpr
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	return e.decode(encoded)
+}
+
+// MarshalYAML encodes the expression tree with the same fields as MarshalJSON.
+func (e Expression) MarshalYAML() (any, error) {
+	if e.Expr == nil {
+		return nil, nil
+	}
+	return encodeExpr(e.Expr, rootPath)
+}
+
+// UnmarshalYAML decodes an expression tree encoded by MarshalYAML.
+func (e *Expression) UnmarshalYAML(value *yaml.Node) error {
+	var encoded *encodedExpr
+	if err := value.Decode(&encoded); err != nil {
+		return err
+	}
+	return e.decode(encoded)
+}
+
+func (e *Expression) decode(encoded *encodedExpr) error {
+	if encoded == nil {
+		e.Expr = nil
+		return nil
+	}
+	expr, err := decodeExpr(encoded, rootPath)
+	if err != nil {
+		return err
+	}
+	e.Expr = expr
+	return nil
+}
+
+func encodeExpr(node parser.Expr, path string) (*encodedExpr, error) {
+	switch n := node.(type) {
+	case *parser.StepInvariantExpr:
+		return encodeExpr(n.Expr, path)
+	case *parser.ParenExpr:
+		return encodeWithExpr(&encodedExpr{Kind: kindParen}, n.Expr, path)
+	case *parser.UnaryExpr:
+		return encodeWithExpr(&encodedExpr{Kind: kindUnary, Op: n.Op.String()}, n.Expr, path)
+	case *parser.AggregateExpr:
+		return encodeAggregation(n, path)
+	case *AggregationBuilder:
+		return encodeAggregation(n.internal, path)
+	case *parser.BinaryExpr:
+		return encodeBinary(n, node, path)
+	case *BinaryBuilder:
+		return encodeBinary(n.internal, node, path)
+	case *BinaryWithVectorMatching:
+		return encodeBinary(n.binaryOpt.internal, node, path)
+	case *parser.Call:
+		result := &encodedExpr{Kind: kindCall, Func: n.Func.Name, Args: make([]*encodedExpr, len(n.Args))}
+		for i, arg := range n.Args {
+			encoded, err := encodeExpr(arg, childPath(path, node, i))
+			if err != nil {
+				return nil, err
+			}
+			result.Args[i] = encoded
+		}
+		return result, nil
+	case *parser.MatrixSelector:
+		return encodeMatrix(n, "", "", path)
+	case *matrix.Builder:
+		return encodeMatrix(n.InternalMatrix, n.RangeAsVariable, n.OffsetAsVariable, path)
+	case *parser.SubqueryExpr:
+		return encodeSubquery(n, "", "", "", node, path)
+	case *subquery.VariableBuilder:
+		return encodeSubquery(n.InternalSubquery, n.RangeAsVariable, n.StepAsVariable, n.OffsetAsVariable, node, path)
+	case *parser.VectorSelector:
+		return encodeVector(n, ""), nil
+	case *vector.VariableBuilder:
+		return encodeVector(n.InternalVector, n.OffsetAsVariable), nil
+	case *parser.NumberLiteral:
+		value := encodedNumber(n.Val)
+		return &encodedExpr{Kind: kindNumber, Value: &value}, nil
+	case *parser.StringLiteral:
+		return &encodedExpr{Kind: kindString, Text: n.Val}, nil
+	case *variable.Expr:
+		return &encodedExpr{Kind: kindVariable, Reference: n.Reference}, nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported node type %T", path, node)
+	}
+}
+
+// encodeWithExpr sets the field expr of the encoded node, for the nodes having a single child.
+func encodeWithExpr(result *encodedExpr, expr parser.Expr, path string) (*encodedExpr, error) {
+	encoded, err := encodeExpr(expr, path+".expr")
+	if err != nil {
+		return nil, err
+	}
+	result.Expr = encoded
+	return result, nil
+}
+
+func encodeAggregation(n *parser.AggregateExpr, path string) (*encodedExpr, error) {
+	result := &encodedExpr{Kind: kindAggregation, Op: n.Op.String(), Grouping: n.Grouping, Without: n.Without}
+	if n.Param != nil {
+		encoded, err := encodeExpr(n.Param, path+".param")
+		if err != nil {
+			return nil, err
+		}
+		result.Param = encoded
+	}
+	return encodeWithExpr(result, n.Expr, path)
+}
+
+func encodeBinary(n *parser.BinaryExpr, node parser.Node, path string) (*encodedExpr, error) {
+	lhs, err := encodeExpr(n.LHS, childPath(path, node, 0))
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := encodeExpr(n.RHS, childPath(path, node, 1))
+	if err != nil {
+		return nil, err
+	}
+	result := &encodedExpr{Kind: kindBinary, Op: n.Op.String(), Bool: n.ReturnBool, LHS: lhs, RHS: rhs}
+	if vm := n.VectorMatching; vm != nil {
+		result.Matching = &encodedMatching{
+			Card:    vm.Card.String(),
+			On:      vm.On,
+			Labels:  vm.MatchingLabels,
+			Include: vm.Include,
+		}
+		if vm.FillValues.LHS != nil {
+			v := encodedNumber(*vm.FillValues.LHS)
+			result.Matching.FillLeft = &v
+		}
+		if vm.FillValues.RHS != nil {
+			v := encodedNumber(*vm.FillValues.RHS)
+			result.Matching.FillRight = &v
+		}
+	}
+	return result, nil
+}
+
+// encodeMatrix encodes a range vector. Its offset and @ modifier are encoded in the inner vector selector.
+func encodeMatrix(n *parser.MatrixSelector, rangeAsVariable, offsetAsVariable string, path string) (*encodedExpr, error) {
+	vs, ok := n.VectorSelector.(*parser.VectorSelector)
+	if !ok {
+		return nil, fmt.Errorf("%s.vector: a range vector can only wrap a vector selector, got %T", path, n.VectorSelector)
+	}
+	return &encodedExpr{Kind: kindMatrix, Range: formatDurationOrVariable(n.Range, rangeAsVariable), Vector: encodeVector(vs, offsetAsVariable)}, nil
+}
+
+func encodeSubquery(n *parser.SubqueryExpr, rangeAsVariable, stepAsVariable, offsetAsVariable string, node parser.Node, path string) (*encodedExpr, error) {
+	result := &encodedExpr{
+		Kind:   kindSubquery,
+		Range:  formatDurationOrVariable(n.Range, rangeAsVariable),
+		Offset: formatOffset(n.OriginalOffset, offsetAsVariable),
+		At:     formatAt(n.Timestamp, n.StartOrEnd),
+	}
+	if n.Step != 0 || len(stepAsVariable) > 0 {
+		result.Step = formatDurationOrVariable(n.Step, stepAsVariable)
+	}
+	encoded, err := encodeExpr(n.Expr, childPath(path, node, 0))
+	if err != nil {
+		return nil, err
+	}
+	result.Expr = encoded
+	return result, nil
+}
+
+func encodeVector(n *parser.VectorSelector, offsetAsVariable string) *encodedExpr {
+	result := &encodedExpr{
+		Kind:   kindVector,
+		Name:   n.Name,
+		Offset: formatOffset(n.OriginalOffset, offsetAsVariable),
+		At:     formatAt(n.Timestamp, n.StartOrEnd),
+	}
+	for _, m := range n.LabelMatchers {
+		// The parser adds the metric name as a matcher, it is already encoded as the name.
+		if len(n.Name) > 0 && m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == n.Name {
+			continue
+		}
+		result.Matchers = append(result.Matchers, encodedMatcher{Name: m.Name, Type: m.Type.String(), Value: m.Value})
+	}
+	return result
+}
+
+// formatOffset returns the offset as written in PromQL, or an empty string when there is no offset.
+func formatOffset(d time.Duration, variableName string) string {
+	if d == 0 && len(variableName) == 0 {
+		return ""
+	}
+	return formatDurationOrVariable(d, variableName)
+}
+
+// formatAt returns the value of the @ modifier as written in PromQL, like "start()" or "1700000000.5".
+func formatAt(timestamp *int64, startOrEnd parser.ItemType) string {
+	switch {
+	case timestamp != nil:
+		return strconv.FormatFloat(float64(*timestamp)/1000, 'f', -1, 64)
+	case startOrEnd == parser.START:
+		return "start()"
+	case startOrEnd == parser.END:
+		return "end()"
+	default:
+		return ""
+	}
+}
+
+func decodeExpr(e *encodedExpr, path string) (parser.Expr, error) {
+	if e == nil {
+		return nil, fmt.Errorf("%s: missing expression", path)
+	}
+	switch e.Kind {
+	case kindAggregation:
+		return decodeAggregation(e, path)
+	case kindBinary:
+		return decodeBinary(e, path)
+	case kindCall:
+		args := make([]parser.Expr, len(e.Args))
+		for i, arg := range e.Args {
+			decoded, err := decodeExpr(arg, fmt.Sprintf("%s.args[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			args[i] = decoded
+		}
+		if len(e.Func) == 0 {
+			return nil, fmt.Errorf("%s: missing function name", path)
+		}
+		return NewFunction(e.Func, args...), nil
+	case kindMatrix:
+		return decodeMatrix(e, path)
+	case kindSubquery:
+		return decodeSubquery(e, path)
+	case kindVector:
+		vs, offsetAsVariable, err := decodeVector(e, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(offsetAsVariable) > 0 {
+			return vector.NewWithVariables(vs, vector.WithOffsetAsVariable(offsetAsVariable)), nil
+		}
+		return vs, nil
+	case kindNumber:
+		if e.Value == nil {
+			return nil, fmt.Errorf("%s: missing value of the number", path)
+		}
+		return NewNumber(float64(*e.Value)), nil
+	case kindString:
+		return NewString(e.Text), nil
+	case kindVariable:
+		if !variable.IsReference(e.Reference) {
+			return nil, fmt.Errorf("%s: %q is not a valid variable reference", path, e.Reference)
+		}
+		return variable.New(e.Reference), nil
+	case kindParen:
+		expr, err := decodeExpr(e.Expr, path+".expr")
+		if err != nil {
+			return nil, err
+		}
+		return Parenthesis(expr), nil
+	case kindUnary:
+		op, ok := unaryOperators[e.Op]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown unary operator %q", path, e.Op)
+		}
+		expr, err := decodeExpr(e.Expr, path+".expr")
+		if err != nil {
+			return nil, err
+		}
+		return &parser.UnaryExpr{Op: op, Expr: expr}, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown kind %q", path, e.Kind)
+	}
+}
+
+var unaryOperators = map[string]parser.ItemType{
+	"+": parser.ADD,
+	"-": parser.SUB,
+}
+
+// operators maps the aggregation and binary operators to their item type, like "sum" or "/".
+var operators = func() map[string]parser.ItemType {
+	result := make(map[string]parser.ItemType)
+	for item, s := range parser.ItemTypeStr {
+		if item.IsAggregator() || item.IsOperator() {
+			result[s] = item
+		}
+	}
+	return result
+}()
+
+var cardinalities = map[string]parser.VectorMatchCardinality{
+	parser.CardOneToOne.String():   parser.CardOneToOne,
+	parser.CardManyToOne.String():  parser.CardManyToOne,
+	parser.CardOneToMany.String():  parser.CardOneToMany,
+	parser.CardManyToMany.String(): parser.CardManyToMany,
+}
+
+var matchTypes = map[string]labels.MatchType{
+	labels.MatchEqual.String():     labels.MatchEqual,
+	labels.MatchNotEqual.String():  labels.MatchNotEqual,
+	labels.MatchRegexp.String():    labels.MatchRegexp,
+	labels.MatchNotRegexp.String(): labels.MatchNotRegexp,
+}
+
+func decodeAggregation(e *encodedExpr, path string) (parser.Expr, error) {
+	op, ok := operators[e.Op]
+	if !ok || !op.IsAggregator() {
+		return nil, fmt.Errorf("%s: unknown aggregation operator %q", path, e.Op)
+	}
+	expr, err := decodeExpr(e.Expr, path+".expr")
+	if err != nil {
+		return nil, err
+	}
+	var param parser.Expr
+	if e.Param != nil {
+		if param, err = decodeExpr(e.Param, path+".param"); err != nil {
+			return nil, err
+		}
+	}
+	b := createWithParam(op, expr, param)
+	if e.Without {
+		return b.Without(e.Grouping...), nil
+	}
+	return b.By(e.Grouping...), nil
+}
+
+func decodeBinary(e *encodedExpr, path string) (parser.Expr, error) {
+	op, ok := operators[e.Op]
+	if !ok || !op.IsOperator() {
+		return nil, fmt.Errorf("%s: unknown binary operator %q", path, e.Op)
+	}
+	lhs, err := decodeExpr(e.LHS, path+".lhs")
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := decodeExpr(e.RHS, path+".rhs")
+	if err != nil {
+		return nil, err
+	}
+	b := createBinaryOperation(op, lhs, rhs)
+	b.internal.ReturnBool = e.Bool
+	if m := e.Matching; m != nil {
+		vm := &parser.VectorMatching{On: m.On, MatchingLabels: m.Labels, Include: m.Include}
+		if len(m.Card) > 0 {
+			if vm.Card, ok = cardinalities[m.Card]; !ok {
+				return nil, fmt.Errorf("%s: unknown vector matching cardinality %q", path, m.Card)
+			}
+		}
+		if m.FillLeft != nil {
+			v := float64(*m.FillLeft)
+			vm.FillValues.LHS = &v
+		}
+		if m.FillRight != nil {
+			v := float64(*m.FillRight)
+			vm.FillValues.RHS = &v
+		}
+		b.internal.VectorMatching = vm
+	}
+	if hasVectorMatchingKeyword(b.internal.VectorMatching) {
+		return &BinaryWithVectorMatching{binaryOpt: b}, nil
+	}
+	return b, nil
+}
+
+func decodeMatrix(e *encodedExpr, path string) (parser.Expr, error) {
+	if e.Vector == nil || e.Vector.Kind != kindVector {
+		return nil, fmt.Errorf("%s.vector: a range vector can only wrap a vector selector", path)
+	}
+	vs, offsetAsVariable, err := decodeVector(e.Vector, path+".vector")
+	if err != nil {
+		return nil, err
+	}
+	d, rangeAsVariable, err := parseDurationOrVariable(e.Range)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid range: %w", path, err)
+	}
+	return matrix.New(vs, matrix.WithRange(d), matrix.WithRangeAsVariable(rangeAsVariable), matrix.WithOffsetAsVariable(offsetAsVariable)), nil
+}
+
+func decodeSubquery(e *encodedExpr, path string) (parser.Expr, error) {
+	expr, err := decodeExpr(e.Expr, path+".expr")
+	if err != nil {
+		return nil, err
+	}
+	rangeDuration, rangeAsVariable, err := parseDurationOrVariable(e.Range)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid range: %w", path, err)
+	}
+	var step time.Duration
+	var stepAsVariable string
+	if len(e.Step) > 0 {
+		if step, stepAsVariable, err = parseDurationOrVariable(e.Step); err != nil {
+			return nil, fmt.Errorf("%s: invalid step: %w", path, err)
+		}
+	}
+	opts := []subquery.Option{subquery.WithExpr(expr), subquery.WithRangeAndStep(rangeDuration, step)}
+	offset, offsetAsVariable, err := parseOffset(e.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid offset: %w", path, err)
+	}
+	switch at, timestamp, err := parseAt(e.At); {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", path, err)
+	case at == parser.START:
+		opts = append(opts, subquery.WithAtStart())
+	case at == parser.END:
+		opts = append(opts, subquery.WithAtEnd())
+	case timestamp != nil:
+		opts = append(opts, subquery.WithAtSpecificTimeStamp(*timestamp))
+	}
+	sq := subquery.New(opts...)
+	// Like the parser, the offset is set in both fields, as String uses OriginalOffset.
+	sq.OriginalOffset, sq.Offset = offset, offset
+	if len(rangeAsVariable) == 0 && len(stepAsVariable) == 0 && len(offsetAsVariable) == 0 {
+		return sq, nil
+	}
+	return subquery.NewWithVariables(sq,
+		subquery.WithRangeAndStepAsVariable(rangeAsVariable, stepAsVariable),
+		subquery.WithOffsetAsVariable(offsetAsVariable),
+	), nil
+}
+
+// decodeVector returns the vector selector and its offset when it is a variable.
+func decodeVector(e *encodedExpr, path string) (*parser.VectorSelector, string, error) {
+	matchers := make([]*labels.Matcher, len(e.Matchers))
+	for i, m := range e.Matchers {
+		t, ok := matchTypes[m.Type]
+		if !ok {
+			return nil, "", fmt.Errorf("%s: unknown type %q for the label matcher %q", path, m.Type, m.Name)
+		}
+		matcher, err := labels.NewMatcher(t, m.Name, m.Value)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: invalid label matcher %q: %w", path, m.Name, err)
+		}
+		matchers[i] = matcher
+	}
+	opts := []vector.Option{vector.WithMetricName(e.Name)}
+	if len(matchers) > 0 {
+		opts = append(opts, vector.WithLabelMatchers(matchers...))
+	}
+	offset, offsetAsVariable, err := parseOffset(e.Offset)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: invalid offset: %w", path, err)
+	}
+	switch at, timestamp, err := parseAt(e.At); {
+	case err != nil:
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	case at == parser.START:
+		opts = append(opts, vector.WithAtStart())
+	case at == parser.END:
+		opts = append(opts, vector.WithAtEnd())
+	case timestamp != nil:
+		opts = append(opts, vector.WithAtSpecificTimeStamp(*timestamp))
+	}
+	vs := vector.New(opts...)
+	// Like the parser, the offset is set in both fields, as String uses OriginalOffset.
+	vs.OriginalOffset, vs.Offset = offset, offset
+	return vs, offsetAsVariable, nil
+}
+
+// parseDurationOrVariable parses a duration like "5m", or returns the variable when it is a variable reference,
+// possibly followed by a unit like "${__range_s}s".
+func parseDurationOrVariable(s string) (time.Duration, string, error) {
+	if _, _, ok := variable.SplitDuration(s); ok {
+		return 0, s, nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		return 0, "", err
+	}
+	return time.Duration(d), "", nil
+}
+
+// parseOffset is like parseDurationOrVariable but accepts negative durations and an empty string for no offset.
+func parseOffset(s string) (time.Duration, string, error) {
+	if len(s) == 0 {
+		return 0, "", nil
+	}
+	if negative, ok := strings.CutPrefix(s, "-"); ok {
+		d, err := model.ParseDuration(negative)
+		return -time.Duration(d), "", err
+	}
+	return parseDurationOrVariable(s)
+}
+
+// parseAt parses the value of the @ modifier, returning either parser.START, parser.END or a timestamp in milliseconds.
+func parseAt(s string) (parser.ItemType, *int64, error) {
+	switch s {
+	case "":
+		return 0, nil, nil
+	case "start()":
+		return parser.START, nil, nil
+	case "end()":
+		return parser.END, nil, nil
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid @ modifier %q", s)
+	}
+	timestamp := int64(math.Round(seconds * 1000))
+	return 0, &timestamp, nil
+}
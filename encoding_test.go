@@ -0,0 +1,160 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+)
+
+func TestExpressionRoundTrip(t *testing.T) {
+	testSuite := []struct {
+		name string
+		expr parser.Expr
+	}{
+		{
+			name: "builders",
+			expr: Div(
+				Sum(Rate(matrix.New(
+					vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("job").EqualRegexp("a|b"))),
+					matrix.WithRangeAsVariable("$__rate_interval"),
+				))).Without("instance"),
+				TopKAsVariable(vector.New(vector.WithMetricName("bar"), vector.WithOffsetAsString("1h")), "$k"),
+			).On("job").GroupLeft("team").FillRHS(math.Inf(1)),
+		},
+		{
+			name: "parsed",
+			expr: MustParse(`-(sum by (job) (rate(foo[5m] @ start() offset -1m)) > bool 0.5) or label_replace(up, "a", "$1", "b", "(.*)")`),
+		},
+		{
+			name: "variables",
+			expr: MustParse(`max_over_time(rate(foo[$__rate_interval])[$__range:$__interval] offset $offset) + bar offset $offset`),
+		},
+		{
+			name: "variables followed by a unit",
+			expr: MustParse(`rate(foo[${__range_s}s] offset ${offset_m}m)`),
+		},
+		{
+			name: "subquery",
+			expr: subquery.New(subquery.WithExpr(vector.New(vector.WithMetricName("foo"))), subquery.WithRangeAndStep(3600e9, 60e9), subquery.WithAtSpecificTimeStamp(1700000000500)),
+		},
+		{
+			name: "vector matching without keyword",
+			expr: MustParse(`(foo / bar) and baz`),
+		},
+		{
+			name: "numbers",
+			expr: Add(NewNumber(math.NaN()), Parenthesis(NewNumber(1e-3))),
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(Expression{Expr: test.expr})
+			require.NoError(t, err)
+			var fromJSON Expression
+			require.NoError(t, json.Unmarshal(data, &fromJSON))
+			assert.Equal(t, test.expr.String(), fromJSON.Expr.String())
+			assert.Equal(t, fmt.Sprintf("%T", test.expr), fmt.Sprintf("%T", fromJSON.Expr))
+			assert.True(t, Equal(test.expr, fromJSON.Expr))
+
+			data, err = yaml.Marshal(Expression{Expr: test.expr})
+			require.NoError(t, err)
+			var fromYAML Expression
+			require.NoError(t, yaml.Unmarshal(data, &fromYAML))
+			assert.Equal(t, test.expr.String(), fromYAML.Expr.String())
+			assert.True(t, Equal(test.expr, fromYAML.Expr))
+		})
+	}
+}
+
+func TestExpressionMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Expression{Expr: MustParse(`sum by (job) (rate(foo{code="500"}[$__rate_interval])) / on (job) bar`)})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"kind": "binary", "op": "/", "matching": {"card": "one-to-one", "on": true, "labels": ["job"]},
+		"lhs": {"kind": "aggregation", "op": "sum", "grouping": ["job"], "expr": {
+			"kind": "call", "func": "rate", "args": [{
+				"kind": "matrix", "range": "$__rate_interval", "vector": {
+					"kind": "vector", "name": "foo", "matchers": [{"name": "code", "type": "=", "value": "500"}]
+				}
+			}]
+		}},
+		"rhs": {"kind": "vector", "name": "bar"}
+	}`, string(data))
+}
+
+func TestExpressionUnmarshalYAML(t *testing.T) {
+	var e Expression
+	require.NoError(t, yaml.Unmarshal([]byte(`
+kind: aggregation
+op: topk
+param: {kind: variable, reference: $k}
+expr:
+  kind: subquery
+  range: 1h
+  step: $__interval
+  expr: {kind: vector, name: foo, offset: -5m}
+`), &e))
+	assert.Equal(t, "topk($k, foo offset -5m[1h:$__interval])", e.Expr.String())
+	assert.IsType(t, &AggregationBuilder{}, e.Expr)
+}
+
+func TestExpressionUnmarshalError(t *testing.T) {
+	testSuite := []struct {
+		data string
+		err  string
+	}{
+		{
+			data: `{"kind": "foo"}`,
+			err:  `$: unknown kind "foo"`,
+		},
+		{
+			data: `{"kind": "call", "func": "rate", "args": [{"kind": "matrix", "range": "5x", "vector": {"kind": "vector", "name": "foo"}}]}`,
+			err:  `$.args[0]: invalid range: unknown unit "x" in duration "5x"`,
+		},
+		{
+			data: `{"kind": "aggregation", "op": "+", "expr": {"kind": "vector", "name": "foo"}}`,
+			err:  `$: unknown aggregation operator "+"`,
+		},
+		{
+			data: `{"kind": "binary", "op": "/", "lhs": {"kind": "number", "value": 1}}`,
+			err:  `$.rhs: missing expression`,
+		},
+		{
+			data: `{"kind": "vector", "matchers": [{"name": "job", "type": "==", "value": "a"}]}`,
+			err:  `$: unknown type "==" for the label matcher "job"`,
+		},
+		{
+			data: `{"kind": "variable", "reference": "k"}`,
+			err:  `$: "k" is not a valid variable reference`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.err, func(t *testing.T) {
+			var e Expression
+			assert.EqualError(t, json.Unmarshal([]byte(test.data), &e), test.err)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// EnforceMode defines what EnforceMatchers does when a vector selector already has a matcher on an enforced label.
+type EnforceMode int
+
+const (
+	// EnforceOverride replaces the existing matchers on the enforced labels.
+	EnforceOverride EnforceMode = iota
+	// EnforceStrict returns an error when an existing matcher on an enforced label is different from the enforced one.
+	EnforceStrict
+)
+
+// EnforceMatchers returns a copy of the expression where the given matchers are set on every vector selector,
+// including the ones of range vectors and subqueries. It can be used to restrict a query to a tenant,
+// like prom-label-proxy does: EnforceMatchers(expr, EnforceStrict, labels.MustNewMatcher(labels.MatchEqual, "tenant", "x")).
+// The given expression is not modified.
+func EnforceMatchers(expr parser.Expr, mode EnforceMode, matchers ...*labels.Matcher) (parser.Expr, error) {
+	result := DeepCopyExpr(expr)
+	err := Walk(inspector(func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			return enforceMatchers(vs, mode, matchers)
+		}
+		return nil
+	}), result, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func enforceMatchers(vs *parser.VectorSelector, mode EnforceMode, enforced []*labels.Matcher) error {
+	for _, e := range enforced {
+		var kept []*labels.Matcher
+		for _, m := range vs.LabelMatchers {
+			if m.Name != e.Name {
+				kept = append(kept, m)
+				continue
+			}
+			if mode == EnforceStrict && (m.Type != e.Type || m.Value != e.Value) {
+				return fmt.Errorf("matcher %s of %s conflicts with the enforced matcher %s", m, vs, e)
+			}
+		}
+		// Every selector gets its own copy, so that changing the matcher of a selector does not change the others.
+		clone := *e
+		vs.LabelMatchers = append(kept, &clone)
+	}
+	return nil
+}
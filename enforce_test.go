@@ -0,0 +1,98 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnforceMatchers(t *testing.T) {
+	tenant := labels.MustNewMatcher(labels.MatchEqual, "tenant", "x")
+	testSuite := []struct {
+		name     string
+		query    string
+		mode     EnforceMode
+		expected string
+		err      string
+	}{
+		{
+			name:     "vector selector",
+			query:    "foo",
+			expected: `foo{tenant="x"}`,
+		},
+		{
+			name:     "range vectors and subqueries",
+			query:    `sum(rate(foo{job="a"}[$__rate_interval])) / max_over_time(bar[1h:5m]) or vector(1)`,
+			expected: `sum(rate(foo{job="a",tenant="x"}[$__rate_interval])) / max_over_time(bar{tenant="x"}[1h:5m]) or vector(1)`,
+		},
+		{
+			name:     "vector with variable offset",
+			query:    `foo offset $offset`,
+			expected: `foo{tenant="x"} offset $offset`,
+		},
+		{
+			name:     "override existing matcher",
+			query:    `foo{tenant=~"x|y"}`,
+			expected: `foo{tenant="x"}`,
+		},
+		{
+			name:     "strict mode with the same matcher",
+			query:    `foo{tenant="x"} + bar`,
+			mode:     EnforceStrict,
+			expected: `foo{tenant="x"} + bar{tenant="x"}`,
+		},
+		{
+			name:  "strict mode with a conflicting matcher",
+			query: `foo + bar{tenant=~"x|y"}`,
+			mode:  EnforceStrict,
+			err:   `matcher tenant=~"x|y" of bar{tenant=~"x|y"} conflicts with the enforced matcher tenant="x"`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			expr := MustParse(test.query)
+			result, err := EnforceMatchers(expr, test.mode, tenant)
+			if len(test.err) > 0 {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result.String())
+			assert.Equal(t, MustParse(test.query).String(), expr.String())
+		})
+	}
+}
+
+func TestEnforceMatchersCopiesTheMatchers(t *testing.T) {
+	tenant := labels.MustNewMatcher(labels.MatchEqual, "tenant", "x")
+	result, err := EnforceMatchers(MustParse("foo + bar"), EnforceOverride, tenant)
+	require.NoError(t, err)
+	var selectors []*parser.VectorSelector
+	Inspect(result, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			selectors = append(selectors, vs)
+		}
+		return nil
+	})
+	require.Len(t, selectors, 2)
+	matchers := selectors[0].LabelMatchers
+	matchers[len(matchers)-1].Value = "y"
+	assert.Equal(t, `foo{tenant="y"} + bar{tenant="x"}`, result.String())
+	assert.Equal(t, "x", tenant.Value)
+}
@@ -0,0 +1,305 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type EqualOption func(o *equalOptions)
+
+type equalOptions struct {
+	ignoreMatcherOrder     bool
+	ignoreGroupingOrder    bool
+	ignoreCommutativeOrder bool
+}
+
+// IgnoreMatcherOrder makes `foo{a="1",b="2"}` equal to `foo{b="2",a="1"}`.
+func IgnoreMatcherOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreMatcherOrder = true
+	}
+}
+
+// IgnoreGroupingOrder makes "sum by (a, b) (foo)" equal to "sum by (b, a) (foo)".
+// It also applies to the labels of the vector matching keywords like on or group_left.
+func IgnoreGroupingOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreGroupingOrder = true
+	}
+}
+
+// IgnoreCommutativeOrder makes "a + b" equal to "b + a". It applies to the operators +, * and
+// the comparisons == and != with the bool modifier, as long as group_left, group_right and fill are not used.
+func IgnoreCommutativeOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreCommutativeOrder = true
+	}
+}
+
+// Equal returns true if both expressions have the same structure. Parentheses, positions and the way the nodes are
+// built are ignored: a *matrix.Builder is equal to the *parser.MatrixSelector it wraps,
+// and an *AggregationBuilder to the *parser.AggregateExpr returned by the Prometheus parser.
+func Equal(a, b parser.Expr, opts ...EqualOption) bool {
+	o := newEqualOptions(opts)
+	return o.canonical(a) == o.canonical(b)
+}
+
+// Hash returns a hash of the structure of the expression, stable across processes and versions.
+// Two expressions that are Equal with the same options have the same hash.
+func Hash(expr parser.Expr, opts ...EqualOption) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(newEqualOptions(opts).canonical(expr))) //nolint:errcheck
+	return h.Sum64()
+}
+
+func newEqualOptions(opts []EqualOption) *equalOptions {
+	o := &equalOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// canonical returns an encoding of the structure of the expression, made of nested calls like
+// `binary("+",vector("foo"),number(1))`.
+func (o *equalOptions) canonical(expr parser.Expr) string {
+	var b strings.Builder
+	o.encode(&b, expr)
+	return b.String()
+}
+
+func (o *equalOptions) encode(b *strings.Builder, node parser.Node) {
+	switch n := node.(type) {
+	case nil:
+		b.WriteString("nil")
+	case *parser.ParenExpr:
+		o.encode(b, n.Expr)
+	case *parser.StepInvariantExpr:
+		o.encode(b, n.Expr)
+	case *parser.AggregateExpr:
+		o.encodeAggregation(b, n)
+	case *AggregationBuilder:
+		o.encodeAggregation(b, n.internal)
+	case *parser.BinaryExpr:
+		o.encodeBinary(b, n)
+	case *BinaryBuilder:
+		o.encodeBinary(b, n.internal)
+	case *BinaryWithVectorMatching:
+		o.encodeBinary(b, n.binaryOpt.internal)
+	case *parser.Call:
+		fmt.Fprintf(b, "call(%q", n.Func.Name)
+		for _, arg := range n.Args {
+			b.WriteString(",")
+			o.encode(b, arg)
+		}
+		b.WriteString(")")
+	case *parser.MatrixSelector:
+		o.encodeMatrix(b, n, "", "")
+	case *matrix.Builder:
+		o.encodeMatrix(b, n.InternalMatrix, n.RangeAsVariable, n.OffsetAsVariable)
+	case *parser.SubqueryExpr:
+		o.encodeSubquery(b, n, "", "", "")
+	case *subquery.VariableBuilder:
+		o.encodeSubquery(b, n.InternalSubquery, n.RangeAsVariable, n.StepAsVariable, n.OffsetAsVariable)
+	case *parser.VectorSelector:
+		o.encodeVector(b, n, "")
+	case *vector.VariableBuilder:
+		o.encodeVector(b, n.InternalVector, n.OffsetAsVariable)
+	case *parser.UnaryExpr:
+		fmt.Fprintf(b, "unary(%q,", n.Op.String())
+		o.encode(b, n.Expr)
+		b.WriteString(")")
+	case *parser.NumberLiteral:
+		fmt.Fprintf(b, "number(%s)", strconv.FormatFloat(n.Val, 'g', -1, 64))
+	case *parser.StringLiteral:
+		fmt.Fprintf(b, "string(%q)", n.Val)
+	case *variable.Expr:
+		fmt.Fprintf(b, "variable(%q)", n.Reference)
+	default:
+		fmt.Fprintf(b, "unknown(%T,%q)", node, node.String())
+	}
+}
+
+func (o *equalOptions) encodeAggregation(b *strings.Builder, n *parser.AggregateExpr) {
+	modifier := "by"
+	if n.Without {
+		modifier = "without"
+	}
+	fmt.Fprintf(b, "aggregation(%q,%s%s,", n.Op.String(), modifier, o.labelList(n.Grouping))
+	if n.Param != nil {
+		o.encode(b, n.Param)
+		b.WriteString(",")
+	}
+	o.encode(b, n.Expr)
+	b.WriteString(")")
+}
+
+func (o *equalOptions) encodeBinary(b *strings.Builder, n *parser.BinaryExpr) {
+	fmt.Fprintf(b, "binary(%q,", n.Op.String())
+	if n.ReturnBool {
+		b.WriteString("bool,")
+	}
+	vm := n.VectorMatching
+	if vm != nil && hasVectorMatchingKeyword(vm) {
+		modifier := "ignoring"
+		if vm.On {
+			modifier = "on"
+		}
+		fmt.Fprintf(b, "%s%s,", modifier, o.labelList(vm.MatchingLabels))
+		switch vm.Card {
+		case parser.CardManyToOne:
+			fmt.Fprintf(b, "group_left%s,", o.labelList(vm.Include))
+		case parser.CardOneToMany:
+			fmt.Fprintf(b, "group_right%s,", o.labelList(vm.Include))
+		}
+		if vm.FillValues.LHS != nil {
+			fmt.Fprintf(b, "fill_left(%s),", strconv.FormatFloat(*vm.FillValues.LHS, 'g', -1, 64))
+		}
+		if vm.FillValues.RHS != nil {
+			fmt.Fprintf(b, "fill_right(%s),", strconv.FormatFloat(*vm.FillValues.RHS, 'g', -1, 64))
+		}
+	}
+	lhs, rhs := o.canonical(n.LHS), o.canonical(n.RHS)
+	if o.ignoreCommutativeOrder && isCommutative(n) && rhs < lhs {
+		lhs, rhs = rhs, lhs
+	}
+	fmt.Fprintf(b, "%s,%s)", lhs, rhs)
+}
+
+// isCommutative returns true if the operands of the binary expression can be swapped without changing the result.
+func isCommutative(n *parser.BinaryExpr) bool {
+	if vm := n.VectorMatching; vm != nil {
+		if vm.Card == parser.CardManyToOne || vm.Card == parser.CardOneToMany || vm.FillValues.LHS != nil || vm.FillValues.RHS != nil {
+			return false
+		}
+	}
+	switch n.Op {
+	case parser.ADD, parser.MUL:
+		return true
+	case parser.EQLC, parser.NEQ:
+		return n.ReturnBool
+	default:
+		return false
+	}
+}
+
+func (o *equalOptions) encodeMatrix(b *strings.Builder, n *parser.MatrixSelector, rangeAsVariable, offsetAsVariable string) {
+	b.WriteString("matrix(")
+	vs, _ := n.VectorSelector.(*parser.VectorSelector)
+	o.encodeVector(b, vs, offsetAsVariable)
+	fmt.Fprintf(b, ",%s)", durationOrVariable(n.Range, rangeAsVariable))
+}
+
+func (o *equalOptions) encodeSubquery(b *strings.Builder, n *parser.SubqueryExpr, rangeAsVariable, stepAsVariable, offsetAsVariable string) {
+	b.WriteString("subquery(")
+	o.encode(b, n.Expr)
+	fmt.Fprintf(b, ",%s,%s", durationOrVariable(n.Range, rangeAsVariable), durationOrVariable(n.Step, stepAsVariable))
+	encodeTimeModifiers(b, n.OriginalOffset, offsetAsVariable, n.Timestamp, n.StartOrEnd)
+	b.WriteString(")")
+}
+
+func (o *equalOptions) encodeVector(b *strings.Builder, n *parser.VectorSelector, offsetAsVariable string) {
+	if n == nil {
+		b.WriteString("vector(nil)")
+		return
+	}
+	name, labelMatchers := metricNameAndMatchers(n)
+	matchers := make([]string, 0, len(labelMatchers))
+	for _, m := range labelMatchers {
+		matchers = append(matchers, fmt.Sprintf("%q%s%q", m.Name, m.Type, m.Value))
+	}
+	if o.ignoreMatcherOrder {
+		slices.Sort(matchers)
+	}
+	fmt.Fprintf(b, "vector(%q,[%s]", name, strings.Join(matchers, ","))
+	encodeTimeModifiers(b, n.OriginalOffset, offsetAsVariable, n.Timestamp, n.StartOrEnd)
+	b.WriteString(")")
+}
+
+// metricNameAndMatchers returns the metric name of the vector selector and its other label matchers.
+// The parser adds the metric name as a matcher, and {__name__="foo"} is the same as foo.
+func metricNameAndMatchers(n *parser.VectorSelector) (string, []*labels.Matcher) {
+	name := n.Name
+	matchers := make([]*labels.Matcher, 0, len(n.LabelMatchers))
+	for _, m := range n.LabelMatchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual && (len(name) == 0 || m.Value == name) {
+			name = m.Value
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	return name, matchers
+}
+
+func encodeTimeModifiers(b *strings.Builder, offset time.Duration, offsetAsVariable string, timestamp *int64, startOrEnd parser.ItemType) {
+	if offset != 0 || len(offsetAsVariable) > 0 {
+		fmt.Fprintf(b, ",offset(%s)", durationOrVariable(offset, offsetAsVariable))
+	}
+	switch {
+	case timestamp != nil:
+		fmt.Fprintf(b, ",at(%d)", *timestamp)
+	case startOrEnd != 0:
+		fmt.Fprintf(b, ",at(%s)", startOrEnd.String())
+	}
+}
+
+// durationOrVariable returns the canonical form of a duration, the variable name being quoted so that it cannot be
+// mistaken for a duration.
+func durationOrVariable(d time.Duration, variableName string) string {
+	if len(variableName) > 0 {
+		return strconv.Quote(variableName)
+	}
+	return formatDuration(d)
+}
+
+// formatDurationOrVariable returns the variable name if set, or the duration as written in PromQL.
+func formatDurationOrVariable(d time.Duration, variableName string) string {
+	if len(variableName) > 0 {
+		return variableName
+	}
+	return formatDuration(d)
+}
+
+// formatDuration returns the duration as written in PromQL.
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + model.Duration(-d).String()
+	}
+	return model.Duration(d).String()
+}
+
+func (o *equalOptions) labelList(names []string) string {
+	if o.ignoreGroupingOrder {
+		names = slices.Sorted(slices.Values(names))
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
@@ -0,0 +1,130 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEqual(t *testing.T) {
+	testSuite := []struct {
+		name  string
+		a     parser.Expr
+		b     parser.Expr
+		opts  []EqualOption
+		equal bool
+	}{
+		{
+			name: "built and parsed",
+			a: Sum(Rate(matrix.New(
+				vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("job").Equal("a"))),
+				matrix.WithRangeAsVariable("$__rate_interval"),
+			))).By("job"),
+			b:     MustParse(`sum by (job) (rate(foo{job="a"}[$__rate_interval]))`),
+			equal: true,
+		},
+		{
+			name:  "parentheses are ignored",
+			a:     MustParse("((a + b)) * c"),
+			b:     Mul(Add(vector.New(vector.WithMetricName("a")), vector.New(vector.WithMetricName("b"))), vector.New(vector.WithMetricName("c"))),
+			equal: true,
+		},
+		{
+			name:  "metric name as matcher",
+			a:     MustParse(`{__name__="foo",job="a"}`),
+			b:     MustParse(`foo{job="a"}`),
+			equal: true,
+		},
+		{
+			name: "range as variable is not a range",
+			a:    MustParse("rate(foo[$range])"),
+			b:    MustParse("rate(foo[5m])"),
+		},
+		{
+			name: "different offset",
+			a:    MustParse("foo offset 5m"),
+			b:    MustParse("foo offset 1m"),
+		},
+		{
+			name: "matcher order is significant by default",
+			a:    vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("a").Equal("1"), label.New("b").Equal("2"))),
+			b:    vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("b").Equal("2"), label.New("a").Equal("1"))),
+		},
+		{
+			name:  "matcher order ignored",
+			a:     vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("a").Equal("1"), label.New("b").Equal("2"))),
+			b:     vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("b").Equal("2"), label.New("a").Equal("1"))),
+			opts:  []EqualOption{IgnoreMatcherOrder()},
+			equal: true,
+		},
+		{
+			name: "grouping order is significant by default",
+			a:    MustParse("sum by (a, b) (foo)"),
+			b:    MustParse("sum by (b, a) (foo)"),
+		},
+		{
+			name:  "grouping order ignored",
+			a:     MustParse("sum by (a, b) (foo) / on (a, b) group_left (c, d) bar"),
+			b:     MustParse("sum by (b, a) (foo) / on (b, a) group_left (d, c) bar"),
+			opts:  []EqualOption{IgnoreGroupingOrder()},
+			equal: true,
+		},
+		{
+			name: "by is not without",
+			a:    MustParse("sum by (a) (foo)"),
+			b:    MustParse("sum without (a) (foo)"),
+			opts: []EqualOption{IgnoreGroupingOrder()},
+		},
+		{
+			name: "commutative order is significant by default",
+			a:    MustParse("a + b * c"),
+			b:    MustParse("c * b + a"),
+		},
+		{
+			name:  "commutative order ignored",
+			a:     MustParse("a + b * c"),
+			b:     MustParse("c * b + a"),
+			opts:  []EqualOption{IgnoreCommutativeOrder()},
+			equal: true,
+		},
+		{
+			name: "subtraction is not commutative",
+			a:    MustParse("a - b"),
+			b:    MustParse("b - a"),
+			opts: []EqualOption{IgnoreCommutativeOrder()},
+		},
+		{
+			name: "group_left is not commutative",
+			a:    MustParse("a * on (x) group_left () b"),
+			b:    MustParse("b * on (x) group_left () a"),
+			opts: []EqualOption{IgnoreCommutativeOrder()},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.equal, Equal(test.a, test.b, test.opts...))
+			assert.Equal(t, test.equal, Hash(test.a, test.opts...) == Hash(test.b, test.opts...))
+		})
+	}
+}
+
+func TestHashIsStable(t *testing.T) {
+	assert.Equal(t, uint64(0x5a333c81c2eae2e0), Hash(MustParse(`sum by (job) (rate(foo{job="a"}[5m]))`)))
+}
@@ -0,0 +1,206 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evaltest
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/util/almost"
+)
+
+// epsilon is the relative tolerance used to compare the values, like in the promtool unit tests.
+const epsilon = 0.000001
+
+// point is the value of a series at a given step, a float or a histogram.
+type point struct {
+	f float64
+	h *histogram.FloatHistogram
+}
+
+func (p *point) String() string {
+	if p == nil {
+		return "_"
+	}
+	if p.h != nil {
+		return p.h.TestExpression()
+	}
+	return fmt.Sprint(p.f)
+}
+
+func (p *point) equal(other *point) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	if p.h != nil || other.h != nil {
+		return p.h != nil && other.h != nil && p.h.Equals(other.h)
+	}
+	if math.IsNaN(p.f) || math.IsNaN(other.f) {
+		return math.IsNaN(p.f) && math.IsNaN(other.f)
+	}
+	return almost.Equal(p.f, other.f, epsilon)
+}
+
+// result is a set of series indexed by their labels, every series having one point per step.
+type result map[string][]*point
+
+func (r result) String() string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		values := make([]string, len(r[key]))
+		for i, p := range r[key] {
+			values[i] = p.String()
+		}
+		fmt.Fprintf(&b, "%s %s\n", key, strings.Join(values, " "))
+	}
+	return b.String()
+}
+
+func (r result) equal(other result) bool {
+	if len(r) != len(other) {
+		return false
+	}
+	for key, points := range r {
+		otherPoints, ok := other[key]
+		if !ok || len(points) != len(otherPoints) {
+			return false
+		}
+		for i := range points {
+			if !points[i].equal(otherPoints[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseExpected parses one series per line with the series notation of promtool, like `{job="a"} 1 2 _ 4`.
+// A scalar is written with empty labels, like "{} 1".
+func parseExpected(expected string, steps int) (result, error) {
+	r := result{}
+	for i, line := range strings.Split(expected, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		metric, values, err := promqlParser.ParseSeriesDesc(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of the expected result: %w", i+1, err)
+		}
+		if len(values) != steps {
+			return nil, fmt.Errorf("line %d of the expected result: expected %d values, got %d", i+1, steps, len(values))
+		}
+		points := make([]*point, len(values))
+		for j, v := range values {
+			if !v.Omitted {
+				points[j] = &point{f: v.Value, h: v.Histogram}
+			}
+		}
+		r[metric.String()] = points
+	}
+	return r, nil
+}
+
+func instantResult(value parser.Value) (result, error) {
+	switch v := value.(type) {
+	case promql.Vector:
+		r := result{}
+		for _, s := range v {
+			r[s.Metric.String()] = []*point{{f: s.F, h: s.H}}
+		}
+		return r, nil
+	case promql.Scalar:
+		return result{labels.EmptyLabels().String(): {{f: v.V}}}, nil
+	case promql.Matrix:
+		return nil, fmt.Errorf("the expression returns a range vector, use AssertRange to evaluate it at several times")
+	default:
+		return nil, fmt.Errorf("unsupported result type %s", value.Type())
+	}
+}
+
+func rangeResult(m promql.Matrix, start time.Time, step time.Duration, steps int) result {
+	r := result{}
+	index := func(t int64) int {
+		return int((t - start.UnixMilli()) / step.Milliseconds())
+	}
+	for _, s := range m {
+		points := make([]*point, steps)
+		for _, f := range s.Floats {
+			points[index(f.T)] = &point{f: f.F}
+		}
+		for _, h := range s.Histograms {
+			points[index(h.T)] = &point{h: h.H}
+		}
+		r[s.Metric.String()] = points
+	}
+	return r
+}
+
+// AssertInstant evaluates the expression at the given time and checks that it returns the expected samples, written
+// one per line with the series notation of promtool like `{job="a"} 0.5`. The order of the lines does not matter and
+// the values are compared with a relative tolerance.
+func AssertInstant(t testing.TB, s *Storage, expr parser.Expr, ts time.Time, expected string) bool {
+	t.Helper()
+	value, err := s.Instant(expr, ts)
+	if err != nil {
+		t.Errorf("unable to evaluate %s: %s", expr, err)
+		return false
+	}
+	got, err := instantResult(value)
+	if err != nil {
+		t.Errorf("unable to evaluate %s: %s", expr, err)
+		return false
+	}
+	return assertResult(t, expr, expected, 1, got)
+}
+
+// AssertRange evaluates the expression at every step between start and end and checks that it returns the expected
+// series, written one per line with one value per step like `{job="a"} 1 2 _ 4`, "_" meaning no value.
+func AssertRange(t testing.TB, s *Storage, expr parser.Expr, start, end time.Time, step time.Duration, expected string) bool {
+	t.Helper()
+	m, err := s.Range(expr, start, end, step)
+	if err != nil {
+		t.Errorf("unable to evaluate %s: %s", expr, err)
+		return false
+	}
+	steps := int(end.Sub(start)/step) + 1
+	return assertResult(t, expr, expected, steps, rangeResult(m, start, step, steps))
+}
+
+func assertResult(t testing.TB, expr parser.Expr, expected string, steps int, got result) bool {
+	t.Helper()
+	want, err := parseExpected(expected, steps)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+	if !want.equal(got) {
+		t.Errorf("unexpected result for %s\nexpected:\n%s\ngot:\n%s", expr, want, got)
+		return false
+	}
+	return true
+}
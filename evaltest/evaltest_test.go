@@ -0,0 +1,102 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evaltest
+
+import (
+	"testing"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/histogram"
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const requests = `
+load 1m
+  http_requests_total{job="api",code="200"} 0+10x10
+  http_requests_total{job="api",code="500"} 0+2x10
+  http_requests_total{job="web",code="200"} 0+6x10
+`
+
+func TestAssertInstant(t *testing.T) {
+	s := MustLoad(requests)
+	requestRate := promqlbuilder.Sum(promqlbuilder.Rate(matrix.New(
+		vector.New(vector.WithMetricName("http_requests_total")),
+		matrix.WithRangeAsString("5m"),
+	))).By("job")
+	AssertInstant(t, s, requestRate, At(10*time.Minute), `
+		{job="api"} 0.2
+		{job="web"} 0.1
+	`)
+	errorRatio := promqlbuilder.Div(
+		promqlbuilder.Sum(promqlbuilder.Rate(matrix.New(
+			vector.New(vector.WithMetricName("http_requests_total"), vector.WithLabelMatchers(label.New("code").EqualRegexp("5.."))),
+			matrix.WithRangeAsString("5m"),
+		))).By("job"),
+		requestRate,
+	)
+	AssertInstant(t, s, errorRatio, At(10*time.Minute), `{job="api"} 0.16666666`)
+	AssertInstant(t, s, promqlbuilder.Scalar(vector.New(vector.WithMetricName("http_requests_total"), vector.WithLabelMatchers(label.New("code").Equal("500")))), At(time.Minute), `{} 2`)
+}
+
+func TestAssertRange(t *testing.T) {
+	s := MustLoad(`
+load 1m
+  up{job="web"} 1 1 0 _ _ _ _ _ _ 1 1
+`)
+	expr := vector.New(vector.WithMetricName("up"))
+	AssertRange(t, s, expr, At(0), At(10*time.Minute), 2*time.Minute, `
+		up{job="web"} 1 0 0 0 _ 1
+	`)
+	AssertRange(t, s, promqlbuilder.Count(expr), At(0), At(20*time.Minute), 10*time.Minute, `{} 1 1 _`)
+}
+
+func TestNativeHistogram(t *testing.T) {
+	s := MustLoad(`
+load 1m
+  rpc_latency_seconds {{schema:0 sum:0 count:0 buckets:[0 0 0]}}+{{schema:0 sum:6 count:6 buckets:[2 2 2]}}x10
+`)
+	h := histogram.New("rpc_latency_seconds", histogram.WithMode(histogram.ClassicOrNative))
+	AssertInstant(t, s, h.CountRate(), At(10*time.Minute), `{} 0.1`)
+	AssertInstant(t, s, h.Average(), At(10*time.Minute), `{} 1`)
+}
+
+func TestLoadOpenMetrics(t *testing.T) {
+	s := New()
+	require.NoError(t, s.LoadOpenMetrics(`
+# TYPE build_info gauge
+build_info{version="1.0"} 1
+# TYPE queue_length gauge
+queue_length 3 120
+`, At(time.Minute)))
+	AssertInstant(t, s, vector.New(vector.WithMetricName("build_info")), At(time.Minute), `build_info{version="1.0"} 1`)
+	AssertInstant(t, s, vector.New(vector.WithMetricName("queue_length")), At(2*time.Minute), `queue_length 3`)
+}
+
+func TestErrors(t *testing.T) {
+	_, err := Load("load 1m\nfoo 1 2")
+	assert.EqualError(t, err, `line 2: expected a command "load <step>", got "foo 1 2"`)
+
+	s := MustLoad(requests)
+	_, err = s.Instant(promqlbuilder.Rate(matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsVariable("$__rate_interval"))), At(0))
+	assert.EqualError(t, err, "the expression uses the variables $__rate_interval, interpolate them with promqlbuilder.Interpolate before evaluating it")
+
+	mock := &testing.T{}
+	assert.False(t, AssertInstant(mock, s, vector.New(vector.WithMetricName("http_requests_total"), vector.WithLabelMatchers(label.New("code").Equal("500"))), At(time.Minute), `{} 2`))
+	assert.True(t, mock.Failed())
+}
@@ -0,0 +1,337 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package evaltest evaluates expressions with the Prometheus engine against series held in memory, to test what a
+// query returns and not only how it is written.
+//
+// The series are loaded with the "load" command of the promtool unit tests, like
+//
+//	load 1m
+//	  http_requests_total{job="api",code="200"} 0+10x10
+//	  http_requests_total{job="api",code="500"} 0+1x10
+//
+// or from a text in the OpenMetrics format. The samples of a load command start at the Unix epoch, use At to get
+// the time of the evaluation.
+package evaltest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/util/annotations"
+)
+
+var promqlParser = parser.NewParser(parser.Options{
+	EnableExperimentalFunctions: true,
+	EnableBinopFillModifiers:    true,
+})
+
+var engine = promql.NewEngine(promql.EngineOpts{
+	MaxSamples:           50000000,
+	Timeout:              time.Minute,
+	EnableAtModifier:     true,
+	EnableNegativeOffset: true,
+	Parser:               promqlParser,
+})
+
+// At returns the time at the given duration after the first sample of a load command.
+func At(d time.Duration) time.Time {
+	return time.Unix(0, 0).Add(d).UTC()
+}
+
+// Storage holds series in memory. It is not safe for concurrent loading.
+type Storage struct {
+	series map[string]*series
+}
+
+type series struct {
+	labels  labels.Labels
+	samples []chunks.Sample
+}
+
+// New returns an empty storage.
+func New() *Storage {
+	return &Storage{series: map[string]*series{}}
+}
+
+// Load returns a storage holding the series of the given load commands.
+func Load(input string) (*Storage, error) {
+	s := New()
+	if err := s.Load(input); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MustLoad is like Load but panics when the input is not valid.
+func MustLoad(input string) *Storage {
+	s, err := Load(input)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Load adds the series of the given load commands. Every command starts with a line "load <step>" followed by one
+// indented line per series, with the series notation of promtool like "foo{job="a"} 1+1x10 _ stale".
+// The empty lines and the lines starting with "#" are ignored.
+func (s *Storage) Load(input string) error {
+	var step time.Duration
+	for i, line := range strings.Split(input, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == line {
+			fields := strings.Fields(line)
+			if len(fields) != 2 || fields[0] != "load" {
+				return fmt.Errorf("line %d: expected a command \"load <step>\", got %q", i+1, line)
+			}
+			d, err := model.ParseDuration(fields[1])
+			if err != nil {
+				return fmt.Errorf("line %d: invalid step: %w", i+1, err)
+			}
+			step = time.Duration(d)
+			continue
+		}
+		if step == 0 {
+			return fmt.Errorf("line %d: series defined outside of a load command", i+1)
+		}
+		metric, values, err := promqlParser.ParseSeriesDesc(trimmed)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		for j, v := range values {
+			if v.Omitted {
+				continue
+			}
+			s.add(metric, sample{t: At(time.Duration(j) * step).UnixMilli(), f: v.Value, fh: v.Histogram})
+		}
+	}
+	return nil
+}
+
+// LoadOpenMetrics adds the samples of a text in the OpenMetrics format. The samples without timestamp are added at
+// the given time. The final "# EOF" can be omitted.
+func (s *Storage) LoadOpenMetrics(input string, defaultTime time.Time) error {
+	input = strings.TrimSpace(input) + "\n"
+	if !strings.HasSuffix(input, "# EOF\n") {
+		input += "# EOF\n"
+	}
+	p := textparse.NewOpenMetricsParser([]byte(input), labels.NewSymbolTable())
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+		_, ts, v := p.Series()
+		t := defaultTime.UnixMilli()
+		if ts != nil {
+			t = *ts
+		}
+		var metric labels.Labels
+		p.Labels(&metric)
+		s.add(metric, sample{t: t, f: v})
+	}
+}
+
+func (s *Storage) add(metric labels.Labels, smpl sample) {
+	key := metric.String()
+	ser, ok := s.series[key]
+	if !ok {
+		ser = &series{labels: metric}
+		s.series[key] = ser
+	}
+	i, _ := slices.BinarySearchFunc(ser.samples, smpl.t, func(existing chunks.Sample, t int64) int {
+		return cmp.Compare(existing.T(), t)
+	})
+	if i < len(ser.samples) && ser.samples[i].T() == smpl.t {
+		ser.samples[i] = smpl
+		return
+	}
+	ser.samples = slices.Insert(ser.samples, i, chunks.Sample(smpl))
+}
+
+// Querier implements storage.Queryable so that the storage can be used with any Prometheus engine.
+func (s *Storage) Querier(_, _ int64) (storage.Querier, error) {
+	return &storage.MockQuerier{SelectMockFunction: s.selectSeries}, nil
+}
+
+func (s *Storage) selectSeries(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	var result []storage.Series
+	for _, ser := range s.series {
+		if matchAll(ser.labels, matchers) {
+			result = append(result, storage.NewListSeries(ser.labels, ser.samples))
+		}
+	}
+	slices.SortFunc(result, func(a, b storage.Series) int {
+		return labels.Compare(a.Labels(), b.Labels())
+	})
+	return &seriesSet{series: result, idx: -1}
+}
+
+func matchAll(metric labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(metric.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+type queryOptions struct {
+	lookbackDelta time.Duration
+}
+
+type QueryOption func(o *queryOptions)
+
+// WithLookbackDelta sets how far back a sample is searched for an instant vector selector, 5m by default.
+func WithLookbackDelta(d time.Duration) QueryOption {
+	return func(o *queryOptions) {
+		o.lookbackDelta = d
+	}
+}
+
+func newQueryOpts(options []QueryOption) promql.QueryOpts {
+	o := &queryOptions{}
+	for _, opt := range options {
+		opt(o)
+	}
+	return promql.NewPrometheusQueryOpts(false, o.lookbackDelta)
+}
+
+// Instant evaluates the expression at the given time. Dashboard variables must be interpolated first.
+func (s *Storage) Instant(expr parser.Expr, ts time.Time, options ...QueryOption) (parser.Value, error) {
+	query, err := queryString(expr)
+	if err != nil {
+		return nil, err
+	}
+	q, err := engine.NewInstantQuery(context.Background(), s, newQueryOpts(options), query, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	result := q.Exec(context.Background())
+	return result.Value, result.Err
+}
+
+// Range evaluates the expression at every step between start and end. Dashboard variables must be interpolated first.
+func (s *Storage) Range(expr parser.Expr, start, end time.Time, step time.Duration, options ...QueryOption) (promql.Matrix, error) {
+	query, err := queryString(expr)
+	if err != nil {
+		return nil, err
+	}
+	q, err := engine.NewRangeQuery(context.Background(), s, newQueryOpts(options), query, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	result := q.Exec(context.Background())
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return result.Matrix()
+}
+
+func queryString(expr parser.Expr) (string, error) {
+	if vars := promqlbuilder.Variables(expr); len(vars) > 0 {
+		return "", fmt.Errorf("the expression uses the variables $%s, interpolate them with promqlbuilder.Interpolate before evaluating it", strings.Join(vars, ", $"))
+	}
+	return expr.String(), nil
+}
+
+type seriesSet struct {
+	series []storage.Series
+	idx    int
+}
+
+func (s *seriesSet) Next() bool {
+	s.idx++
+	return s.idx < len(s.series)
+}
+
+func (s *seriesSet) At() storage.Series {
+	return s.series[s.idx]
+}
+
+func (*seriesSet) Err() error {
+	return nil
+}
+
+func (*seriesSet) Warnings() annotations.Annotations {
+	return nil
+}
+
+// sample implements chunks.Sample for a float or a float histogram.
+type sample struct {
+	t  int64
+	f  float64
+	fh *histogram.FloatHistogram
+}
+
+func (s sample) T() int64 {
+	return s.t
+}
+
+func (sample) ST() int64 {
+	return 0
+}
+
+func (s sample) F() float64 {
+	return s.f
+}
+
+func (sample) H() *histogram.Histogram {
+	return nil
+}
+
+func (s sample) FH() *histogram.FloatHistogram {
+	return s.fh
+}
+
+func (s sample) Type() chunkenc.ValueType {
+	if s.fh != nil {
+		return chunkenc.ValFloatHistogram
+	}
+	return chunkenc.ValFloat
+}
+
+func (s sample) Copy() chunks.Sample {
+	c := s
+	if s.fh != nil {
+		c.fh = s.fh.Copy()
+	}
+	return c
+}
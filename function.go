@@ -11,35 +11,11 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package promqlbuilder
-
-import (
-	"github.com/perses/promql-builder/matrix"
-	"github.com/prometheus/prometheus/promql/parser"
-)
-
-func NewFunction(name string, args ...parser.Expr) *parser.Call {
-	fn, ok := parser.Functions[name]
-	if !ok {
-		fn = &parser.Function{Name: name}
-	}
-	return &parser.Call{
-		Func: fn,
-		Args: args,
-	}
-}
+// Code generated by scripts/generate-functions. DO NOT EDIT.
 
-func NewNumber(num float64) *parser.NumberLiteral {
-	return &parser.NumberLiteral{
-		Val: num,
-	}
-}
+package promqlbuilder
 
-func NewString(s string) *parser.StringLiteral {
-	return &parser.StringLiteral{
-		Val: s,
-	}
-}
+import "github.com/prometheus/prometheus/promql/parser"
 
 func Abs(vector parser.Expr) *parser.Call {
 	return NewFunction("abs", vector)
@@ -49,21 +25,6 @@ func Absent(vector parser.Expr) *parser.Call {
 	return NewFunction("absent", vector)
 }
 
-type RangeVectorBuilder interface {
-	*matrix.Builder | *parser.SubqueryExpr
-}
-
-func convertToExpr[T RangeVectorBuilder](input T) parser.Expr {
-	switch v := any(input).(type) {
-	case *matrix.Builder:
-		return v
-	case *parser.SubqueryExpr:
-		return v
-	default:
-		panic("unsupported type")
-	}
-}
-
 func AbsentOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("absent_over_time", convertToExpr(input))
 }
@@ -128,20 +89,20 @@ func CountOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("count_over_time", convertToExpr(input))
 }
 
-func DaysInMonth(vector parser.Expr) *parser.Call {
-	return NewFunction("days_in_month", vector)
+func DayOfMonth(vector parser.Expr) *parser.Call {
+	return NewFunction("day_of_month", vector)
 }
 
-func DaysOfMonth(vector parser.Expr) *parser.Call {
-	return NewFunction("days_of_month", vector)
+func DayOfWeek(vector parser.Expr) *parser.Call {
+	return NewFunction("day_of_week", vector)
 }
 
-func DaysOfWeek(vector parser.Expr) *parser.Call {
-	return NewFunction("days_of_week", vector)
+func DayOfYear(vector parser.Expr) *parser.Call {
+	return NewFunction("day_of_year", vector)
 }
 
-func DaysOfYear(vector parser.Expr) *parser.Call {
-	return NewFunction("days_of_year", vector)
+func DaysInMonth(vector parser.Expr) *parser.Call {
+	return NewFunction("days_in_month", vector)
 }
 
 func Deg(vector parser.Expr) *parser.Call {
@@ -156,10 +117,23 @@ func Deriv[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("deriv", convertToExpr(input))
 }
 
+func DoubleExponentialSmoothing[T RangeVectorBuilder](input T, smoothingFactor float64, trendFactor float64) *parser.Call {
+	return NewFunction("double_exponential_smoothing", convertToExpr(input), NewNumber(smoothingFactor), NewNumber(trendFactor))
+}
+
+// End returns the end time of the range query, or the evaluation time of an instant query.
+func End() *parser.Call {
+	return NewFunction("end")
+}
+
 func Exp(vector parser.Expr) *parser.Call {
 	return NewFunction("exp", vector)
 }
 
+func FirstOverTime[T RangeVectorBuilder](input T) *parser.Call {
+	return NewFunction("first_over_time", convertToExpr(input))
+}
+
 func Floor(vector parser.Expr) *parser.Call {
 	return NewFunction("floor", vector)
 }
@@ -172,18 +146,6 @@ func HistogramCount(vector parser.Expr) *parser.Call {
 	return NewFunction("histogram_count", vector)
 }
 
-func HistogramSum(vector parser.Expr) *parser.Call {
-	return NewFunction("histogram_sum", vector)
-}
-
-func HistogramStddev(vector parser.Expr) *parser.Call {
-	return NewFunction("histogram_stddev", vector)
-}
-
-func HistogramStdvar(vector parser.Expr) *parser.Call {
-	return NewFunction("histogram_stdvar", vector)
-}
-
 func HistogramFraction(lower float64, upper float64, vector parser.Expr) *parser.Call {
 	return NewFunction("histogram_fraction", NewNumber(lower), NewNumber(upper), vector)
 }
@@ -194,14 +156,22 @@ func HistogramQuantile(quantile float64, vector parser.Expr) *parser.Call {
 
 func HistogramQuantiles(vector parser.Expr, labelName string, quantiles ...float64) *parser.Call {
 	args := []parser.Expr{vector, NewString(labelName)}
-	for _, q := range quantiles {
-		args = append(args, NewNumber(q))
+	for _, arg := range quantiles {
+		args = append(args, NewNumber(arg))
 	}
 	return NewFunction("histogram_quantiles", args...)
 }
 
-func DoubleExponentialSmoothing[T RangeVectorBuilder](input T, smoothingFactor float64, trendFactor float64) *parser.Call {
-	return NewFunction("double_exponential_smoothing", convertToExpr(input), NewNumber(smoothingFactor), NewNumber(trendFactor))
+func HistogramStddev(vector parser.Expr) *parser.Call {
+	return NewFunction("histogram_stddev", vector)
+}
+
+func HistogramStdvar(vector parser.Expr) *parser.Call {
+	return NewFunction("histogram_stdvar", vector)
+}
+
+func HistogramSum(vector parser.Expr) *parser.Call {
+	return NewFunction("histogram_sum", vector)
 }
 
 func Hour(vector parser.Expr) *parser.Call {
@@ -224,18 +194,18 @@ func IRate[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("irate", convertToExpr(input))
 }
 
-func LabelReplace(vector parser.Expr, destinationLabel string, replacement string, sourceLabel string, regexp string) *parser.Call {
-	return NewFunction("label_replace", vector, NewString(destinationLabel), NewString(replacement), NewString(sourceLabel), NewString(regexp))
-}
-
 func LabelJoin(vector parser.Expr, destinationLabel string, replacement string, srcLabels ...string) *parser.Call {
 	args := []parser.Expr{vector, NewString(destinationLabel), NewString(replacement)}
-	for _, label := range srcLabels {
-		args = append(args, NewString(label))
+	for _, arg := range srcLabels {
+		args = append(args, NewString(arg))
 	}
 	return NewFunction("label_join", args...)
 }
 
+func LabelReplace(vector parser.Expr, destinationLabel string, replacement string, sourceLabel string, regexp string) *parser.Call {
+	return NewFunction("label_replace", vector, NewString(destinationLabel), NewString(replacement), NewString(sourceLabel), NewString(regexp))
+}
+
 func LastOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("last_over_time", convertToExpr(input))
 }
@@ -292,6 +262,11 @@ func Rad(vector parser.Expr) *parser.Call {
 	return NewFunction("rad", vector)
 }
 
+// Range returns the duration of the range query in seconds, or 0 for an instant query.
+func Range() *parser.Call {
+	return NewFunction("range")
+}
+
 func Rate[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("rate", convertToExpr(input))
 }
@@ -324,30 +299,35 @@ func Sort(vector parser.Expr) *parser.Call {
 	return NewFunction("sort", vector)
 }
 
-func SortDesc(vector parser.Expr) *parser.Call {
-	return NewFunction("sort_desc", vector)
-}
-
 func SortByLabel(vector parser.Expr, labels ...string) *parser.Call {
 	args := []parser.Expr{vector}
-	for _, label := range labels {
-		args = append(args, NewString(label))
+	for _, arg := range labels {
+		args = append(args, NewString(arg))
 	}
 	return NewFunction("sort_by_label", args...)
 }
 
 func SortByLabelDesc(vector parser.Expr, labels ...string) *parser.Call {
 	args := []parser.Expr{vector}
-	for _, label := range labels {
-		args = append(args, NewString(label))
+	for _, arg := range labels {
+		args = append(args, NewString(arg))
 	}
 	return NewFunction("sort_by_label_desc", args...)
 }
 
+func SortDesc(vector parser.Expr) *parser.Call {
+	return NewFunction("sort_desc", vector)
+}
+
 func Sqrt(vector parser.Expr) *parser.Call {
 	return NewFunction("sqrt", vector)
 }
 
+// Start returns the start time of the range query, or the evaluation time of an instant query.
+func Start() *parser.Call {
+	return NewFunction("start")
+}
+
 func StddevOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("stddev_over_time", convertToExpr(input))
 }
@@ -356,6 +336,11 @@ func StdvarOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("stdvar_over_time", convertToExpr(input))
 }
 
+// Step returns the step of the range query in seconds, or 0 for an instant query.
+func Step() *parser.Call {
+	return NewFunction("step")
+}
+
 func SumOverTime[T RangeVectorBuilder](input T) *parser.Call {
 	return NewFunction("sum_over_time", convertToExpr(input))
 }
@@ -376,6 +361,22 @@ func Timestamp(vector parser.Expr) *parser.Call {
 	return NewFunction("timestamp", vector)
 }
 
+func TsOfFirstOverTime[T RangeVectorBuilder](input T) *parser.Call {
+	return NewFunction("ts_of_first_over_time", convertToExpr(input))
+}
+
+func TsOfLastOverTime[T RangeVectorBuilder](input T) *parser.Call {
+	return NewFunction("ts_of_last_over_time", convertToExpr(input))
+}
+
+func TsOfMaxOverTime[T RangeVectorBuilder](input T) *parser.Call {
+	return NewFunction("ts_of_max_over_time", convertToExpr(input))
+}
+
+func TsOfMinOverTime[T RangeVectorBuilder](input T) *parser.Call {
+	return NewFunction("ts_of_min_over_time", convertToExpr(input))
+}
+
 func Vector(scalar float64) *parser.Call {
 	return NewFunction("vector", NewNumber(scalar))
 }
@@ -0,0 +1,89 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// The helpers of the PromQL functions in function.go are generated from parser.Functions.
+//go:generate go run ./scripts/generate-functions
+
+func NewFunction(name string, args ...parser.Expr) *parser.Call {
+	fn, ok := parser.Functions[name]
+	if !ok {
+		fn = &parser.Function{Name: name}
+	}
+	return &parser.Call{
+		Func: fn,
+		Args: args,
+	}
+}
+
+func NewNumber(num float64) *parser.NumberLiteral {
+	return &parser.NumberLiteral{
+		Val: num,
+	}
+}
+
+func NewString(s string) *parser.StringLiteral {
+	return &parser.StringLiteral{
+		Val: s,
+	}
+}
+
+type RangeVectorBuilder interface {
+	*matrix.Builder | *parser.SubqueryExpr | *subquery.VariableBuilder
+}
+
+func convertToExpr[T RangeVectorBuilder](input T) parser.Expr {
+	switch v := any(input).(type) {
+	case *matrix.Builder:
+		return v
+	case *parser.SubqueryExpr:
+		return v
+	case *subquery.VariableBuilder:
+		return v
+	default:
+		panic("unsupported type")
+	}
+}
+
+// Deprecated: use DayOfMonth instead.
+func DaysOfMonth(vector parser.Expr) *parser.Call {
+	return DayOfMonth(vector)
+}
+
+// Deprecated: use DayOfWeek instead.
+func DaysOfWeek(vector parser.Expr) *parser.Call {
+	return DayOfWeek(vector)
+}
+
+// Deprecated: use DayOfYear instead.
+func DaysOfYear(vector parser.Expr) *parser.Call {
+	return DayOfYear(vector)
+}
+
+// HistogramQuantileAsVariable is like HistogramQuantile but the quantile is a dashboard variable like "$quantile".
+func HistogramQuantileAsVariable(quantile string, vector parser.Expr) *parser.Call {
+	return NewFunction("histogram_quantile", variable.New(quantile), vector)
+}
+
+// QuantileOverTimeAsVariable is like QuantileOverTime but the quantile is a dashboard variable like "$quantile".
+func QuantileOverTimeAsVariable[T RangeVectorBuilder](quantile string, input T) *parser.Call {
+	return NewFunction("quantile_over_time", variable.New(quantile), convertToExpr(input))
+}
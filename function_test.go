@@ -0,0 +1,112 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"go/ast"
+	goparser "go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// functionHelpers returns, for every PromQL function name used in function.go, the declaration of the helper
+// building it.
+func functionHelpers(t *testing.T) map[string]*ast.FuncDecl {
+	file, err := goparser.ParseFile(token.NewFileSet(), "function.go", nil, 0)
+	require.NoError(t, err)
+	helpers := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || fn.Name.Name == "NewFunction" {
+			continue
+		}
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			if ident, ok := call.Fun.(*ast.Ident); !ok || ident.Name != "NewFunction" {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			name, err := strconv.Unquote(lit.Value)
+			require.NoError(t, err)
+			if _, exists := helpers[name]; !exists {
+				helpers[name] = fn
+			}
+			return false
+		})
+	}
+	return helpers
+}
+
+func TestFunctionHelpersCoverParserFunctions(t *testing.T) {
+	helpers := functionHelpers(t)
+	for name, fn := range parser.Functions {
+		helper, ok := helpers[name]
+		if !assert.Truef(t, ok, "PromQL function %q has no helper in function.go", name) {
+			continue
+		}
+		takesRangeVector := false
+		for _, argType := range fn.ArgTypes {
+			takesRangeVector = takesRangeVector || argType == parser.ValueTypeMatrix
+		}
+		isGeneric := false
+		if helper.Type.TypeParams != nil {
+			for _, param := range helper.Type.TypeParams.List {
+				if ident, ok := param.Type.(*ast.Ident); ok && ident.Name == "RangeVectorBuilder" {
+					isGeneric = true
+				}
+			}
+		}
+		assert.Equalf(t, takesRangeVector, isGeneric, "helper %s of PromQL function %q must accept a RangeVectorBuilder only if the function takes a range vector", helper.Name.Name, name)
+	}
+	for name, helper := range helpers {
+		_, ok := parser.Functions[name]
+		assert.Truef(t, ok, "helper %s is using the unknown PromQL function %q", helper.Name.Name, name)
+	}
+}
+
+func TestFunctionHelpers(t *testing.T) {
+	foo := vector.New(vector.WithMetricName("foo"))
+	rangeFoo := matrix.New(foo, matrix.WithRangeAsString("5m"))
+	testSuite := []struct {
+		expected string
+		expr     parser.Expr
+	}{
+		{expected: "day_of_month(foo)", expr: DayOfMonth(foo)},
+		{expected: "day_of_week(foo)", expr: DaysOfWeek(foo)},
+		{expected: "day_of_year(foo)", expr: DayOfYear(foo)},
+		{expected: "first_over_time(foo[5m])", expr: FirstOverTime(rangeFoo)},
+		{expected: "ts_of_max_over_time(foo[5m])", expr: TsOfMaxOverTime(rangeFoo)},
+		{expected: "time() - start()", expr: Sub(Time(), Start())},
+		{expected: "end() - range() + step()", expr: Add(Sub(End(), Range()), Step())},
+	}
+	for _, test := range testSuite {
+		t.Run(test.expected, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+			assert.NoError(t, Validate(test.expr))
+		})
+	}
+}
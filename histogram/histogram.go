@@ -0,0 +1,212 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package histogram builds the usual queries on a Prometheus histogram, for both its classic and its native
+// representation.
+//
+// A classic histogram named "foo" is made of the series foo_bucket, with one series per bucket identified by the
+// label "le", foo_count and foo_sum. A native histogram is a single series named "foo" holding all the buckets.
+package histogram
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Mode is the representation of the histogram the queries are built for.
+type Mode int
+
+const (
+	// Classic queries the series _bucket, _count and _sum.
+	Classic Mode = iota
+	// Native queries the native histogram series.
+	Native
+	// ClassicOrNative queries the native histogram when it exists and falls back on the classic one otherwise.
+	// It is useful while migrating from classic to native histograms, when both can be exposed.
+	ClassicOrNative
+)
+
+// Builder builds the queries on a histogram. Every query is aggregated with a sum by the grouping labels.
+type Builder struct {
+	metric   string
+	mode     Mode
+	matchers []*labels.Matcher
+	grouping []string
+	rangeOpt matrix.Option
+}
+
+type Option func(b *Builder)
+
+// New returns a builder for the histogram with the given base metric name, without the suffix _bucket.
+// By default, the histogram is classic, the queries are not grouped by any label and the rates are computed over 5m.
+func New(metric string, options ...Option) *Builder {
+	b := &Builder{
+		metric:   metric,
+		rangeOpt: matrix.WithRange(5 * time.Minute),
+	}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+func WithMode(mode Mode) Option {
+	return func(b *Builder) {
+		b.mode = mode
+	}
+}
+
+// WithLabelMatchers filters the series of the histogram. The label "le" is handled by the builder and must not be used.
+func WithLabelMatchers(matchers ...*labels.Matcher) Option {
+	return func(b *Builder) {
+		b.matchers = matchers
+	}
+}
+
+// WithGrouping sets the labels kept by the queries. The label "le" is added when needed for the classic histograms.
+func WithGrouping(labels ...string) Option {
+	return func(b *Builder) {
+		b.grouping = labels
+	}
+}
+
+// WithRange sets the range over which the rates are computed.
+func WithRange(d time.Duration) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRange(d)
+	}
+}
+
+// WithRangeAsString sets the range over which the rates are computed as a string like "5m".
+func WithRangeAsString(d string) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRangeAsString(d)
+	}
+}
+
+// WithRangeAsVariable sets the range over which the rates are computed as a variable like "$__rate_interval".
+func WithRangeAsVariable(name string) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRangeAsVariable(name)
+	}
+}
+
+// Quantile returns the estimated quantile, between 0 and 1, of the observations.
+func (b *Builder) Quantile(quantile float64) parser.Expr {
+	return b.build(
+		func() parser.Expr {
+			return promqlbuilder.HistogramQuantile(quantile, b.bucketsRate())
+		},
+		func() parser.Expr {
+			return promqlbuilder.HistogramQuantile(quantile, b.nativeRate())
+		},
+	)
+}
+
+// QuantileAsVariable is like Quantile but the quantile is a dashboard variable like "$quantile".
+func (b *Builder) QuantileAsVariable(quantile string) parser.Expr {
+	return b.build(
+		func() parser.Expr {
+			return promqlbuilder.HistogramQuantileAsVariable(quantile, b.bucketsRate())
+		},
+		func() parser.Expr {
+			return promqlbuilder.HistogramQuantileAsVariable(quantile, b.nativeRate())
+		},
+	)
+}
+
+// FractionBelow returns the fraction, between 0 and 1, of the observations lower than or equal to the threshold.
+// For a classic histogram, the threshold must be the upper bound of one of the buckets.
+func (b *Builder) FractionBelow(threshold float64) parser.Expr {
+	return b.build(
+		func() parser.Expr {
+			bucket := labels.MustNewMatcher(labels.MatchEqual, labels.BucketLabel, labels.FormatOpenMetricsFloat(threshold))
+			return promqlbuilder.Div(b.sumRate("_bucket", bucket), b.sumRate("_count"))
+		},
+		func() parser.Expr {
+			return promqlbuilder.HistogramFraction(math.Inf(-1), threshold, b.nativeRate())
+		},
+	)
+}
+
+// Average returns the average value of the observations.
+func (b *Builder) Average() parser.Expr {
+	return b.build(
+		func() parser.Expr {
+			return promqlbuilder.Div(b.sumRate("_sum"), b.sumRate("_count"))
+		},
+		func() parser.Expr {
+			return promqlbuilder.HistogramAvg(b.nativeRate())
+		},
+	)
+}
+
+// CountRate returns the number of observations per second.
+func (b *Builder) CountRate() parser.Expr {
+	return b.build(
+		func() parser.Expr {
+			return b.sumRate("_count")
+		},
+		func() parser.Expr {
+			return promqlbuilder.HistogramCount(b.nativeRate())
+		},
+	)
+}
+
+// Heatmap returns the rate of the observations in every bucket, to be displayed in a heatmap panel.
+// With ClassicOrNative, the classic series have the label "le" so both representations are returned when they exist.
+func (b *Builder) Heatmap() parser.Expr {
+	return b.build(b.bucketsRate, b.nativeRate)
+}
+
+// build returns the classic or the native query depending on the mode. With ClassicOrNative, the native query comes
+// first so that it is preferred when both representations exist.
+func (b *Builder) build(classic, native func() parser.Expr) parser.Expr {
+	switch b.mode {
+	case Native:
+		return native()
+	case ClassicOrNative:
+		return promqlbuilder.Or(native(), classic())
+	default:
+		return classic()
+	}
+}
+
+// bucketsRate returns the rate of every bucket of the classic histogram, keeping the label "le".
+func (b *Builder) bucketsRate() parser.Expr {
+	return promqlbuilder.Sum(b.rate("_bucket")).By(append([]string{labels.BucketLabel}, b.grouping...)...)
+}
+
+// nativeRate returns the rate of the native histogram.
+func (b *Builder) nativeRate() parser.Expr {
+	return b.sumRate("")
+}
+
+func (b *Builder) sumRate(suffix string, extraMatchers ...*labels.Matcher) parser.Expr {
+	return promqlbuilder.Sum(b.rate(suffix, extraMatchers...)).By(b.grouping...)
+}
+
+func (b *Builder) rate(suffix string, extraMatchers ...*labels.Matcher) parser.Expr {
+	matchers := append(slices.Clone(b.matchers), extraMatchers...)
+	return promqlbuilder.Rate(matrix.New(
+		vector.New(vector.WithMetricName(b.metric+suffix), vector.WithLabelMatchers(matchers...)),
+		b.rangeOpt,
+	))
+}
@@ -0,0 +1,94 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package histogram
+
+import (
+	"testing"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/label"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	classic := New("http_request_duration_seconds",
+		WithLabelMatchers(label.New("job").Equal("api")),
+		WithGrouping("handler"),
+	)
+	native := New("http_request_duration_seconds",
+		WithMode(Native),
+		WithLabelMatchers(label.New("job").Equal("api")),
+		WithGrouping("handler"),
+		WithRangeAsVariable("$__rate_interval"),
+	)
+	both := New("rpc_latency_seconds", WithMode(ClassicOrNative), WithRangeAsString("1m"))
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		expected string
+	}{
+		{
+			name:     "classic quantile",
+			expr:     classic.Quantile(0.99),
+			expected: `histogram_quantile(0.99, sum by (le, handler) (rate(http_request_duration_seconds_bucket{job="api"}[5m])))`,
+		},
+		{
+			name:     "native quantile",
+			expr:     native.QuantileAsVariable("$quantile"),
+			expected: `histogram_quantile($quantile, sum by (handler) (rate(http_request_duration_seconds{job="api"}[$__rate_interval])))`,
+		},
+		{
+			name:     "classic or native quantile",
+			expr:     both.Quantile(0.5),
+			expected: `histogram_quantile(0.5, sum(rate(rpc_latency_seconds[1m]))) or histogram_quantile(0.5, sum by (le) (rate(rpc_latency_seconds_bucket[1m])))`,
+		},
+		{
+			name:     "classic fraction",
+			expr:     classic.FractionBelow(1),
+			expected: `sum by (handler) (rate(http_request_duration_seconds_bucket{job="api",le="1.0"}[5m])) / sum by (handler) (rate(http_request_duration_seconds_count{job="api"}[5m]))`,
+		},
+		{
+			name:     "native fraction",
+			expr:     native.FractionBelow(0.25),
+			expected: `histogram_fraction(-Inf, 0.25, sum by (handler) (rate(http_request_duration_seconds{job="api"}[$__rate_interval])))`,
+		},
+		{
+			name:     "classic average",
+			expr:     classic.Average(),
+			expected: `sum by (handler) (rate(http_request_duration_seconds_sum{job="api"}[5m])) / sum by (handler) (rate(http_request_duration_seconds_count{job="api"}[5m]))`,
+		},
+		{
+			name:     "classic or native average",
+			expr:     both.Average(),
+			expected: `histogram_avg(sum(rate(rpc_latency_seconds[1m]))) or sum(rate(rpc_latency_seconds_sum[1m])) / sum(rate(rpc_latency_seconds_count[1m]))`,
+		},
+		{
+			name:     "native count rate",
+			expr:     native.CountRate(),
+			expected: `histogram_count(sum by (handler) (rate(http_request_duration_seconds{job="api"}[$__rate_interval])))`,
+		},
+		{
+			name:     "classic heatmap",
+			expr:     classic.Heatmap(),
+			expected: `sum by (le, handler) (rate(http_request_duration_seconds_bucket{job="api"}[5m]))`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+			assert.NoError(t, promqlbuilder.Validate(test.expr))
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// VariableValue is the value of a dashboard variable, used by Interpolate.
+type VariableValue struct {
+	// Values are the selected values. A single value variable has exactly one value.
+	Values []string
+	// All is true when the "All" option of the variable is selected.
+	All bool
+	// AllValue is the custom value to use when All is selected, like ".*".
+	// It is used as is, whatever the format requested. When empty, all the Values are used.
+	AllValue string
+}
+
+// SingleValue returns the value of a variable with one selected value.
+func SingleValue(value string) VariableValue {
+	return VariableValue{Values: []string{value}}
+}
+
+// MultiValue returns the value of a variable with several selected values.
+func MultiValue(values ...string) VariableValue {
+	return VariableValue{Values: values}
+}
+
+// AllValue returns the value of a variable with the "All" option selected.
+// When customAllValue is empty, all the given values are used.
+func AllValue(customAllValue string, values ...string) VariableValue {
+	return VariableValue{Values: values, All: true, AllValue: customAllValue}
+}
+
+// Interpolate replaces every dashboard variable of the expression by its value and returns the expression
+// as parsed by the Prometheus parser, so it can be sent to Prometheus as is.
+// The keys of vars are the variable names, without "$" nor braces.
+//
+// The variables used as range, step, offset or number must have exactly one value.
+// The variables used in label matchers and string literals are formatted according to the format given in the
+// reference, like "${namespace:regex}". The supported formats are:
+//   - regex: the values are escaped and joined as "(a|b)",
+//   - pipe: the values are joined as "a|b",
+//   - csv and raw: the values are joined as "a,b",
+//   - glob: the values are joined as "{a,b}",
+//   - json: the values are formatted as a JSON array,
+//   - singlequote and doublequote: the values are quoted and joined as "'a','b'".
+//
+// Without format, a single value is used as is and multiple values are formatted as regex.
+func Interpolate(expr parser.Expr, vars map[string]VariableValue) (parser.Expr, error) {
+	result, err := rewrite(DeepCopyExpr(expr), func(node parser.Expr) (parser.Expr, error) {
+		return interpolateNode(node, vars)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promqlParser.ParseExpr(result.String())
+}
+
+func interpolateNode(node parser.Expr, vars map[string]VariableValue) (parser.Expr, error) {
+	switch n := node.(type) {
+	case *matrix.Builder:
+		vs := n.InternalMatrix.VectorSelector.(*parser.VectorSelector)
+		if err := interpolateDuration(n.RangeAsVariable, vars, &n.InternalMatrix.Range); err != nil {
+			return nil, err
+		}
+		if err := interpolateDuration(n.OffsetAsVariable, vars, &vs.OriginalOffset); err != nil {
+			return nil, err
+		}
+		n.RangeAsVariable, n.OffsetAsVariable = "", ""
+		return n, nil
+	case *vector.VariableBuilder:
+		if err := interpolateDuration(n.OffsetAsVariable, vars, &n.InternalVector.OriginalOffset); err != nil {
+			return nil, err
+		}
+		return n.InternalVector, nil
+	case *subquery.VariableBuilder:
+		s := n.InternalSubquery
+		if err := interpolateDuration(n.RangeAsVariable, vars, &s.Range); err != nil {
+			return nil, err
+		}
+		if err := interpolateDuration(n.StepAsVariable, vars, &s.Step); err != nil {
+			return nil, err
+		}
+		if err := interpolateDuration(n.OffsetAsVariable, vars, &s.OriginalOffset); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case *variable.Expr:
+		value, err := singleValue(n.Reference, vars)
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value %q of variable %q is not a number", value, n.Reference)
+		}
+		return NewNumber(f), nil
+	case *parser.VectorSelector:
+		for _, m := range n.LabelMatchers {
+			value, err := interpolateString(m.Value, vars)
+			if err != nil {
+				return nil, err
+			}
+			m.Value = value
+		}
+		return n, nil
+	case *parser.StringLiteral:
+		value, err := interpolateString(n.Val, vars)
+		if err != nil {
+			return nil, err
+		}
+		n.Val = value
+		return n, nil
+	default:
+		return node, nil
+	}
+}
+
+func lookupVariable(reference string, vars map[string]VariableValue) (VariableValue, error) {
+	value, ok := vars[variable.Name(reference)]
+	if !ok {
+		return VariableValue{}, fmt.Errorf("variable %q is not defined", reference)
+	}
+	return value, nil
+}
+
+func singleValue(reference string, vars map[string]VariableValue) (string, error) {
+	value, err := lookupVariable(reference, vars)
+	if err != nil {
+		return "", err
+	}
+	if value.All && len(value.AllValue) > 0 {
+		return value.AllValue, nil
+	}
+	if len(value.Values) != 1 {
+		return "", fmt.Errorf("variable %q must have exactly one value, got %d", reference, len(value.Values))
+	}
+	return value.Values[0], nil
+}
+
+func interpolateDuration(reference string, vars map[string]VariableValue, d *time.Duration) error {
+	if len(reference) == 0 {
+		return nil
+	}
+	// The variable can be followed by a unit, like "${__range_s}s".
+	reference, unit, _ := variable.SplitDuration(reference)
+	value, err := singleValue(reference, vars)
+	if err != nil {
+		return err
+	}
+	value += unit
+	negative := strings.HasPrefix(value, "-")
+	parsed, err := model.ParseDuration(strings.TrimPrefix(value, "-"))
+	if err != nil {
+		return fmt.Errorf("value %q of variable %q is not a duration: %w", value, reference, err)
+	}
+	*d = time.Duration(parsed)
+	if negative {
+		*d = -*d
+	}
+	return nil
+}
+
+func interpolateString(s string, vars map[string]VariableValue) (string, error) {
+	var err error
+	result := variableRegexpAnywhere.ReplaceAllStringFunc(s, func(reference string) string {
+		if err != nil {
+			return reference
+		}
+		var value VariableValue
+		if value, err = lookupVariable(reference, vars); err != nil {
+			return reference
+		}
+		var formatted string
+		formatted, err = formatValue(reference, value)
+		return formatted
+	})
+	return result, err
+}
+
+var variableRegexpAnywhere = regexp.MustCompile(variable.Pattern)
+
+// formatValue formats the value of a variable according to the format given in its reference.
+func formatValue(reference string, value VariableValue) (string, error) {
+	if value.All && len(value.AllValue) > 0 {
+		return value.AllValue, nil
+	}
+	values := value.Values
+	switch format := variable.Format(reference); format {
+	case "":
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return formatRegex(values), nil
+	case "regex":
+		return formatRegex(values), nil
+	case "pipe":
+		return strings.Join(values, "|"), nil
+	case "csv", "raw":
+		return strings.Join(values, ","), nil
+	case "glob":
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return "{" + strings.Join(values, ",") + "}", nil
+	case "json":
+		b, err := json.Marshal(values)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "singlequote":
+		return quoteValues(values, "'"), nil
+	case "doublequote":
+		return quoteValues(values, `"`), nil
+	default:
+		return "", fmt.Errorf("unsupported format %q for variable %q", format, reference)
+	}
+}
+
+func formatRegex(values []string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = regexp.QuoteMeta(v)
+	}
+	if len(escaped) == 1 {
+		return escaped[0]
+	}
+	return "(" + strings.Join(escaped, "|") + ")"
+}
+
+func quoteValues(values []string, quote string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quote + strings.ReplaceAll(v, quote, `\`+quote) + quote
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,186 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]VariableValue{
+		"__rate_interval": SingleValue("1m"),
+		"__range":         SingleValue("1h"),
+		"__range_s":       SingleValue("3600"),
+		"__interval":      SingleValue("30s"),
+		"offset":          SingleValue("5m"),
+		"k":               SingleValue("5"),
+		"quantile":        SingleValue("0.99"),
+		"cluster":         SingleValue("eu-west"),
+		"namespace":       MultiValue("prod", "staging.1"),
+		"pod":             AllValue(".*", "a", "b"),
+		"instance":        AllValue("", "a:9090", "b:9090"),
+	}
+	testSuite := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "range as variable",
+			query:    "rate(foo[$__rate_interval])",
+			expected: "rate(foo[1m])",
+		},
+		{
+			name:     "offset as variable",
+			query:    "rate(foo[5m] offset $offset) - foo offset $offset",
+			expected: "rate(foo[5m] offset 5m) - foo offset 5m",
+		},
+		{
+			name:     "subquery as variable",
+			query:    "max_over_time(sum(foo)[$__range:$__interval])",
+			expected: "max_over_time(sum(foo)[1h:30s])",
+		},
+		{
+			name:     "range as variable followed by a unit",
+			query:    "rate(foo[${__range_s}s])",
+			expected: "rate(foo[1h])",
+		},
+		{
+			name:     "number as variable",
+			query:    "topk($k, histogram_quantile($quantile, foo))",
+			expected: "topk(5, histogram_quantile(0.99, foo))",
+		},
+		{
+			name:     "single value",
+			query:    `foo{cluster="$cluster"}`,
+			expected: `foo{cluster="eu-west"}`,
+		},
+		{
+			name:     "multi value without format",
+			query:    `foo{namespace=~"$namespace"}`,
+			expected: `foo{namespace=~"(prod|staging\\.1)"}`,
+		},
+		{
+			name:     "regex format",
+			query:    `foo{cluster=~"${cluster:regex}"}`,
+			expected: `foo{cluster=~"eu-west"}`,
+		},
+		{
+			name:     "pipe format",
+			query:    `foo{namespace=~"${namespace:pipe}"}`,
+			expected: `foo{namespace=~"prod|staging.1"}`,
+		},
+		{
+			name:     "csv format",
+			query:    `label_replace(foo, "dst", "${namespace:csv}", "src", "(.*)")`,
+			expected: `label_replace(foo, "dst", "prod,staging.1", "src", "(.*)")`,
+		},
+		{
+			name:     "glob format",
+			query:    `foo{namespace="${namespace:glob}"}`,
+			expected: `foo{namespace="{prod,staging.1}"}`,
+		},
+		{
+			name:     "singlequote format",
+			query:    `foo{namespace="${namespace:singlequote}"}`,
+			expected: `foo{namespace="'prod','staging.1'"}`,
+		},
+		{
+			name:     "all with custom value",
+			query:    `foo{pod=~"${pod:regex}"}`,
+			expected: `foo{pod=~".*"}`,
+		},
+		{
+			name:     "all without custom value",
+			query:    `foo{instance=~"$instance"}`,
+			expected: `foo{instance=~"(a:9090|b:9090)"}`,
+		},
+		{
+			name:     "several variables in the same value",
+			query:    `foo{job="$cluster/$k"}`,
+			expected: `foo{job="eu-west/5"}`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Interpolate(MustParse(test.query), vars)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result.String())
+			assert.Empty(t, Variables(result))
+		})
+	}
+}
+
+func TestInterpolateDoesNotModifyInput(t *testing.T) {
+	expr := Rate(matrix.New(
+		vector.New(vector.WithMetricName("foo")),
+		matrix.WithRangeAsVariable("$__rate_interval"),
+	))
+	result, err := Interpolate(expr, map[string]VariableValue{"__rate_interval": SingleValue("2m")})
+	require.NoError(t, err)
+	assert.Equal(t, "rate(foo[2m])", result.String())
+	assert.Equal(t, "rate(foo[$__rate_interval])", expr.String())
+	_, ok := result.(*parser.Call).Args[0].(*parser.MatrixSelector)
+	assert.True(t, ok)
+}
+
+func TestInterpolateError(t *testing.T) {
+	vars := map[string]VariableValue{
+		"interval":  SingleValue("not a duration"),
+		"namespace": MultiValue("a", "b"),
+	}
+	testSuite := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{
+			name:  "undefined variable",
+			query: `foo{cluster="$cluster"}`,
+			err:   `variable "$cluster" is not defined`,
+		},
+		{
+			name:  "unsupported format",
+			query: `foo{namespace="${namespace:unknown}"}`,
+			err:   `unsupported format "unknown" for variable "${namespace:unknown}"`,
+		},
+		{
+			name:  "multi value as range",
+			query: `rate(foo[$namespace])`,
+			err:   `variable "$namespace" must have exactly one value, got 2`,
+		},
+		{
+			name:  "invalid duration",
+			query: `rate(foo[$interval])`,
+			err:   `value "not a duration" of variable "$interval" is not a duration: not a valid duration string: "not a duration"`,
+		},
+		{
+			name:  "invalid number",
+			query: `topk($interval, foo)`,
+			err:   `value "not a duration" of variable "$interval" is not a number`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Interpolate(MustParse(test.query), vars)
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint reports the common mistakes in PromQL expressions that Prometheus accepts but that give misleading
+// results, like a rate on a gauge or a histogram_quantile losing the label "le".
+//
+// Contrary to promqlbuilder.Validate, the findings are not errors: every rule can be disabled or given another
+// severity.
+package lint
+
+import (
+	"fmt"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Severity is how serious a finding is.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Finding is a problem found by a rule on a node of an expression.
+type Finding struct {
+	// Rule is the ID of the rule that found the problem, like RateOnGauge.
+	Rule     string
+	Severity Severity
+	// Path is the location of the node in the expression, like "$.expr.args[0]".
+	Path    string
+	Node    parser.Node
+	Message string
+	// Fix suggests how to solve the problem.
+	Fix string
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s (%s): %s", f.Path, f.Severity, f.Rule, f.Message)
+}
+
+// Rule is a check run on every node of the expression.
+type Rule struct {
+	ID string
+	// Severity is the severity of the findings of the rule, unless changed with WithSeverity.
+	Severity    Severity
+	Description string
+	check       func(l *linter, node parser.Node, ancestors []parser.Node) []problem
+}
+
+// problem is what a rule reports on the visited node, completed by the linter to make a Finding.
+type problem struct {
+	message string
+	fix     string
+}
+
+type Option func(l *linter)
+
+// Disable turns off the given rules.
+func Disable(ruleIDs ...string) Option {
+	return func(l *linter) {
+		for _, id := range ruleIDs {
+			l.disabled[id] = true
+		}
+	}
+}
+
+// WithSeverity changes the severity of the findings of a rule.
+func WithSeverity(ruleID string, severity Severity) Option {
+	return func(l *linter) {
+		l.severities[ruleID] = severity
+	}
+}
+
+// WithScrapeInterval sets the scrape interval of the series, used to find the ranges that are too short.
+// It is 1m by default, like in Prometheus.
+func WithScrapeInterval(d time.Duration) Option {
+	return func(l *linter) {
+		l.scrapeInterval = d
+	}
+}
+
+// ForAlerting tells that the expression is the one of an alerting rule, to enable the rules specific to alerts.
+func ForAlerting() Option {
+	return func(l *linter) {
+		l.alerting = true
+	}
+}
+
+type linter struct {
+	disabled       map[string]bool
+	severities     map[string]Severity
+	scrapeInterval time.Duration
+	alerting       bool
+	findings       []*Finding
+}
+
+// Lint runs all the rules on every node of the expression and returns the findings, in the order of the nodes.
+func Lint(expr parser.Expr, options ...Option) []*Finding {
+	l := &linter{
+		disabled:       map[string]bool{},
+		severities:     map[string]Severity{},
+		scrapeInterval: time.Minute,
+	}
+	for _, opt := range options {
+		opt(l)
+	}
+	_ = promqlbuilder.Walk(l, expr, nil)
+	return l.findings
+}
+
+// Visit implements parser.Visitor to be used with promqlbuilder.Walk.
+func (l *linter) Visit(node parser.Node, ancestors []parser.Node) (parser.Visitor, error) {
+	if node == nil {
+		return nil, nil
+	}
+	for _, rule := range Rules {
+		if l.disabled[rule.ID] {
+			continue
+		}
+		severity, ok := l.severities[rule.ID]
+		if !ok {
+			severity = rule.Severity
+		}
+		for _, p := range rule.check(l, node, ancestors) {
+			l.findings = append(l.findings, &Finding{
+				Rule:     rule.ID,
+				Severity: severity,
+				Path:     promqlbuilder.NodePath(ancestors, node),
+				Node:     node,
+				Message:  p.message,
+				Fix:      p.fix,
+			})
+		}
+	}
+	return l, nil
+}
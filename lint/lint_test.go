@@ -0,0 +1,138 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"testing"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		options  []Option
+		expected []string
+	}{
+		{
+			name:     "no finding",
+			expr:     promqlbuilder.MustParse(`sum by (job) (rate(http_requests_total{code=~"5.."}[5m])) / on (job) sum by (job) (rate(http_requests_total[5m]))`),
+			expected: nil,
+		},
+		{
+			name:     "rate on gauge",
+			expr:     promqlbuilder.MustParse(`rate(node_memory_free_bytes[5m])`),
+			expected: []string{`$: warning (rate-on-gauge): rate() is applied to "node_memory_free_bytes" which is not a counter according to its name`},
+		},
+		{
+			name:     "rate on native histogram",
+			expr:     promqlbuilder.MustParse(`histogram_quantile(0.9, sum(rate(http_request_duration_seconds[5m])))`),
+			expected: nil,
+		},
+		{
+			name:     "aggregate before rate",
+			expr:     promqlbuilder.MustParse(`rate(sum(http_requests_total)[5m:1m])`),
+			expected: []string{`$: error (aggregate-before-rate): rate() is applied to an aggregation, so the counter resets of the aggregated series are not detected`},
+		},
+		{
+			name: "histogram_quantile without le",
+			expr: promqlbuilder.MustParse(`histogram_quantile(0.9, sum by (job) (rate(http_request_duration_seconds_bucket[5m]))) + histogram_quantile(0.9, sum without (le) (rate(foo_bucket[5m])))`),
+			expected: []string{
+				`$.lhs: error (histogram-quantile-without-le): the sum aggregation drops the label le of the buckets, so histogram_quantile() cannot compute the quantile`,
+				`$.rhs: error (histogram-quantile-without-le): the sum aggregation drops the label le of the buckets, so histogram_quantile() cannot compute the quantile`,
+			},
+		},
+		{
+			name:     "irate outside of an alert",
+			expr:     promqlbuilder.MustParse(`irate(http_requests_total[5m]) > 10`),
+			expected: nil,
+		},
+		{
+			name:     "irate in an alert",
+			expr:     promqlbuilder.MustParse(`irate(http_requests_total[5m]) > 10`),
+			options:  []Option{ForAlerting()},
+			expected: []string{`$.lhs: warning (irate-in-alert): irate() only uses the last two samples, so the alert depends on a single scrape`},
+		},
+		{
+			name: "regex matchers",
+			expr: promqlbuilder.MustParse(`up{job=~"^api$",instance=~".*",path=~"/foo\\$"}`),
+			expected: []string{
+				`$: info (anchored-regex): the regex of the matcher job=~"^api$" is anchored while PromQL already anchors it`,
+				`$: warning (match-all-regex): the matcher instance=~".*" matches every series, including the ones without the label instance`,
+			},
+		},
+		{
+			name:     "anchor needed by the regex",
+			expr:     promqlbuilder.MustParse(`foo{a=~"^*",b=~"^+"}`),
+			expected: nil,
+		},
+		{
+			name: "short ranges",
+			expr: promqlbuilder.Add(
+				promqlbuilder.Rate(matrix.New(vector.New(vector.WithMetricName("foo_total")), matrix.WithRange(90*time.Second))),
+				promqlbuilder.MaxOverTime(matrix.New(vector.New(vector.WithMetricName("bar")), matrix.WithRange(30*time.Second))),
+			),
+			expected: []string{
+				`$.lhs.args[0]: warning (short-range): the range 1m30s may hold only one sample with a scrape interval of 1m, while rate() needs two`,
+				`$.rhs.args[0]: warning (short-range): the range 30s is shorter than the scrape interval of 1m, so it may hold no sample`,
+			},
+		},
+		{
+			name:     "short range with a shorter scrape interval",
+			expr:     promqlbuilder.MustParse(`rate(foo_total[1m])`),
+			options:  []Option{WithScrapeInterval(15 * time.Second)},
+			expected: nil,
+		},
+		{
+			name:     "range as variable",
+			expr:     promqlbuilder.MustParse(`rate(foo_total[$__rate_interval])`),
+			expected: nil,
+		},
+		{
+			name:     "division without on",
+			expr:     promqlbuilder.MustParse(`node_filesystem_avail_bytes / node_filesystem_size_bytes`),
+			expected: []string{`$: warning (division-without-on): the division matches the series of both sides on all their labels`},
+		},
+		{
+			name:     "disabled rule and changed severity",
+			expr:     promqlbuilder.MustParse(`rate(node_memory_free_bytes[5m]) / node_memory_total_bytes`),
+			options:  []Option{Disable(DivisionWithoutOn), WithSeverity(RateOnGauge, Error)},
+			expected: []string{`$.lhs: error (rate-on-gauge): rate() is applied to "node_memory_free_bytes" which is not a counter according to its name`},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			var findings []string
+			for _, f := range Lint(test.expr, test.options...) {
+				findings = append(findings, f.String())
+			}
+			assert.Equal(t, test.expected, findings)
+		})
+	}
+}
+
+func TestFindingFix(t *testing.T) {
+	findings := Lint(promqlbuilder.MustParse(`up{job=~"^(api|web)$"}`))
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, `remove the anchors: job=~"(api|web)"`, findings[0].Fix)
+		assert.Equal(t, AnchoredRegex, findings[0].Rule)
+		assert.Equal(t, Info, findings[0].Severity)
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// The IDs of the rules.
+const (
+	RateOnGauge                = "rate-on-gauge"
+	AggregateBeforeRate        = "aggregate-before-rate"
+	HistogramQuantileWithoutLe = "histogram-quantile-without-le"
+	IrateInAlert               = "irate-in-alert"
+	AnchoredRegex              = "anchored-regex"
+	MatchAllRegex              = "match-all-regex"
+	ShortRange                 = "short-range"
+	DivisionWithoutOn          = "division-without-on"
+)
+
+// Rules are all the rules run by Lint.
+var Rules = []Rule{
+	{
+		ID:          RateOnGauge,
+		Severity:    Warning,
+		Description: "rate(), irate() and increase() are applied to a metric that is not a counter according to its name",
+		check:       checkRateOnGauge,
+	},
+	{
+		ID:          AggregateBeforeRate,
+		Severity:    Error,
+		Description: "rate(), irate() and increase() are applied to an aggregation, which hides the counter resets",
+		check:       checkAggregateBeforeRate,
+	},
+	{
+		ID:          HistogramQuantileWithoutLe,
+		Severity:    Error,
+		Description: "histogram_quantile() is applied to an aggregation of classic buckets dropping the label le",
+		check:       checkHistogramQuantileWithoutLe,
+	},
+	{
+		ID:          IrateInAlert,
+		Severity:    Warning,
+		Description: "irate() is used in an alerting expression, see ForAlerting",
+		check:       checkIrateInAlert,
+	},
+	{
+		ID:          AnchoredRegex,
+		Severity:    Info,
+		Description: "a regex matcher starts with ^ or ends with $ while PromQL always anchors the regexes",
+		check:       checkAnchoredRegex,
+	},
+	{
+		ID:          MatchAllRegex,
+		Severity:    Warning,
+		Description: `a matcher =~".*" matches every series, including the ones without the label`,
+		check:       checkMatchAllRegex,
+	},
+	{
+		ID:          ShortRange,
+		Severity:    Warning,
+		Description: "a range may be too short to hold the samples needed by the function, see WithScrapeInterval",
+		check:       checkShortRange,
+	},
+	{
+		ID:          DivisionWithoutOn,
+		Severity:    Warning,
+		Description: "a division between two vectors does not say on which labels the series are matched",
+		check:       checkDivisionWithoutOn,
+	},
+}
+
+// counterFunctions are the functions only meaningful on counters.
+var counterFunctions = []string{"rate", "irate", "increase"}
+
+// twoSamplesFunctions are the functions returning nothing when the range holds less than two samples.
+var twoSamplesFunctions = []string{"rate", "irate", "increase", "delta", "idelta", "deriv"}
+
+// counterSuffixes are the suffixes of the counters, following the Prometheus naming conventions.
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+func checkRateOnGauge(_ *linter, node parser.Node, ancestors []parser.Node) []problem {
+	call, ok := node.(*parser.Call)
+	if !ok || !slices.Contains(counterFunctions, call.Func.Name) || len(call.Args) == 0 {
+		return nil
+	}
+	v := matrixSelectorOf(call.Args[0])
+	if v == nil || len(v.Name) == 0 || hasCounterSuffix(v.Name) || insideHistogramFunction(ancestors) {
+		return nil
+	}
+	return []problem{{
+		message: fmt.Sprintf("%s() is applied to %q which is not a counter according to its name", call.Func.Name, v.Name),
+		fix:     "use deriv() or delta() for a gauge, or add the suffix _total to the name of the counter",
+	}}
+}
+
+func checkAggregateBeforeRate(_ *linter, node parser.Node, _ []parser.Node) []problem {
+	call, ok := node.(*parser.Call)
+	if !ok || !slices.Contains(counterFunctions, call.Func.Name) || len(call.Args) == 0 {
+		return nil
+	}
+	var inner parser.Expr
+	switch arg := unwrap(call.Args[0]).(type) {
+	case *parser.SubqueryExpr:
+		inner = arg.Expr
+	case *subquery.VariableBuilder:
+		inner = arg.InternalSubquery.Expr
+	default:
+		return nil
+	}
+	if !containsAggregation(inner) {
+		return nil
+	}
+	return []problem{{
+		message: fmt.Sprintf("%s() is applied to an aggregation, so the counter resets of the aggregated series are not detected", call.Func.Name),
+		fix:     fmt.Sprintf("aggregate the result of %s() instead, like sum(%s(foo[5m]))", call.Func.Name, call.Func.Name),
+	}}
+}
+
+func checkHistogramQuantileWithoutLe(_ *linter, node parser.Node, _ []parser.Node) []problem {
+	call, ok := node.(*parser.Call)
+	if !ok || call.Func.Name != "histogram_quantile" || len(call.Args) < 2 {
+		return nil
+	}
+	a := promqlbuilder.AggregateExprOf(unwrap(call.Args[1]))
+	if a == nil || !hasClassicBuckets(a.Expr) {
+		return nil
+	}
+	if slices.Contains(a.Grouping, labels.BucketLabel) != a.Without {
+		return nil
+	}
+	return []problem{{
+		message: fmt.Sprintf("the %s aggregation drops the label le of the buckets, so histogram_quantile() cannot compute the quantile", a.Op),
+		fix:     "keep the label le, like sum by (le) (rate(foo_bucket[5m]))",
+	}}
+}
+
+func checkIrateInAlert(l *linter, node parser.Node, _ []parser.Node) []problem {
+	call, ok := node.(*parser.Call)
+	if !ok || !l.alerting || call.Func.Name != "irate" {
+		return nil
+	}
+	return []problem{{
+		message: "irate() only uses the last two samples, so the alert depends on a single scrape",
+		fix:     "use rate() over a range of several scrape intervals",
+	}}
+}
+
+func checkAnchoredRegex(_ *linter, node parser.Node, _ []parser.Node) []problem {
+	v, ok := node.(*parser.VectorSelector)
+	if !ok {
+		return nil
+	}
+	var problems []problem
+	for _, m := range v.LabelMatchers {
+		if !isRegexMatcher(m) {
+			continue
+		}
+		trimmed := strings.TrimPrefix(m.Value, "^")
+		if strings.HasSuffix(trimmed, "$") && !strings.HasSuffix(trimmed, `\$`) {
+			trimmed = strings.TrimSuffix(trimmed, "$")
+		}
+		if trimmed == m.Value {
+			continue
+		}
+		fixed, err := labels.NewMatcher(m.Type, m.Name, trimmed)
+		if err != nil {
+			// Like in "^*", the anchor is needed for the regex to be valid.
+			continue
+		}
+		problems = append(problems, problem{
+			message: fmt.Sprintf("the regex of the matcher %s is anchored while PromQL already anchors it", m),
+			fix:     fmt.Sprintf("remove the anchors: %s", fixed),
+		})
+	}
+	return problems
+}
+
+func checkMatchAllRegex(_ *linter, node parser.Node, _ []parser.Node) []problem {
+	v, ok := node.(*parser.VectorSelector)
+	if !ok {
+		return nil
+	}
+	var problems []problem
+	for _, m := range v.LabelMatchers {
+		if m.Type != labels.MatchRegexp || (m.Value != ".*" && m.Value != "^.*$") {
+			continue
+		}
+		problems = append(problems, problem{
+			message: fmt.Sprintf("the matcher %s matches every series, including the ones without the label %s", m, m.Name),
+			fix:     fmt.Sprintf(`remove the matcher, or use %s=~".+" to only keep the series having the label`, m.Name),
+		})
+	}
+	return problems
+}
+
+func checkShortRange(l *linter, node parser.Node, ancestors []parser.Node) []problem {
+	var r time.Duration
+	switch n := node.(type) {
+	case *parser.MatrixSelector:
+		r = n.Range
+	case *matrix.Builder:
+		if len(n.RangeAsVariable) > 0 {
+			return nil
+		}
+		r = n.InternalMatrix.Range
+	default:
+		return nil
+	}
+	function := ""
+	if len(ancestors) > 0 {
+		if call, ok := ancestors[len(ancestors)-1].(*parser.Call); ok {
+			function = call.Func.Name
+		}
+	}
+	scrape := model.Duration(l.scrapeInterval)
+	switch {
+	case slices.Contains(twoSamplesFunctions, function) && r < 2*l.scrapeInterval:
+		return []problem{{
+			message: fmt.Sprintf("the range %s may hold only one sample with a scrape interval of %s, while %s() needs two", model.Duration(r), scrape, function),
+			fix:     "use a range of at least 4 times the scrape interval, or $__rate_interval in a dashboard",
+		}}
+	case r < l.scrapeInterval:
+		return []problem{{
+			message: fmt.Sprintf("the range %s is shorter than the scrape interval of %s, so it may hold no sample", model.Duration(r), scrape),
+			fix:     "use a range longer than the scrape interval",
+		}}
+	default:
+		return nil
+	}
+}
+
+func checkDivisionWithoutOn(_ *linter, node parser.Node, _ []parser.Node) []problem {
+	b := promqlbuilder.BinaryExprOf(node)
+	if b == nil || b.Op != parser.DIV || b.LHS.Type() != parser.ValueTypeVector || b.RHS.Type() != parser.ValueTypeVector {
+		return nil
+	}
+	if b.VectorMatching != nil && (b.VectorMatching.On || len(b.VectorMatching.MatchingLabels) > 0) {
+		return nil
+	}
+	if sameGrouping(unwrap(b.LHS), unwrap(b.RHS)) {
+		// Both sides have exactly the grouping labels, so the matching is already explicit.
+		return nil
+	}
+	return []problem{{
+		message: "the division matches the series of both sides on all their labels",
+		fix:     "add on (...) or ignoring (...) to list the labels that must match",
+	}}
+}
+
+// unwrap removes the parentheses around an expression.
+func unwrap(expr parser.Expr) parser.Expr {
+	for {
+		switch e := expr.(type) {
+		case *parser.ParenExpr:
+			expr = e.Expr
+		case *parser.StepInvariantExpr:
+			expr = e.Expr
+		default:
+			return expr
+		}
+	}
+}
+
+// matrixSelectorOf returns the vector selector of a range vector, or nil if the expression is not one.
+func matrixSelectorOf(expr parser.Expr) *parser.VectorSelector {
+	var v parser.Expr
+	switch m := unwrap(expr).(type) {
+	case *parser.MatrixSelector:
+		v = m.VectorSelector
+	case *matrix.Builder:
+		v = m.InternalMatrix.VectorSelector
+	}
+	selector, _ := v.(*parser.VectorSelector)
+	return selector
+}
+
+func hasCounterSuffix(name string) bool {
+	for _, suffix := range counterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// insideHistogramFunction returns true if one of the ancestors is a histogram function, meaning that the series can
+// be native histograms whose name has no suffix.
+func insideHistogramFunction(ancestors []parser.Node) bool {
+	for _, ancestor := range ancestors {
+		if call, ok := ancestor.(*parser.Call); ok && strings.HasPrefix(call.Func.Name, "histogram_") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAggregation(expr parser.Expr) bool {
+	found := false
+	promqlbuilder.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if promqlbuilder.AggregateExprOf(node) != nil {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func hasClassicBuckets(expr parser.Expr) bool {
+	found := false
+	promqlbuilder.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if v, ok := node.(*parser.VectorSelector); ok && strings.HasSuffix(v.Name, "_bucket") {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+func isRegexMatcher(m *labels.Matcher) bool {
+	return m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp
+}
+
+// sameGrouping returns true if both expressions are aggregations keeping the same labels.
+func sameGrouping(lhs, rhs parser.Expr) bool {
+	l, r := promqlbuilder.AggregateExprOf(lhs), promqlbuilder.AggregateExprOf(rhs)
+	if l == nil || r == nil || l.Without || r.Without {
+		return false
+	}
+	left, right := slices.Clone(l.Grouping), slices.Clone(r.Grouping)
+	slices.Sort(left)
+	slices.Sort(right)
+	return slices.Equal(left, right)
+}
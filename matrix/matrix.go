@@ -26,8 +26,9 @@ import (
 
 type Builder struct {
 	parser.Expr
-	InternalMatrix  *parser.MatrixSelector
-	RangeAsVariable string
+	InternalMatrix   *parser.MatrixSelector
+	RangeAsVariable  string
+	OffsetAsVariable string
 }
 
 // Type returns the type the expression evaluates to. It does not perform
@@ -72,6 +73,8 @@ func (b *Builder) atOffset() (string, string) {
 	vecSelector := b.InternalMatrix.VectorSelector.(*parser.VectorSelector)
 	offset := ""
 	switch {
+	case len(b.OffsetAsVariable) > 0:
+		offset = fmt.Sprintf(" offset %s", b.OffsetAsVariable)
 	case vecSelector.OriginalOffset > time.Duration(0):
 		offset = fmt.Sprintf(" offset %s", model.Duration(vecSelector.OriginalOffset))
 	case vecSelector.OriginalOffset < time.Duration(0):
@@ -137,6 +140,13 @@ func WithRangeAsVariable(name string) Option {
 	}
 }
 
+// WithOffsetAsVariable sets the offset as a variable name like "$offset".
+func WithOffsetAsVariable(name string) Option {
+	return func(matrix *Builder) {
+		matrix.OffsetAsVariable = name
+	}
+}
+
 // Refer to https://github.com/prometheus/prometheus/blob/v3.4.0/promql/parser/prettier.go for below.
 // The following is only used for matrix selector.
 func getCommonPrefixIndent(level int, current *Builder) string {
@@ -0,0 +1,292 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+// Definition is the metadata of a metric with its type, as returned by FromMetadata and FromExposition.
+type Definition struct {
+	Type model.MetricType
+	Metadata
+}
+
+// supportedTypes are the types having a typed definition, the other metrics are ignored.
+var supportedTypes = []model.MetricType{
+	model.MetricTypeCounter,
+	model.MetricTypeGauge,
+	model.MetricTypeHistogram,
+	model.MetricTypeSummary,
+	model.MetricTypeInfo,
+}
+
+type metadataResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   map[string][]struct {
+		Type model.MetricType `json:"type"`
+		Help string           `json:"help"`
+		Unit string           `json:"unit"`
+	} `json:"data"`
+}
+
+// FromMetadata returns the definitions of the metrics listed in the response of the Prometheus /api/v1/metadata
+// endpoint, sorted by name. The known labels are not part of the metadata, so they are left empty.
+// The metadata of an OpenMetrics target is stored under the name of the family, without the suffix _total of the
+// series of a counter, while the metadata of a target in the Prometheus text format is stored under the name of the
+// series. The response does not tell which format was scraped, so the suffix _total is only added to the counters
+// when openMetrics is true, otherwise the names are kept as they are. The suffix _info is always added to the info
+// metrics that do not have it, as only OpenMetrics has this type.
+// The metrics with another type than counter, gauge, histogram, summary and info are ignored.
+func FromMetadata(data []byte, openMetrics bool) ([]Definition, error) {
+	var response metadataResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("the metadata request failed with status %q: %s", response.Status, response.Error)
+	}
+	var result []Definition
+	for name, metadata := range response.Data {
+		if len(metadata) == 0 || !slices.Contains(supportedTypes, metadata[0].Type) {
+			continue
+		}
+		d := Definition{Type: metadata[0].Type, Metadata: Metadata{Name: name, Help: metadata[0].Help, Unit: metadata[0].Unit}}
+		// The OpenMetrics counter and info families are named without the suffix of their series.
+		switch {
+		case openMetrics && d.Type == model.MetricTypeCounter && !strings.HasSuffix(name, "_total"):
+			d.Name += "_total"
+		case d.Type == model.MetricTypeInfo && !strings.HasSuffix(name, "_info"):
+			d.Name += "_info"
+		}
+		result = append(result, d)
+	}
+	slices.SortFunc(result, func(a, b Definition) int { return strings.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+// seriesSuffixes are the suffixes added to the name of a metric family to get the name of its series.
+var seriesSuffixes = []string{"_total", "_info", "_bucket", "_count", "_sum", "_created"}
+
+type family struct {
+	Definition
+	labels  map[string]bool
+	samples map[string]bool
+}
+
+// FromExposition returns the definitions of the metrics of a scrape in the Prometheus text format, or in the
+// OpenMetrics format when it ends with "# EOF", sorted by name. The known labels are the ones of the exposed series.
+// The metrics with another type than counter, gauge, histogram, summary and info are ignored.
+func FromExposition(data []byte) ([]Definition, error) {
+	var p textparse.Parser
+	if bytes.HasSuffix(bytes.TrimSpace(data), []byte("# EOF")) {
+		p = textparse.NewOpenMetricsParser(data, labels.NewSymbolTable())
+	} else {
+		p = textparse.NewPromParser(data, labels.NewSymbolTable(), false)
+	}
+	families := map[string]*family{}
+	getFamily := func(name []byte) *family {
+		f, ok := families[string(name)]
+		if !ok {
+			f = &family{Definition: Definition{Metadata: Metadata{Name: string(name)}}, labels: map[string]bool{}, samples: map[string]bool{}}
+			families[string(name)] = f
+		}
+		return f
+	}
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch entry {
+		case textparse.EntryType:
+			name, t := p.Type()
+			getFamily(name).Type = t
+		case textparse.EntryHelp:
+			name, help := p.Help()
+			getFamily(name).Help = string(help)
+		case textparse.EntryUnit:
+			name, unit := p.Unit()
+			getFamily(name).Unit = string(unit)
+		case textparse.EntrySeries:
+			var series labels.Labels
+			p.Labels(&series)
+			f := seriesFamily(families, series.Get(model.MetricNameLabel))
+			if f == nil {
+				continue
+			}
+			f.samples[series.Get(model.MetricNameLabel)] = true
+			series.Range(func(l labels.Label) {
+				f.labels[l.Name] = true
+			})
+		}
+	}
+	var result []Definition
+	for _, f := range families {
+		if slices.Contains(supportedTypes, f.Type) {
+			result = append(result, f.definition())
+		}
+	}
+	slices.SortFunc(result, func(a, b Definition) int { return strings.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+// seriesFamily returns the family of the series with the given name, or nil if the family is not declared.
+func seriesFamily(families map[string]*family, name string) *family {
+	if f, ok := families[name]; ok {
+		return f
+	}
+	for _, suffix := range seriesSuffixes {
+		if f, ok := families[strings.TrimSuffix(name, suffix)]; ok && strings.HasSuffix(name, suffix) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (f *family) definition() Definition {
+	d := f.Definition
+	switch {
+	case d.Type == model.MetricTypeCounter && !f.samples[d.Name] && f.samples[d.Name+"_total"]:
+		// In OpenMetrics, the counter family is named without the suffix of its series.
+		d.Name += "_total"
+	case d.Type == model.MetricTypeInfo && !f.samples[d.Name] && f.samples[d.Name+"_info"]:
+		d.Name += "_info"
+	}
+	for name := range f.labels {
+		switch {
+		case name == model.MetricNameLabel:
+		case name == model.BucketLabel && d.Type == model.MetricTypeHistogram:
+		case name == model.QuantileLabel && d.Type == model.MetricTypeSummary:
+		default:
+			d.Labels = append(d.Labels, name)
+		}
+	}
+	slices.Sort(d.Labels)
+	return d
+}
+
+var typeNames = map[model.MetricType]string{
+	model.MetricTypeCounter:   "Counter",
+	model.MetricTypeGauge:     "Gauge",
+	model.MetricTypeHistogram: "Histogram",
+	model.MetricTypeSummary:   "Summary",
+	model.MetricTypeInfo:      "Info",
+}
+
+var identifierSeparator = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// GoName returns the exported Go identifier of a metric, like "HTTPRequestsTotal" for "http_requests_total".
+func GoName(metric string) string {
+	var b strings.Builder
+	for _, word := range identifierSeparator.Split(metric, -1) {
+		if len(word) == 0 {
+			continue
+		}
+		if upper := strings.ToUpper(word); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	name := b.String()
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = "Metric" + name
+	}
+	return name
+}
+
+// commonInitialisms are the words written in capital letters in Go identifiers.
+var commonInitialisms = map[string]bool{
+	"API": true, "CPU": true, "DNS": true, "GC": true, "GRPC": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IO": true, "IP": true, "JSON": true, "OS": true, "RPC": true, "SQL": true, "TCP": true, "TLS": true,
+	"UDP": true, "URL": true,
+}
+
+// GenerateGo returns the gofmt'd source of a Go file of the given package declaring a variable for every
+// definition, like:
+//
+//	// HTTPRequestsTotal is the counter http_requests_total.
+//	// The total number of HTTP requests.
+//	var HTTPRequestsTotal = metric.Counter{
+//		Name:   "http_requests_total",
+//		Help:   "The total number of HTTP requests.",
+//		Labels: []string{"code", "method"},
+//	}
+//
+// The definitions with an unsupported type are ignored. It is an error when two metrics have the same Go name or
+// when there is no metric to declare.
+func GenerateGo(packageName string, definitions []Definition) (string, error) {
+	var b strings.Builder
+	b.WriteString("// Code generated by metricgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", packageName)
+	b.WriteString("import \"github.com/perses/promql-builder/metric\"\n")
+	names := map[string]string{}
+	for _, d := range definitions {
+		typeName, ok := typeNames[d.Type]
+		if !ok {
+			continue
+		}
+		name := GoName(d.Name)
+		if other, exists := names[name]; exists {
+			return "", fmt.Errorf("the metrics %q and %q have the same Go name %s", other, d.Name, name)
+		}
+		names[name] = d.Name
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "// %s is the %s %s.\n", name, d.Type, d.Name)
+		if len(d.Help) > 0 {
+			fmt.Fprintf(&b, "// %s\n", strings.ReplaceAll(d.Help, "\n", " "))
+		}
+		fmt.Fprintf(&b, "var %s = metric.%s{\n", name, typeName)
+		fmt.Fprintf(&b, "Name: %q,\n", d.Name)
+		if len(d.Help) > 0 {
+			fmt.Fprintf(&b, "Help: %q,\n", d.Help)
+		}
+		if len(d.Unit) > 0 {
+			fmt.Fprintf(&b, "Unit: %q,\n", d.Unit)
+		}
+		if len(d.Labels) > 0 {
+			quoted := make([]string, len(d.Labels))
+			for i, l := range d.Labels {
+				quoted[i] = fmt.Sprintf("%q", l)
+			}
+			fmt.Fprintf(&b, "Labels: []string{%s},\n", strings.Join(quoted, ", "))
+		}
+		b.WriteString("}\n")
+	}
+	if len(names) == 0 {
+		return "", errors.New("no counter, gauge, histogram, summary or info metric to generate")
+	}
+	formatted, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
@@ -0,0 +1,190 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromMetadata(t *testing.T) {
+	data := `{
+  "status": "success",
+  "data": {
+    "up": [{"type": "gauge", "help": "Whether the target is up.", "unit": ""}],
+    "http_requests_total": [{"type": "counter", "help": "Total number of HTTP requests.", "unit": ""}],
+    "process_cpu_seconds": [{"type": "counter", "help": "Total CPU time.", "unit": "seconds"}],
+    "http_request_duration_seconds": [{"type": "histogram", "help": "Duration of HTTP requests.", "unit": "seconds"}],
+    "target_info": [{"type": "info", "help": "Target metadata.", "unit": ""}],
+    "scrape_samples": [{"type": "unknown", "help": "", "unit": ""}]
+  }
+}`
+	testSuite := []struct {
+		name        string
+		openMetrics bool
+		expected    []Definition
+	}{
+		{
+			name:        "prometheus text format",
+			openMetrics: false,
+			expected: []Definition{
+				{Type: model.MetricTypeHistogram, Metadata: Metadata{Name: "http_request_duration_seconds", Help: "Duration of HTTP requests.", Unit: "seconds"}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "http_requests_total", Help: "Total number of HTTP requests."}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "process_cpu_seconds", Help: "Total CPU time.", Unit: "seconds"}},
+				{Type: model.MetricTypeInfo, Metadata: Metadata{Name: "target_info", Help: "Target metadata."}},
+				{Type: model.MetricTypeGauge, Metadata: Metadata{Name: "up", Help: "Whether the target is up."}},
+			},
+		},
+		{
+			name:        "openmetrics",
+			openMetrics: true,
+			expected: []Definition{
+				{Type: model.MetricTypeHistogram, Metadata: Metadata{Name: "http_request_duration_seconds", Help: "Duration of HTTP requests.", Unit: "seconds"}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "http_requests_total", Help: "Total number of HTTP requests."}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "process_cpu_seconds_total", Help: "Total CPU time.", Unit: "seconds"}},
+				{Type: model.MetricTypeInfo, Metadata: Metadata{Name: "target_info", Help: "Target metadata."}},
+				{Type: model.MetricTypeGauge, Metadata: Metadata{Name: "up", Help: "Whether the target is up."}},
+			},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := FromMetadata([]byte(data), test.openMetrics)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+
+	_, err := FromMetadata([]byte(`{"status": "error", "error": "forbidden"}`), false)
+	assert.EqualError(t, err, `the metadata request failed with status "error": forbidden`)
+}
+
+func TestFromExposition(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		input    string
+		expected []Definition
+	}{
+		{
+			name: "prometheus text format",
+			input: `# HELP http_requests_total Total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="get"} 10
+http_requests_total{code="500",method="post"} 1
+# HELP http_request_duration_seconds Duration of HTTP requests.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{handler="/",le="0.1"} 1
+http_request_duration_seconds_bucket{handler="/",le="+Inf"} 2
+http_request_duration_seconds_sum{handler="/"} 0.3
+http_request_duration_seconds_count{handler="/"} 2
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{service="a",quantile="0.5"} 0.1
+rpc_duration_seconds_sum{service="a"} 1
+rpc_duration_seconds_count{service="a"} 10
+# TYPE process_open_fds gauge
+process_open_fds 12
+untyped_metric 1
+`,
+			expected: []Definition{
+				{Type: model.MetricTypeHistogram, Metadata: Metadata{Name: "http_request_duration_seconds", Help: "Duration of HTTP requests.", Labels: []string{"handler"}}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "http_requests_total", Help: "Total number of HTTP requests.", Labels: []string{"code", "method"}}},
+				{Type: model.MetricTypeGauge, Metadata: Metadata{Name: "process_open_fds"}},
+				{Type: model.MetricTypeSummary, Metadata: Metadata{Name: "rpc_duration_seconds", Labels: []string{"service"}}},
+			},
+		},
+		{
+			name: "openmetrics format",
+			input: `# TYPE http_requests counter
+# HELP http_requests Total number of HTTP requests.
+http_requests_total{code="200"} 10
+http_requests_created{code="200"} 1.7e9
+# TYPE build info
+build_info{version="1.0.0"} 1
+# TYPE process_cpu_seconds counter
+# UNIT process_cpu_seconds seconds
+process_cpu_seconds_total 4.2
+# EOF
+`,
+			expected: []Definition{
+				{Type: model.MetricTypeInfo, Metadata: Metadata{Name: "build_info", Labels: []string{"version"}}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "http_requests_total", Help: "Total number of HTTP requests.", Labels: []string{"code"}}},
+				{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "process_cpu_seconds_total", Unit: "seconds"}},
+			},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := FromExposition([]byte(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestGoName(t *testing.T) {
+	testSuite := []struct {
+		metric   string
+		expected string
+	}{
+		{metric: "http_requests_total", expected: "HTTPRequestsTotal"},
+		{metric: "process_cpu_seconds_total", expected: "ProcessCPUSecondsTotal"},
+		{metric: "job:http_requests:rate5m", expected: "JobHTTPRequestsRate5m"},
+		{metric: "up", expected: "Up"},
+	}
+	for _, test := range testSuite {
+		t.Run(test.metric, func(t *testing.T) {
+			assert.Equal(t, test.expected, GoName(test.metric))
+		})
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	definitions := []Definition{
+		{Type: model.MetricTypeCounter, Metadata: Metadata{Name: "http_requests_total", Help: "Total number of HTTP requests.", Labels: []string{"code", "method"}}},
+		{Type: model.MetricTypeHistogram, Metadata: Metadata{Name: "http_request_duration_seconds", Unit: "seconds"}},
+		{Type: model.MetricTypeGaugeHistogram, Metadata: Metadata{Name: "ignored"}},
+	}
+	expected := `// Code generated by metricgen. DO NOT EDIT.
+
+package metrics
+
+import "github.com/perses/promql-builder/metric"
+
+// HTTPRequestsTotal is the counter http_requests_total.
+// Total number of HTTP requests.
+var HTTPRequestsTotal = metric.Counter{
+	Name:   "http_requests_total",
+	Help:   "Total number of HTTP requests.",
+	Labels: []string{"code", "method"},
+}
+
+// HTTPRequestDurationSeconds is the histogram http_request_duration_seconds.
+var HTTPRequestDurationSeconds = metric.Histogram{
+	Name: "http_request_duration_seconds",
+	Unit: "seconds",
+}
+`
+	result, err := GenerateGo("metrics", definitions)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	_, err = GenerateGo("metrics", []Definition{
+		{Type: model.MetricTypeGauge, Metadata: Metadata{Name: "foo_bar"}},
+		{Type: model.MetricTypeGauge, Metadata: Metadata{Name: "foo:bar"}},
+	})
+	assert.EqualError(t, err, `the metrics "foo_bar" and "foo:bar" have the same Go name FooBar`)
+}
@@ -0,0 +1,258 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metric defines typed Prometheus metrics exposing only the operations valid for their type, so that for
+// example the rate of a gauge or the quantile of a counter does not compile.
+//
+// The definitions can be written by hand or generated from a Prometheus server or an exposition file, see
+// FromMetadata, FromExposition and GenerateGo.
+package metric
+
+import (
+	"fmt"
+	"slices"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/histogram"
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Metadata describes a metric. Labels lists the known labels of the metric, without the labels "le" and "quantile"
+// of the histograms and summaries. When it is set, Label panics for any other label to catch typos early.
+type Metadata struct {
+	Name   string
+	Help   string
+	Unit   string
+	Labels []string
+}
+
+func (m Metadata) selector(matchers []*labels.Matcher) *parser.VectorSelector {
+	return vector.New(vector.WithMetricName(m.Name), vector.WithLabelMatchers(matchers...))
+}
+
+func (m Metadata) rangeSelector(rangeOpt matrix.Option, matchers []*labels.Matcher) *matrix.Builder {
+	return matrix.New(m.selector(matchers), rangeOpt)
+}
+
+func (m Metadata) label(name string) *label.Builder {
+	if len(m.Labels) > 0 && !slices.Contains(m.Labels, name) {
+		panic(fmt.Sprintf("metric %q has no label %q, known labels are %v", m.Name, name, m.Labels))
+	}
+	return label.New(name)
+}
+
+// withSuffix returns the metadata of the series with the given suffix, like the _bucket series of a histogram that
+// has the additional label "le".
+func (m Metadata) withSuffix(suffix string, additionalLabels ...string) Metadata {
+	result := Metadata{Name: m.Name + suffix, Help: m.Help, Unit: m.Unit}
+	if len(m.Labels) > 0 {
+		result.Labels = append(slices.Clone(m.Labels), additionalLabels...)
+		slices.Sort(result.Labels)
+	}
+	return result
+}
+
+// Counter is a value that only goes up, and is reset to zero when the process restarts.
+type Counter Metadata
+
+// Label returns a builder for a matcher on a label of the counter.
+func (c Counter) Label(name string) *label.Builder {
+	return Metadata(c).label(name)
+}
+
+// Selector returns the instant vector selector of the counter.
+// A raw counter is rarely useful, prefer Rate or Increase.
+func (c Counter) Selector(matchers ...*labels.Matcher) *parser.VectorSelector {
+	return Metadata(c).selector(matchers)
+}
+
+// Range returns the range vector selector of the counter over the range set by the option, like
+// matrix.WithRangeAsVariable("$__rate_interval").
+func (c Counter) Range(rangeOpt matrix.Option, matchers ...*labels.Matcher) *matrix.Builder {
+	return Metadata(c).rangeSelector(rangeOpt, matchers)
+}
+
+// Rate returns the per-second rate of the counter.
+func (c Counter) Rate(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Rate(c.Range(rangeOpt, matchers...))
+}
+
+// IRate returns the per-second rate of the counter computed from the last two samples of the range.
+func (c Counter) IRate(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.IRate(c.Range(rangeOpt, matchers...))
+}
+
+// Increase returns the increase of the counter over the range.
+func (c Counter) Increase(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Increase(c.Range(rangeOpt, matchers...))
+}
+
+// Resets returns the number of times the counter was reset over the range.
+func (c Counter) Resets(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Resets(c.Range(rangeOpt, matchers...))
+}
+
+// Gauge is a value that can go up and down.
+type Gauge Metadata
+
+// Label returns a builder for a matcher on a label of the gauge.
+func (g Gauge) Label(name string) *label.Builder {
+	return Metadata(g).label(name)
+}
+
+// Selector returns the instant vector selector of the gauge.
+func (g Gauge) Selector(matchers ...*labels.Matcher) *parser.VectorSelector {
+	return Metadata(g).selector(matchers)
+}
+
+// Range returns the range vector selector of the gauge over the range set by the option.
+func (g Gauge) Range(rangeOpt matrix.Option, matchers ...*labels.Matcher) *matrix.Builder {
+	return Metadata(g).rangeSelector(rangeOpt, matchers)
+}
+
+// Deriv returns the per-second derivative of the gauge, computed with a linear regression.
+func (g Gauge) Deriv(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Deriv(g.Range(rangeOpt, matchers...))
+}
+
+// Delta returns the difference between the first and the last value of the gauge over the range.
+func (g Gauge) Delta(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Delta(g.Range(rangeOpt, matchers...))
+}
+
+// PredictLinear predicts the value of the gauge in the given number of seconds, with a linear regression.
+func (g Gauge) PredictLinear(rangeOpt matrix.Option, seconds float64, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.PredictLinear(g.Range(rangeOpt, matchers...), seconds)
+}
+
+// Changes returns the number of times the gauge changed over the range.
+func (g Gauge) Changes(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.Changes(g.Range(rangeOpt, matchers...))
+}
+
+// AvgOverTime returns the average value of the gauge over the range.
+func (g Gauge) AvgOverTime(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.AvgOverTime(g.Range(rangeOpt, matchers...))
+}
+
+// MinOverTime returns the minimum value of the gauge over the range.
+func (g Gauge) MinOverTime(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.MinOverTime(g.Range(rangeOpt, matchers...))
+}
+
+// MaxOverTime returns the maximum value of the gauge over the range.
+func (g Gauge) MaxOverTime(rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.MaxOverTime(g.Range(rangeOpt, matchers...))
+}
+
+// QuantileOverTime returns the given quantile of the values of the gauge over the range.
+func (g Gauge) QuantileOverTime(quantile float64, rangeOpt matrix.Option, matchers ...*labels.Matcher) *parser.Call {
+	return promqlbuilder.QuantileOverTime(quantile, g.Range(rangeOpt, matchers...))
+}
+
+// Histogram is a distribution of observations, Name being the base name of the histogram, without the suffix
+// _bucket. The queries are built with the histogram package, so they work with classic and native histograms.
+type Histogram Metadata
+
+// Label returns a builder for a matcher on a label of the histogram.
+func (h Histogram) Label(name string) *label.Builder {
+	return Metadata(h).label(name)
+}
+
+// Query returns the builder of the queries on the histogram, see histogram.New.
+func (h Histogram) Query(options ...histogram.Option) *histogram.Builder {
+	return histogram.New(h.Name, options...)
+}
+
+// Quantile returns the estimated quantile of the observations, like histogram_quantile(0.9, ...).
+func (h Histogram) Quantile(quantile float64, options ...histogram.Option) parser.Expr {
+	return h.Query(options...).Quantile(quantile)
+}
+
+// Average returns the average value of the observations.
+func (h Histogram) Average(options ...histogram.Option) parser.Expr {
+	return h.Query(options...).Average()
+}
+
+// FractionBelow returns the fraction of the observations below or equal to the threshold.
+func (h Histogram) FractionBelow(threshold float64, options ...histogram.Option) parser.Expr {
+	return h.Query(options...).FractionBelow(threshold)
+}
+
+// Buckets returns the counter of the classic histogram buckets, the series foo_bucket.
+func (h Histogram) Buckets() Counter {
+	return Counter(Metadata(h).withSuffix("_bucket", "le"))
+}
+
+// Count returns the counter of the observations of the classic histogram, the series foo_count.
+func (h Histogram) Count() Counter {
+	return Counter(Metadata(h).withSuffix("_count"))
+}
+
+// Sum returns the counter of the sum of the observations of the classic histogram, the series foo_sum.
+func (h Histogram) Sum() Counter {
+	return Counter(Metadata(h).withSuffix("_sum"))
+}
+
+// Summary is a distribution of observations with quantiles computed by the client, Name being its base name.
+// The quantiles cannot be aggregated across series, only the count and the sum can.
+type Summary Metadata
+
+// Label returns a builder for a matcher on a label of the summary.
+func (s Summary) Label(name string) *label.Builder {
+	return Metadata(s).label(name)
+}
+
+// Quantile returns the selector of the given quantile computed by the client, like foo{quantile="0.99"}.
+func (s Summary) Quantile(quantile float64, matchers ...*labels.Matcher) *parser.VectorSelector {
+	q := label.New("quantile").Equal(labels.FormatOpenMetricsFloat(quantile))
+	return Metadata(s).selector(append([]*labels.Matcher{q}, matchers...))
+}
+
+// Count returns the counter of the observations of the summary, the series foo_count.
+func (s Summary) Count() Counter {
+	return Counter(Metadata(s).withSuffix("_count"))
+}
+
+// Sum returns the counter of the sum of the observations of the summary, the series foo_sum.
+func (s Summary) Sum() Counter {
+	return Counter(Metadata(s).withSuffix("_sum"))
+}
+
+// Average returns the average value of the observations, the rate of the sum divided by the rate of the count.
+func (s Summary) Average(rangeOpt matrix.Option, matchers ...*labels.Matcher) *promqlbuilder.BinaryBuilder {
+	return promqlbuilder.Div(s.Sum().Rate(rangeOpt, matchers...), s.Count().Rate(rangeOpt, matchers...))
+}
+
+// Info exposes textual information as labels of a series always equal to 1, like build_info.
+type Info Metadata
+
+// Label returns a builder for a matcher on a label of the info metric.
+func (i Info) Label(name string) *label.Builder {
+	return Metadata(i).label(name)
+}
+
+// Selector returns the instant vector selector of the info metric.
+func (i Info) Selector(matchers ...*labels.Matcher) *parser.VectorSelector {
+	return Metadata(i).selector(matchers)
+}
+
+// Enrich adds the given labels of the info metric to the series of the expression, joining them on the labels
+// identifying the target, like "expr * on (job, instance) group_left (version) build_info".
+func (i Info) Enrich(expr parser.Expr, on []string, include ...string) *promqlbuilder.BinaryWithVectorMatching {
+	return promqlbuilder.Mul(expr, i.Selector()).On(on...).GroupLeft(include...)
+}
@@ -0,0 +1,107 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"testing"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/histogram"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	httpRequests = Counter{Name: "http_requests_total", Labels: []string{"code", "job"}}
+	memory       = Gauge{Name: "process_resident_memory_bytes"}
+	duration     = Histogram{Name: "http_request_duration_seconds", Labels: []string{"job"}}
+	rpcDuration  = Summary{Name: "rpc_duration_seconds"}
+	build        = Info{Name: "build_info"}
+	rateInterval = matrix.WithRangeAsVariable("$__rate_interval")
+)
+
+func TestOperations(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		expected string
+	}{
+		{
+			name:     "counter rate",
+			expr:     httpRequests.Rate(rateInterval, httpRequests.Label("code").EqualRegexp("5..")),
+			expected: `rate(http_requests_total{code=~"5.."}[$__rate_interval])`,
+		},
+		{
+			name:     "counter increase",
+			expr:     promqlbuilder.Sum(httpRequests.Increase(matrix.WithRangeAsString("1h"))).By("job"),
+			expected: `sum by (job) (increase(http_requests_total[1h]))`,
+		},
+		{
+			name:     "gauge deriv",
+			expr:     memory.Deriv(matrix.WithRangeAsString("10m")),
+			expected: `deriv(process_resident_memory_bytes[10m])`,
+		},
+		{
+			name:     "gauge predict_linear",
+			expr:     memory.PredictLinear(matrix.WithRangeAsString("1h"), 3600),
+			expected: `predict_linear(process_resident_memory_bytes[1h], 3600)`,
+		},
+		{
+			name:     "gauge quantile_over_time",
+			expr:     memory.QuantileOverTime(0.9, matrix.WithRangeAsString("1h")),
+			expected: `quantile_over_time(0.9, process_resident_memory_bytes[1h])`,
+		},
+		{
+			name:     "histogram quantile",
+			expr:     duration.Quantile(0.99, histogram.WithGrouping("job"), histogram.WithLabelMatchers(duration.Label("job").Equal("api"))),
+			expected: `histogram_quantile(0.99, sum by (le, job) (rate(http_request_duration_seconds_bucket{job="api"}[5m])))`,
+		},
+		{
+			name:     "histogram count",
+			expr:     duration.Count().Rate(rateInterval),
+			expected: `rate(http_request_duration_seconds_count[$__rate_interval])`,
+		},
+		{
+			name:     "summary quantile",
+			expr:     rpcDuration.Quantile(0.5),
+			expected: `rpc_duration_seconds{quantile="0.5"}`,
+		},
+		{
+			name:     "summary average",
+			expr:     rpcDuration.Average(matrix.WithRangeAsString("5m")),
+			expected: `rate(rpc_duration_seconds_sum[5m]) / rate(rpc_duration_seconds_count[5m])`,
+		},
+		{
+			name:     "info enrich",
+			expr:     build.Enrich(memory.Selector(), []string{"job", "instance"}, "version"),
+			expected: `process_resident_memory_bytes * on (job, instance) group_left (version) build_info`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+		})
+	}
+}
+
+func TestLabel(t *testing.T) {
+	assert.Equal(t, `code="200"`, httpRequests.Label("code").Equal("200").String())
+	assert.Equal(t, `foo="bar"`, memory.Label("foo").Equal("bar").String())
+	assert.Equal(t, `le="0.5"`, duration.Buckets().Label("le").Equal("0.5").String())
+	assert.PanicsWithValue(t, `metric "http_requests_total" has no label "status", known labels are [code job]`, func() {
+		httpRequests.Label("status")
+	})
+	assert.Panics(t, func() { duration.Count().Label("le") })
+}
@@ -0,0 +1,372 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"math"
+	"slices"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// OptimizationRule is a rewrite applied by Optimize.
+type OptimizationRule string
+
+const (
+	// RedundantParens removes the parentheses that do not change how the expression is evaluated,
+	// like in "sum((foo))" or "a + (b * c)".
+	RedundantParens OptimizationRule = "redundant_parens"
+	// IdentityArithmetic removes the operations without effect, like "x * 1" or "x + 0",
+	// when x does not carry a metric name (which the operation would drop).
+	IdentityArithmetic OptimizationRule = "identity_arithmetic"
+	// DuplicateMatchers removes the label matchers appearing more than once in a vector selector.
+	DuplicateMatchers OptimizationRule = "duplicate_matchers"
+	// ConstantFolding computes the binary operations between two numbers, like "60 * 60".
+	ConstantFolding OptimizationRule = "constant_folding"
+	// NestedAggregations collapses two nested sum, min, max or group aggregations,
+	// like "sum by (a) (sum by (a, b) (x))" into "sum by (a) (x)".
+	NestedAggregations OptimizationRule = "nested_aggregations"
+)
+
+// OptimizationRules is the list of all rules applied by Optimize by default.
+var OptimizationRules = []OptimizationRule{
+	RedundantParens,
+	IdentityArithmetic,
+	DuplicateMatchers,
+	ConstantFolding,
+	NestedAggregations,
+}
+
+type OptimizeOption func(o *optimizer)
+
+// WithOptimizationRules restricts Optimize to the given rules.
+func WithOptimizationRules(rules ...OptimizationRule) OptimizeOption {
+	return func(o *optimizer) {
+		o.enabled = map[OptimizationRule]bool{}
+		for _, rule := range rules {
+			o.enabled[rule] = true
+		}
+	}
+}
+
+// WithoutOptimizationRules disables the given rules.
+func WithoutOptimizationRules(rules ...OptimizationRule) OptimizeOption {
+	return func(o *optimizer) {
+		for _, rule := range rules {
+			delete(o.enabled, rule)
+		}
+	}
+}
+
+// Optimize returns a simplified copy of the expression, evaluating to the same result.
+// By default, all the OptimizationRules are applied. The given expression is not modified.
+func Optimize(expr parser.Expr, opts ...OptimizeOption) parser.Expr {
+	result, _ := OptimizeWithReport(expr, opts...)
+	return result
+}
+
+// OptimizeWithReport is like Optimize but also returns the rules that modified the expression,
+// in the order of OptimizationRules.
+func OptimizeWithReport(expr parser.Expr, opts ...OptimizeOption) (parser.Expr, []OptimizationRule) {
+	o := &optimizer{
+		enabled: map[OptimizationRule]bool{},
+		fired:   map[OptimizationRule]bool{},
+	}
+	for _, rule := range OptimizationRules {
+		o.enabled[rule] = true
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// The optimizer never returns an error, so rewrite cannot fail.
+	result, _ := rewrite(DeepCopyExpr(expr), func(node parser.Expr) (parser.Expr, error) {
+		return o.optimize(node), nil
+	})
+	if paren, ok := result.(*parser.ParenExpr); ok && o.apply(RedundantParens) {
+		result = paren.Expr
+	}
+	var fired []OptimizationRule
+	for _, rule := range OptimizationRules {
+		if o.fired[rule] {
+			fired = append(fired, rule)
+		}
+	}
+	return result, fired
+}
+
+type optimizer struct {
+	enabled map[OptimizationRule]bool
+	fired   map[OptimizationRule]bool
+}
+
+// apply returns true if the rule is enabled, and records it as fired.
+// It must only be called once the rule is known to modify the expression.
+func (o *optimizer) apply(rule OptimizationRule) bool {
+	if !o.enabled[rule] {
+		return false
+	}
+	o.fired[rule] = true
+	return true
+}
+
+// optimize is called on every node, once its children are optimized.
+func (o *optimizer) optimize(node parser.Expr) parser.Expr {
+	o.removeParens(node)
+	switch n := node.(type) {
+	case *parser.VectorSelector:
+		o.removeDuplicateMatchers(n)
+	case *parser.UnaryExpr:
+		if number, ok := n.Expr.(*parser.NumberLiteral); ok && o.apply(ConstantFolding) {
+			if n.Op == parser.SUB {
+				return NewNumber(-number.Val)
+			}
+			return number
+		}
+	}
+	if b := BinaryExprOf(node); b != nil {
+		return o.optimizeBinary(node, b)
+	}
+	if a := AggregateExprOf(node); a != nil {
+		o.collapseAggregations(a)
+	}
+	return node
+}
+
+// removeParens removes the parentheses around the children of the node when they are not needed.
+func (o *optimizer) removeParens(node parser.Expr) {
+	children := Children(node)
+	changed := false
+	for i, child := range children {
+		paren, ok := child.(*parser.ParenExpr)
+		if !ok || !parensAreRedundant(node, i, paren.Expr) || !o.apply(RedundantParens) {
+			continue
+		}
+		children[i] = paren.Expr
+		changed = true
+	}
+	if changed {
+		// The children are expressions of the right kind, as they were inside the parentheses.
+		_ = setChildren(node, children)
+	}
+}
+
+// parensAreRedundant returns true if the expression can be written without parentheses as the i-th child of parent.
+func parensAreRedundant(parent parser.Expr, i int, expr parser.Expr) bool {
+	inner := BinaryExprOf(expr)
+	_, isUnary := expr.(*parser.UnaryExpr)
+	if inner == nil && !isUnary {
+		return true
+	}
+	switch parent.(type) {
+	case *parser.Call, *parser.AggregateExpr, *AggregationBuilder, *parser.ParenExpr:
+		return true
+	}
+	outer := BinaryExprOf(parent)
+	if outer == nil || inner == nil {
+		return false
+	}
+	innerPrecedence, outerPrecedence := precedence(inner.Op), precedence(outer.Op)
+	if innerPrecedence != outerPrecedence {
+		return innerPrecedence > outerPrecedence
+	}
+	// With the same precedence, the parentheses are only implied on the side of the associativity.
+	if isRightAssociative(outer.Op) {
+		return i == 1 && isRightAssociative(inner.Op)
+	}
+	return i == 0 && !isRightAssociative(inner.Op)
+}
+
+func (o *optimizer) removeDuplicateMatchers(vs *parser.VectorSelector) {
+	matchers := vs.LabelMatchers[:0]
+	for _, m := range vs.LabelMatchers {
+		duplicated := slices.ContainsFunc(matchers, func(other *labels.Matcher) bool {
+			return other.Type == m.Type && other.Name == m.Name && other.Value == m.Value
+		})
+		if duplicated && o.apply(DuplicateMatchers) {
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	vs.LabelMatchers = matchers
+}
+
+func (o *optimizer) optimizeBinary(node parser.Expr, b *parser.BinaryExpr) parser.Expr {
+	lhs, lhsIsNumber := b.LHS.(*parser.NumberLiteral)
+	rhs, rhsIsNumber := b.RHS.(*parser.NumberLiteral)
+	if lhsIsNumber && rhsIsNumber {
+		if result, ok := foldNumbers(b.Op, lhs.Val, rhs.Val, b.ReturnBool); ok && o.apply(ConstantFolding) {
+			return NewNumber(result)
+		}
+		return node
+	}
+	if b.VectorMatching != nil && hasVectorMatchingKeyword(b.VectorMatching) {
+		return node
+	}
+	if rhsIsNumber && isIdentity(b.Op, rhs.Val, false) && !carriesMetricName(b.LHS) && o.apply(IdentityArithmetic) {
+		return b.LHS
+	}
+	if lhsIsNumber && isIdentity(b.Op, lhs.Val, true) && !carriesMetricName(b.RHS) && o.apply(IdentityArithmetic) {
+		return b.RHS
+	}
+	return node
+}
+
+// foldNumbers computes the operation between two numbers, as Prometheus would do it.
+func foldNumbers(op parser.ItemType, lhs, rhs float64, returnBool bool) (float64, bool) {
+	switch op {
+	case parser.ADD:
+		return lhs + rhs, true
+	case parser.SUB:
+		return lhs - rhs, true
+	case parser.MUL:
+		return lhs * rhs, true
+	case parser.DIV:
+		return lhs / rhs, true
+	case parser.MOD:
+		return math.Mod(lhs, rhs), true
+	case parser.POW:
+		return math.Pow(lhs, rhs), true
+	case parser.ATAN2:
+		return math.Atan2(lhs, rhs), true
+	}
+	if !op.IsComparisonOperator() || !returnBool {
+		return 0, false
+	}
+	var result bool
+	switch op {
+	case parser.EQLC:
+		result = lhs == rhs
+	case parser.NEQ:
+		result = lhs != rhs
+	case parser.GTR:
+		result = lhs > rhs
+	case parser.LSS:
+		result = lhs < rhs
+	case parser.GTE:
+		result = lhs >= rhs
+	case parser.LTE:
+		result = lhs <= rhs
+	default:
+		return 0, false
+	}
+	if result {
+		return 1, true
+	}
+	return 0, true
+}
+
+// isIdentity returns true if the number is the identity element of the operation, on the given side.
+func isIdentity(op parser.ItemType, value float64, left bool) bool {
+	switch op {
+	case parser.ADD:
+		return value == 0
+	case parser.SUB:
+		return value == 0 && !left
+	case parser.MUL:
+		return value == 1
+	case parser.DIV, parser.POW:
+		return value == 1 && !left
+	default:
+		return false
+	}
+}
+
+// carriesMetricName returns true if the result of the expression may have a metric name.
+// An arithmetic operation drops the metric name, so it can only be removed when there is none.
+func carriesMetricName(expr parser.Expr) bool {
+	if t := typeOf(expr); t == parser.ValueTypeScalar {
+		return false
+	}
+	if b := BinaryExprOf(expr); b != nil {
+		return b.Op.IsComparisonOperator() && !b.ReturnBool || b.Op.IsSetOperator()
+	}
+	if a := AggregateExprOf(expr); a != nil {
+		switch a.Op {
+		case parser.TOPK, parser.BOTTOMK, parser.LIMITK, parser.LIMIT_RATIO:
+			return carriesMetricName(a.Expr)
+		default:
+			return false
+		}
+	}
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return carriesMetricName(e.Expr)
+	case *parser.UnaryExpr:
+		return carriesMetricName(e.Expr)
+	case *parser.Call:
+		switch e.Func.Name {
+		case "last_over_time", "first_over_time", "sort", "sort_desc", "sort_by_label", "sort_by_label_desc",
+			"label_replace", "label_join", "info":
+			return true
+		}
+		_, known := parser.Functions[e.Func.Name]
+		return !known
+	default:
+		return true
+	}
+}
+
+// collapseAggregations merges an aggregation with the aggregation it wraps, when they are both sum, min, max or group
+// and the outer grouping only keeps labels kept by the inner one.
+func (o *optimizer) collapseAggregations(outer *parser.AggregateExpr) {
+	inner := AggregateExprOf(outer.Expr)
+	if inner == nil || inner.Op != outer.Op || outer.Param != nil || inner.Param != nil {
+		return
+	}
+	switch outer.Op {
+	case parser.SUM, parser.MIN, parser.MAX, parser.GROUP:
+	default:
+		return
+	}
+	var grouping []string
+	without := outer.Without
+	switch {
+	case !outer.Without && !inner.Without:
+		for _, l := range outer.Grouping {
+			if !slices.Contains(inner.Grouping, l) {
+				return
+			}
+		}
+		grouping = outer.Grouping
+	case !outer.Without && inner.Without:
+		for _, l := range outer.Grouping {
+			if slices.Contains(inner.Grouping, l) {
+				return
+			}
+		}
+		grouping = outer.Grouping
+	case outer.Without && inner.Without:
+		grouping = slices.Clone(inner.Grouping)
+		for _, l := range outer.Grouping {
+			if !slices.Contains(grouping, l) {
+				grouping = append(grouping, l)
+			}
+		}
+	default:
+		// Only the labels kept by the inner aggregation and not removed by the outer one remain.
+		without = false
+		for _, l := range inner.Grouping {
+			if !slices.Contains(outer.Grouping, l) {
+				grouping = append(grouping, l)
+			}
+		}
+	}
+	if !o.apply(NestedAggregations) {
+		return
+	}
+	outer.Without = without
+	outer.Grouping = grouping
+	outer.Expr = inner.Expr
+}
@@ -0,0 +1,175 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/vector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimize(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		query    string
+		expected string
+		fired    []OptimizationRule
+	}{
+		{
+			name:     "nothing to do",
+			query:    "sum by (a) (rate(foo[5m]))",
+			expected: "sum by (a) (rate(foo[5m]))",
+		},
+		{
+			name:     "nested parens",
+			query:    "sum(((foo)))",
+			expected: "sum(foo)",
+			fired:    []OptimizationRule{RedundantParens},
+		},
+		{
+			name:     "parens at the root",
+			query:    "(foo + bar)",
+			expected: "foo + bar",
+			fired:    []OptimizationRule{RedundantParens},
+		},
+		{
+			name:     "parens around a higher precedence operation",
+			query:    "a + (b * c) - (d - e) + (f - g)",
+			expected: "a + b * c - (d - e) + (f - g)",
+			fired:    []OptimizationRule{RedundantParens},
+		},
+		{
+			name:     "parens kept with the same precedence on the left side",
+			query:    "(a - b) - c",
+			expected: "a - b - c",
+			fired:    []OptimizationRule{RedundantParens},
+		},
+		{
+			name:     "parens with right associative power",
+			query:    "(a ^ b) ^ (c ^ d)",
+			expected: "(a ^ b) ^ c ^ d",
+			fired:    []OptimizationRule{RedundantParens},
+		},
+		{
+			name:     "parens kept in subquery and unary expression",
+			query:    "-(a + b) + max_over_time((a + b)[5m:])",
+			expected: "-(a + b) + max_over_time((a + b)[5m:])",
+		},
+		{
+			name:     "identity arithmetic without metric name",
+			query:    "sum(rate(foo[5m])) * 1 + 0",
+			expected: "sum(rate(foo[5m]))",
+			fired:    []OptimizationRule{IdentityArithmetic},
+		},
+		{
+			name:     "identity arithmetic kept because of the metric name",
+			query:    "foo * 1",
+			expected: "foo * 1",
+		},
+		{
+			name:     "identity arithmetic on the left side",
+			query:    "1 * rate(foo[5m]) / 1",
+			expected: "rate(foo[5m])",
+			fired:    []OptimizationRule{IdentityArithmetic},
+		},
+		{
+			name:     "subtraction from zero is not an identity",
+			query:    "0 - rate(foo[5m])",
+			expected: "0 - rate(foo[5m])",
+		},
+		{
+			name:     "constant folding",
+			query:    "rate(foo[5m]) * (60 * 60) > bool (-1)",
+			expected: "rate(foo[5m]) * 3600 > bool -1",
+			fired:    []OptimizationRule{RedundantParens, ConstantFolding},
+		},
+		{
+			name:     "constant folding with comparison",
+			query:    "1 > bool 2",
+			expected: "0",
+			fired:    []OptimizationRule{ConstantFolding},
+		},
+		{
+			name:     "constant folding enabling identity",
+			query:    "sum(foo) * (2 - 1)",
+			expected: "sum(foo)",
+			fired:    []OptimizationRule{RedundantParens, IdentityArithmetic, ConstantFolding},
+		},
+		{
+			name:     "duplicate matchers",
+			query:    `foo{a="1", b=~"2", a="1", a!="1"}`,
+			expected: `foo{a!="1",a="1",b=~"2"}`,
+			fired:    []OptimizationRule{DuplicateMatchers},
+		},
+		{
+			name:     "nested sum by",
+			query:    "sum by (a) (sum by (a, b) (foo))",
+			expected: "sum by (a) (foo)",
+			fired:    []OptimizationRule{NestedAggregations},
+		},
+		{
+			name:     "nested sum without",
+			query:    "max without (a) (max without (b) (foo))",
+			expected: "max without (b, a) (foo)",
+			fired:    []OptimizationRule{NestedAggregations},
+		},
+		{
+			name:     "nested by and without",
+			query:    "sum by (a) (sum without (b) (foo))",
+			expected: "sum by (a) (foo)",
+			fired:    []OptimizationRule{NestedAggregations},
+		},
+		{
+			name:     "nested without and by",
+			query:    "min without (b) (min by (a, b) (foo))",
+			expected: "min by (a) (foo)",
+			fired:    []OptimizationRule{NestedAggregations},
+		},
+		{
+			name:     "nested aggregations with incompatible grouping",
+			query:    "sum by (a, b) (sum by (a) (foo))",
+			expected: "sum by (a, b) (sum by (a) (foo))",
+		},
+		{
+			name:     "nested count cannot be collapsed",
+			query:    "count(count by (a) (foo))",
+			expected: "count(count by (a) (foo))",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			expr := MustParse(test.query)
+			result, fired := OptimizeWithReport(expr)
+			assert.Equal(t, test.expected, result.String())
+			assert.Equal(t, test.fired, fired)
+			assert.NoError(t, Validate(result))
+		})
+	}
+}
+
+func TestOptimizeBuiltExpression(t *testing.T) {
+	foo := vector.New(
+		vector.WithMetricName("foo"),
+		vector.WithLabelMatchers(label.New("a").Equal("1"), label.New("a").Equal("1")),
+	)
+	expr := Sum(Parenthesis(Sum(foo).By("a", "b"))).By("a")
+	assert.Equal(t, `sum by (a) (foo{a="1"})`, Optimize(expr).String())
+	assert.Equal(t, `sum by (a) (sum by (a, b) (foo{a="1",a="1"}))`,
+		Optimize(expr, WithOptimizationRules(RedundantParens)).String())
+	assert.Equal(t, `sum by (a) ((sum by (a, b) (foo{a="1"})))`,
+		Optimize(expr, WithoutOptimizationRules(RedundantParens)).String())
+	assert.Equal(t, `sum by (a) ((sum by (a, b) (foo{a="1",a="1"})))`, expr.String())
+}
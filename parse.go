@@ -0,0 +1,289 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// promqlParser is the Prometheus parser used by Parse. It accepts every function and modifier that can be built
+// with this library.
+var promqlParser = parser.NewParser(parser.Options{
+	EnableExperimentalFunctions: true,
+	EnableBinopFillModifiers:    true,
+})
+
+// variableRegexp matches a dashboard variable reference at the beginning of a string.
+var variableRegexp = regexp.MustCompile("^" + variable.Pattern)
+
+// unitRegexp matches a duration unit at the beginning of a string, like the one following "${__range_s}s".
+var unitRegexp = regexp.MustCompile("^(?:ms|[smhdwy])")
+
+// variableKind is where a variable is used in a query.
+type variableKind int
+
+const (
+	numberVariable variableKind = iota
+	rangeVariable
+	stepVariable
+	offsetVariable
+)
+
+// variableRef is a dashboard variable found in a query, outside any string literal.
+type variableRef struct {
+	name  string
+	start int
+	end   int
+	kind  variableKind
+}
+
+// Parse parses a PromQL expression and returns it as a tree of promqlbuilder nodes:
+// aggregations are returned as *AggregationBuilder, binary operations as *BinaryBuilder
+// (or *BinaryWithVectorMatching when they use a vector matching keyword) and range vectors as *matrix.Builder.
+// The builder methods like By, On or GroupLeft can then be used to modify the parsed query.
+//
+// Unlike the Prometheus parser, Parse accepts dashboard variables like "$__rate_interval":
+//   - as range of a range vector, using *matrix.Builder,
+//   - as range, step or offset of a subquery, using *subquery.VariableBuilder,
+//   - as offset of a vector selector, using *vector.VariableBuilder,
+//   - in place of a number, using *variable.Expr.
+//
+// A variable used as a duration can be followed by a unit, like "${__range_s}s", which is kept with the variable.
+// Variables inside label matchers and string literals are kept as is.
+func Parse(query string) (parser.Expr, error) {
+	sanitized, vars := replaceVariables(query)
+	expr, err := promqlParser.ParseExpr(sanitized)
+	if err != nil {
+		return nil, err
+	}
+	imp := &importer{vars: vars, used: make([]bool, len(vars))}
+	result := imp.convert(expr)
+	for i, v := range vars {
+		if !imp.used[i] {
+			return nil, fmt.Errorf("variable %q at position %d is not supported at this place", v.name, v.start)
+		}
+	}
+	return result, nil
+}
+
+// MustParse is like Parse but panics if the query cannot be parsed.
+func MustParse(query string) parser.Expr {
+	expr, err := Parse(query)
+	if err != nil {
+		panic(err)
+	}
+	return expr
+}
+
+// replaceVariables replaces every variable found outside string literals with a duration or a number of the same
+// length, so the query can be handled by the Prometheus parser and the position of each node remains unchanged.
+// A variable used as a duration and followed by a unit, like "${__range_s}s", is replaced by a number so that the unit
+// completes the duration, and the unit is kept in the name of the variable.
+func replaceVariables(query string) (string, []variableRef) {
+	var vars []variableRef
+	var b strings.Builder
+	inBrackets := false
+	afterColon := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch c {
+		case '"', '\'', '`':
+			end := endOfString(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			continue
+		case '#':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case '[':
+			inBrackets, afterColon = true, false
+		case ']':
+			inBrackets = false
+		case ':':
+			afterColon = inBrackets
+		case '$':
+			if name := variableRegexp.FindString(query[i:]); len(name) > 0 {
+				ref := variableRef{name: name, start: i, end: i + len(name)}
+				switch {
+				case inBrackets && afterColon:
+					ref.kind = stepVariable
+				case inBrackets:
+					ref.kind = rangeVariable
+				case strings.EqualFold(lastWord(query[:i]), "offset"):
+					ref.kind = offsetVariable
+				default:
+					ref.kind = numberVariable
+				}
+				unit := ""
+				if ref.kind != numberVariable {
+					unit = unitRegexp.FindString(query[ref.end:])
+				}
+				ref.name += unit
+				ref.end += len(unit)
+				vars = append(vars, ref)
+				if ref.kind == numberVariable || len(unit) > 0 {
+					b.WriteString(strings.Repeat("0", len(name)-1) + "1" + unit)
+				} else {
+					b.WriteString(strings.Repeat("0", len(name)-2) + "1s")
+				}
+				i = ref.end - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), vars
+}
+
+// lastWord returns the last word of the given string, ignoring the trailing spaces.
+func lastWord(s string) string {
+	s = strings.TrimRight(s, " \t\n\r")
+	i := strings.LastIndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	return s[i+1:]
+}
+
+// endOfString returns the position right after the string literal starting at the given position.
+func endOfString(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// importer converts a tree returned by the Prometheus parser into a tree of promqlbuilder nodes.
+type importer struct {
+	vars []variableRef
+	used []bool
+}
+
+// variableBetween returns the variable of the given kind located in the range [start, end) of the query.
+func (imp *importer) variableBetween(kind variableKind, start, end int) string {
+	for i, v := range imp.vars {
+		if v.kind == kind && !imp.used[i] && v.start >= start && v.end <= end {
+			imp.used[i] = true
+			return v.name
+		}
+	}
+	return ""
+}
+
+func (imp *importer) convert(expr parser.Expr) parser.Expr {
+	switch e := expr.(type) {
+	case *parser.AggregateExpr:
+		e.Expr = imp.convert(e.Expr)
+		if e.Param != nil {
+			e.Param = imp.convert(e.Param)
+		}
+		return &AggregationBuilder{internal: e}
+	case *parser.BinaryExpr:
+		e.LHS = imp.convert(e.LHS)
+		e.RHS = imp.convert(e.RHS)
+		b := &BinaryBuilder{internal: e}
+		if hasVectorMatchingKeyword(e.VectorMatching) {
+			return &BinaryWithVectorMatching{binaryOpt: b}
+		}
+		return b
+	case *parser.Call:
+		for i, arg := range e.Args {
+			e.Args[i] = imp.convert(arg)
+		}
+		return e
+	case *parser.MatrixSelector:
+		b := &matrix.Builder{InternalMatrix: e}
+		vs := e.VectorSelector.(*parser.VectorSelector)
+		start, end := int(vs.PosRange.End), int(e.EndPos)
+		if b.RangeAsVariable = imp.variableBetween(rangeVariable, start, end); len(b.RangeAsVariable) > 0 {
+			e.Range = 0
+		}
+		if b.OffsetAsVariable = imp.variableBetween(offsetVariable, start, end); len(b.OffsetAsVariable) > 0 {
+			vs.OriginalOffset = 0
+		}
+		return b
+	case *parser.VectorSelector:
+		offset := imp.variableBetween(offsetVariable, int(e.PosRange.Start), int(e.PosRange.End))
+		if len(offset) == 0 {
+			return e
+		}
+		e.OriginalOffset = 0
+		return vector.NewWithVariables(e, vector.WithOffsetAsVariable(offset))
+	case *parser.SubqueryExpr:
+		e.Expr = imp.convert(e.Expr)
+		start, end := int(e.Expr.PositionRange().End), int(e.EndPos)
+		b := subquery.NewWithVariables(e)
+		if b.RangeAsVariable = imp.variableBetween(rangeVariable, start, end); len(b.RangeAsVariable) > 0 {
+			e.Range = 0
+		}
+		if b.StepAsVariable = imp.variableBetween(stepVariable, start, end); len(b.StepAsVariable) > 0 {
+			e.Step = 0
+		}
+		if b.OffsetAsVariable = imp.variableBetween(offsetVariable, start, end); len(b.OffsetAsVariable) > 0 {
+			e.OriginalOffset = 0
+		}
+		if len(b.RangeAsVariable) == 0 && len(b.StepAsVariable) == 0 && len(b.OffsetAsVariable) == 0 {
+			return e
+		}
+		return b
+	case *parser.NumberLiteral:
+		if name := imp.variableBetween(numberVariable, int(e.PosRange.Start), int(e.PosRange.End)); len(name) > 0 {
+			return variable.New(name)
+		}
+		return e
+	case *parser.ParenExpr:
+		e.Expr = imp.convert(e.Expr)
+		return e
+	case *parser.UnaryExpr:
+		e.Expr = imp.convert(e.Expr)
+		return e
+	case *parser.StepInvariantExpr:
+		e.Expr = imp.convert(e.Expr)
+		return e
+	default:
+		return expr
+	}
+}
+
+// hasVectorMatchingKeyword returns true if the vector matching is using one of the keywords
+// on, ignoring, group_left, group_right or fill.
+func hasVectorMatchingKeyword(vm *parser.VectorMatching) bool {
+	if vm == nil {
+		return false
+	}
+	return vm.On || len(vm.MatchingLabels) > 0 ||
+		vm.Card == parser.CardManyToOne || vm.Card == parser.CardOneToMany ||
+		vm.FillValues.LHS != nil || vm.FillValues.RHS != nil
+}
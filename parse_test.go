@@ -0,0 +1,112 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	testSuite := []string{
+		"foo",
+		`foo{namespace="monitoring",podName=~"prom-.+"}`,
+		"foo[5d]",
+		"foo[$__rate_interval]",
+		"rate(foo[${__rate_interval}])",
+		`sum by (namespace) (rate(foo{job="$job"}[$__rate_interval])) - ignoring (podName) group_left (namespace) perses_info`,
+		`count_values("config_hash", alertmanager_config_hash)`,
+		"(time() - foo offset 1d) / 100",
+		`histogram_quantiles(rate(foo[5m]), "quantile", 0.5, 0.9, 0.99)`,
+		"topk(5, foo offset 5m)",
+		"max_over_time(sum(foo)[1h:5m])",
+		"sum(foo) / on (label) fill_left (0) bar",
+		"-foo",
+		"foo and bar",
+		"foo offset $offset",
+		"rate(foo[$__rate_interval] offset ${offset})",
+		"max_over_time(rate(foo[5m])[$__range:$__interval] offset $offset)",
+		"max_over_time(rate(foo[5m])[1h:$__interval])",
+		"topk($k, foo)",
+		`histogram_quantile($quantile, sum by (le) (rate(foo_bucket{namespace=~"${namespace:regex}"}[$__rate_interval])))`,
+		"foo * $__interval_ms",
+		"rate(foo[${__range_s}s])",
+		"max_over_time(rate(foo[5m])[${__range_s}s:${__interval_ms}ms] offset ${offset_m}m)",
+	}
+	for _, query := range testSuite {
+		t.Run(query, func(t *testing.T) {
+			expr, err := Parse(query)
+			require.NoError(t, err)
+			assert.Equal(t, query, expr.String())
+		})
+	}
+}
+
+func TestParseBuilderTypes(t *testing.T) {
+	expr := MustParse("sum(rate(foo[$__rate_interval]))")
+	agg, ok := expr.(*AggregationBuilder)
+	require.True(t, ok)
+	agg.By("namespace")
+	assert.Equal(t, "sum by (namespace) (rate(foo[$__rate_interval]))", agg.String())
+
+	var m *matrix.Builder
+	Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if b, ok := node.(*matrix.Builder); ok {
+			m = b
+		}
+		return nil
+	})
+	require.NotNil(t, m)
+	assert.Equal(t, "$__rate_interval", m.RangeAsVariable)
+
+	expr = MustParse("foo / bar")
+	binary, ok := expr.(*BinaryBuilder)
+	require.True(t, ok)
+	assert.Equal(t, "foo / on (job) group_left (namespace) bar", binary.On("job").GroupLeft("namespace").String())
+
+	expr = MustParse("foo / ignoring (code) bar")
+	matching, ok := expr.(*BinaryWithVectorMatching)
+	require.True(t, ok)
+	assert.Equal(t, "foo / ignoring (code) group_right () bar", matching.GroupRight().String())
+}
+
+func TestParseError(t *testing.T) {
+	testSuite := []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "invalid syntax",
+			query: "sum(foo",
+		},
+		{
+			name:  "variable as label name",
+			query: `foo{$label="bar"}`,
+		},
+		{
+			name:  "variable in an @ modifier",
+			query: "foo @ $time",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.query)
+			assert.Error(t, err)
+		})
+	}
+}
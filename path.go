@@ -0,0 +1,76 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// rootPath is the path of the root node of an expression.
+const rootPath = "$"
+
+// childPath returns the path of the i-th child (as returned by Children) of the given node.
+// Paths look like "$.expr.args[0]", where each element is the name of the field holding the child.
+func childPath(parentPath string, parent parser.Node, i int) string {
+	return parentPath + "." + childName(parent, i)
+}
+
+func childName(parent parser.Node, i int) string {
+	switch n := parent.(type) {
+	case *parser.AggregateExpr:
+		if i == 0 && n.Expr != nil {
+			return "expr"
+		}
+		return "param"
+	case *AggregationBuilder:
+		if i == 0 && n.internal.Expr != nil {
+			return "expr"
+		}
+		return "param"
+	case *parser.BinaryExpr, *BinaryBuilder, *BinaryWithVectorMatching:
+		if i == 0 {
+			return "lhs"
+		}
+		return "rhs"
+	case *parser.Call, parser.Expressions:
+		return fmt.Sprintf("args[%d]", i)
+	case *parser.MatrixSelector, *matrix.Builder, *vector.VariableBuilder:
+		return "vector"
+	default:
+		return "expr"
+	}
+}
+
+// NodePath returns the path of a node visited by Walk or Inspect, like "$.expr.args[0]", from the ancestors given to
+// the visitor. When a node has several identical children, the path of the first one is returned.
+func NodePath(ancestors []parser.Node, node parser.Node) string {
+	path := rootPath
+	for i, parent := range ancestors {
+		next := node
+		if i+1 < len(ancestors) {
+			next = ancestors[i+1]
+		}
+		for j, child := range Children(parent) {
+			if child == next {
+				path = childPath(path, parent, j)
+				break
+			}
+		}
+	}
+	return path
+}
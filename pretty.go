@@ -0,0 +1,142 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type PrettyOption func(p *prettier)
+
+// WithMaxLineWidth sets the length above which a node is split on several lines, 100 by default like Prometheus.
+func WithMaxLineWidth(width int) PrettyOption {
+	return func(p *prettier) {
+		p.maxLineWidth = width
+	}
+}
+
+// WithIndent sets the string used to indent each level, two spaces by default like Prometheus.
+func WithIndent(indent string) PrettyOption {
+	return func(p *prettier) {
+		p.indent = indent
+	}
+}
+
+type prettier struct {
+	maxLineWidth int
+	indent       string
+}
+
+var defaultPrettier = &prettier{maxLineWidth: 100, indent: "  "}
+
+// Pretty formats the expression on several lines when it is too long, like parser.Prettify.
+// The builder types are formatted like the nodes they wrap, so with the default options the result is the same as
+// the one of promtool when no dashboard variable is used.
+//
+// Taken from https://github.com/prometheus/prometheus/blob/v3.4.0/promql/parser/prettier.go
+// But adds handling cases for promqlbuilder node types.
+func Pretty(expr parser.Expr, opts ...PrettyOption) string {
+	p := *defaultPrettier
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p.pretty(expr, 0)
+}
+
+func (p *prettier) pretty(node parser.Node, level int) string {
+	switch n := node.(type) {
+	case *parser.AggregateExpr:
+		return p.prettyAggregation(n, level)
+	case *AggregationBuilder:
+		return p.prettyAggregation(n.internal, level)
+	case *parser.BinaryExpr:
+		return p.prettyBinary(n, level)
+	case *BinaryBuilder:
+		return p.prettyBinary(n.parenthesized(), level)
+	case *BinaryWithVectorMatching:
+		return p.prettyBinary(n.binaryOpt.parenthesized(), level)
+	case *parser.Call:
+		if !p.needsSplit(n) {
+			return p.indentation(level) + n.String()
+		}
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = p.pretty(arg, level+1)
+		}
+		return fmt.Sprintf("%s%s(\n%s\n%s)", p.indentation(level), n.Func.Name, strings.Join(args, ",\n"), p.indentation(level))
+	case *parser.ParenExpr:
+		if !p.needsSplit(n) {
+			return p.indentation(level) + n.String()
+		}
+		return fmt.Sprintf("%s(\n%s\n%s)", p.indentation(level), p.pretty(n.Expr, level+1), p.indentation(level))
+	case *parser.StepInvariantExpr:
+		return p.pretty(n.Expr, level)
+	case *parser.SubqueryExpr:
+		return p.prettySubquery(n, n.Expr, level)
+	case *subquery.VariableBuilder:
+		return p.prettySubquery(n, n.InternalSubquery.Expr, level)
+	case *parser.UnaryExpr:
+		// The indentation of the child is replaced by the one of the operator.
+		child := strings.TrimSpace(p.pretty(n.Expr, level))
+		return fmt.Sprintf("%s%s%s", p.indentation(level), n.Op, child)
+	case *parser.MatrixSelector, *matrix.Builder, *parser.VectorSelector, *vector.VariableBuilder,
+		*parser.NumberLiteral, *parser.StringLiteral, *variable.Expr:
+		return p.indentation(level) + node.String()
+	default:
+		return node.Pretty(level)
+	}
+}
+
+func (p *prettier) prettyAggregation(n *parser.AggregateExpr, level int) string {
+	if !p.needsSplit(n) {
+		return p.indentation(level) + n.String()
+	}
+	s := p.indentation(level) + n.ShortString() + "(\n"
+	if n.Op.IsAggregatorWithParam() {
+		s += p.pretty(n.Param, level+1) + ",\n"
+	}
+	return fmt.Sprintf("%s%s\n%s)", s, p.pretty(n.Expr, level+1), p.indentation(level))
+}
+
+func (p *prettier) prettyBinary(n *parser.BinaryExpr, level int) string {
+	if !p.needsSplit(n) {
+		return p.indentation(level) + n.String()
+	}
+	return fmt.Sprintf("%s\n%s%s\n%s", p.pretty(n.LHS, level+1), p.indentation(level), n.ShortString(), p.pretty(n.RHS, level+1))
+}
+
+// prettySubquery splits the expression of the subquery when needed. Like in Prometheus, a subquery that is not split
+// is not indented.
+func (p *prettier) prettySubquery(n parser.Expr, expr parser.Expr, level int) string {
+	if !p.needsSplit(n) {
+		return n.String()
+	}
+	timeSuffix := strings.TrimPrefix(n.String(), expr.String())
+	return p.pretty(expr, level) + timeSuffix
+}
+
+func (p *prettier) needsSplit(n parser.Node) bool {
+	return len(n.String()) > p.maxLineWidth
+}
+
+func (p *prettier) indentation(level int) string {
+	return strings.Repeat(p.indent, level)
+}
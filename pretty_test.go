@@ -0,0 +1,85 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrettyMatchesPrometheus(t *testing.T) {
+	queries := []string{
+		`up`,
+		`sum by (namespace, job, code) (rate(http_requests_total{code=~"5..",handler="query",job=~"thanos-query-example-query"}[5m])) / ignoring (code) group_left () sum by (namespace, job) (rate(http_requests_total{handler="query",job=~"thanos-query-example-query"}[5m]))`,
+		`topk(10, sum without (instance) (rate(node_network_receive_bytes_total{device!~"lo|veth.*",job="node-exporter"}[5m])))`,
+		`-(histogram_quantile(0.99, sum by (le) (rate(apiserver_request_duration_seconds_bucket{verb!~"WATCH|CONNECT",job="apiserver"}[5m]))))`,
+		`max_over_time(rate(container_cpu_usage_seconds_total{container!="",namespace="monitoring",pod=~"prometheus-.*"}[5m])[1h:1m] offset 1d)`,
+		`(node_memory_MemAvailable_bytes{job="node-exporter",instance="node-1"} / node_memory_MemTotal_bytes{job="node-exporter",instance="node-1"}) * 100 < bool 10`,
+		`label_replace(sum by (pod) (kube_pod_container_resource_requests{resource="memory",namespace="monitoring"}), "name", "$1", "pod", "(.*)")`,
+		`count_values("version", build_info{job="prometheus",instance=~"prometheus-k8s-0|prometheus-k8s-1|prometheus-k8s-2"})`,
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			expected, err := promqlParser.ParseExpr(query)
+			require.NoError(t, err)
+			assert.Equal(t, parser.Prettify(expected), Pretty(MustParse(query)))
+			assert.Equal(t, parser.Prettify(expected), MustParse(query).Pretty(0))
+		})
+	}
+}
+
+func TestPrettyWithOptions(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		opts     []PrettyOption
+		expected string
+	}{
+		{
+			name: "variable range in a builder child",
+			expr: Sum(Rate(matrix.New(
+				vector.New(vector.WithMetricName("http_requests_total")),
+				matrix.WithRangeAsVariable("$__rate_interval"),
+			))).By("job"),
+			opts: []PrettyOption{WithMaxLineWidth(40)},
+			expected: `sum by (job) (
+  rate(
+    http_requests_total[$__rate_interval]
+  )
+)`,
+		},
+		{
+			name:     "indent string",
+			expr:     MustParse(`sum(foo) / on (job) group_left () bar`),
+			opts:     []PrettyOption{WithMaxLineWidth(10), WithIndent("\t")},
+			expected: "\tsum(foo)\n/ on (job) group_left ()\n\tbar",
+		},
+		{
+			name:     "short expression",
+			expr:     MustParse(`sum(foo) / bar`),
+			opts:     []PrettyOption{WithIndent("\t")},
+			expected: `sum(foo) / bar`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Pretty(test.expr, test.opts...))
+		})
+	}
+}
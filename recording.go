@@ -0,0 +1,202 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// RecordedExpr is an expression recorded by a recording rule as the series named Record.
+type RecordedExpr struct {
+	Record string
+	Expr   parser.Expr
+}
+
+// ReplaceRecorded returns a copy of the expression where every subexpression structurally equal to a recorded
+// expression is replaced by the recorded series. The expressions are compared with Equal, ignoring the order of
+// the label matchers and of the grouping labels.
+// When several recorded expressions match, the largest subexpression is replaced.
+//
+// For example, with the recording rule "job:http_requests:rate5m" recording
+// "sum by (job) (rate(http_requests_total[5m]))", the expression
+// "sum by (job) (rate(http_requests_total[5m])) > 10" gives "job:http_requests:rate5m > 10".
+func ReplaceRecorded(expr parser.Expr, recorded ...RecordedExpr) parser.Expr {
+	records := make(map[string]string, len(recorded))
+	for _, r := range recorded {
+		key := recordingKey(r.Expr)
+		if _, exists := records[key]; !exists {
+			records[key] = r.Record
+		}
+	}
+	return replaceRecorded(DeepCopyExpr(expr), records)
+}
+
+func replaceRecorded(expr parser.Expr, records map[string]string) parser.Expr {
+	if typeOf(expr) == parser.ValueTypeVector {
+		if record, ok := records[recordingKey(expr)]; ok {
+			return vector.New(vector.WithMetricName(record))
+		}
+	}
+	children := Children(expr)
+	if len(children) == 0 {
+		return expr
+	}
+	if _, isRangeVector := expr.(*matrix.Builder); isRangeVector {
+		// The vector selector of a range vector cannot be replaced by something else than a vector selector.
+		return expr
+	}
+	if _, isRangeVector := expr.(*parser.MatrixSelector); isRangeVector {
+		return expr
+	}
+	for i, child := range children {
+		children[i] = replaceRecorded(child.(parser.Expr), records)
+	}
+	// The children keep the type of the node they replace, so they can always be set back.
+	_ = setChildren(expr, children)
+	return expr
+}
+
+// ProposeRecorded looks for the subexpressions used at least minOccurrences times in the given expressions and
+// returns them as recorded expressions, named following the Prometheus "level:metric:operations" convention.
+// The largest subexpressions are preferred: the subexpressions of a proposed one are only proposed when they are
+// also used enough times elsewhere.
+//
+// Only instant vector subexpressions containing an aggregation or a function call and no dashboard variable are
+// proposed. The result can be used with ReplaceRecorded.
+func ProposeRecorded(exprs []parser.Expr, minOccurrences int) []RecordedExpr {
+	counts := map[string]int{}
+	for _, expr := range exprs {
+		Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			if e, ok := node.(parser.Expr); ok && isRecordable(e) {
+				counts[recordingKey(e)]++
+			}
+			return nil
+		})
+	}
+	var result []RecordedExpr
+	proposed := map[string]bool{}
+	names := map[string]bool{}
+	var propose func(expr parser.Expr)
+	propose = func(expr parser.Expr) {
+		if isRecordable(expr) {
+			key := recordingKey(expr)
+			if counts[key] >= minOccurrences {
+				if !proposed[key] {
+					proposed[key] = true
+					name := uniqueName(recordName(expr), names)
+					result = append(result, RecordedExpr{Record: name, Expr: DeepCopyExpr(expr)})
+				}
+				return
+			}
+		}
+		for _, child := range Children(expr) {
+			propose(child.(parser.Expr))
+		}
+	}
+	for _, expr := range exprs {
+		propose(expr)
+	}
+	return result
+}
+
+// recordingKey returns the key identifying the expressions recorded by the same series.
+func recordingKey(expr parser.Expr) string {
+	return newEqualOptions([]EqualOption{IgnoreMatcherOrder(), IgnoreGroupingOrder()}).canonical(expr)
+}
+
+// isRecordable returns true if the expression is worth being recorded by a recording rule.
+func isRecordable(expr parser.Expr) bool {
+	if typeOf(expr) != parser.ValueTypeVector || len(Variables(expr)) > 0 {
+		return false
+	}
+	computed := false
+	Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch node.(type) {
+		case *parser.Call, *parser.AggregateExpr, *AggregationBuilder:
+			computed = true
+		}
+		return nil
+	})
+	return computed
+}
+
+// recordName returns the name of the recorded series following the "level:metric:operations" convention,
+// like "job:http_requests:rate5m" for "sum by (job) (rate(http_requests_total[5m]))".
+func recordName(expr parser.Expr) string {
+	var level []string
+	var metric string
+	var operations []string
+	Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if len(metric) == 0 {
+				metric = n.Name
+			}
+		case *parser.Call:
+			operation := n.Func.Name
+			if len(n.Args) > 0 {
+				if m, ok := n.Args[0].(*matrix.Builder); ok && len(m.RangeAsVariable) == 0 {
+					operation += model.Duration(m.InternalMatrix.Range).String()
+				}
+			}
+			operations = appendOperation(operations, operation)
+		}
+		if a := AggregateExprOf(node); a != nil {
+			if level == nil && !a.Without {
+				level = a.Grouping
+			}
+			operations = appendOperation(operations, a.Op.String())
+		}
+		return nil
+	})
+	if len(operations) > 1 {
+		// A sum is implied when combined with other operations, like in "job:http_requests:rate5m".
+		operations = slices.DeleteFunc(operations, func(op string) bool { return op == "sum" })
+	}
+	for _, op := range operations {
+		if strings.HasPrefix(op, "rate") || strings.HasPrefix(op, "irate") || strings.HasPrefix(op, "increase") {
+			metric = strings.TrimSuffix(metric, "_total")
+			break
+		}
+	}
+	name := metric + ":" + strings.Join(operations, "_")
+	if len(level) > 0 {
+		name = strings.Join(level, "_") + ":" + name
+	}
+	return name
+}
+
+func appendOperation(operations []string, operation string) []string {
+	if slices.Contains(operations, operation) {
+		return operations
+	}
+	return append(operations, operation)
+}
+
+// uniqueName returns the given name, with a numeric suffix if it is already used.
+func uniqueName(name string, used map[string]bool) string {
+	result := name
+	for i := 2; used[result]; i++ {
+		result = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[result] = true
+	return result
+}
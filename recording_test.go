@@ -0,0 +1,97 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceRecorded(t *testing.T) {
+	recorded := []RecordedExpr{
+		{
+			Record: "job:http_requests:rate5m",
+			Expr: Sum(Rate(matrix.New(
+				vector.New(vector.WithMetricName("http_requests_total")),
+				matrix.WithRangeAsString("5m"),
+			))).By("job"),
+		},
+		{
+			Record: "http_requests:rate5m",
+			Expr:   MustParse("rate(http_requests_total[5m])"),
+		},
+	}
+	testSuite := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "whole expression",
+			query:    "sum by (job) (rate(http_requests_total[5m]))",
+			expected: "job:http_requests:rate5m",
+		},
+		{
+			name:     "largest subexpression",
+			query:    "(sum by (job) ((rate(http_requests_total[5m])))) > 10 and rate(http_requests_total[5m]) > 1",
+			expected: "job:http_requests:rate5m > 10 and http_requests:rate5m > 1",
+		},
+		{
+			name:     "different grouping",
+			query:    "sum by (instance) (rate(http_requests_total[5m]))",
+			expected: "sum by (instance) (http_requests:rate5m)",
+		},
+		{
+			name:     "different range",
+			query:    "sum by (job) (rate(http_requests_total[1m]))",
+			expected: "sum by (job) (rate(http_requests_total[1m]))",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			expr := MustParse(test.query)
+			assert.Equal(t, test.expected, ReplaceRecorded(expr, recorded...).String())
+			assert.Equal(t, MustParse(test.query).String(), expr.String())
+		})
+	}
+}
+
+func TestProposeRecorded(t *testing.T) {
+	queries := []parser.Expr{
+		MustParse("sum by (job) (rate(http_requests_total[5m])) > 10"),
+		MustParse("topk(5, sum by (job) (rate(http_requests_total[5m])))"),
+		MustParse(`sum by (instance) (rate(http_requests_total[5m])) / on (instance) group_left () max by (instance) (up)`),
+		MustParse("max by (instance) (up) == 0"),
+		MustParse("sum(rate(foo[$__rate_interval]))"),
+		MustParse("sum(rate(foo[$__rate_interval]))"),
+		MustParse("count(bar)"),
+	}
+	proposed := ProposeRecorded(queries, 2)
+	var result []string
+	for _, r := range proposed {
+		result = append(result, r.Record+" = "+r.Expr.String())
+	}
+	assert.Equal(t, []string{
+		"job:http_requests:rate5m = sum by (job) (rate(http_requests_total[5m]))",
+		"http_requests:rate5m = rate(http_requests_total[5m])",
+		"instance:up:max = max by (instance) (up)",
+	}, result)
+	assert.Equal(t, "job:http_requests:rate5m > 10", ReplaceRecorded(queries[0], proposed...).String())
+	assert.Equal(t, "sum by (instance) (http_requests:rate5m) / on (instance) group_left () instance:up:max",
+		ReplaceRecorded(queries[2], proposed...).String())
+}
@@ -0,0 +1,170 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rules generates Prometheus rule files from expressions built with promqlbuilder.
+package rules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.yaml.in/yaml/v3"
+)
+
+// Value is the template giving the value of the alerting rule expression, to be used in labels and annotations.
+const Value = "{{ $value }}"
+
+// HumanizedValue is like Value but formats the value with a metric prefix, like "1.5k".
+const HumanizedValue = "{{ $value | humanize }}"
+
+// HumanizedPercentage is like Value but formats the value, between 0 and 1, as a percentage.
+const HumanizedPercentage = "{{ $value | humanizePercentage }}"
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Label returns the template giving the value of a label of the alert, like "{{ $labels.instance }}".
+func Label(name string) string {
+	if identifierRegexp.MatchString(name) {
+		return fmt.Sprintf("{{ $labels.%s }}", name)
+	}
+	return fmt.Sprintf("{{ index $labels %q }}", name)
+}
+
+// promqlParser is the parser used to validate the expressions of the rules.
+var promqlParser = parser.NewParser(parser.Options{
+	EnableExperimentalFunctions: true,
+	EnableBinopFillModifiers:    true,
+})
+
+// RuleGroup is a group of rules evaluated together at a regular interval.
+type RuleGroup struct {
+	Name string
+	// Interval is how often the rules are evaluated. When zero, the global evaluation interval is used.
+	Interval time.Duration
+	// QueryOffset delays the evaluation of the rules. When nil, the global query offset is used.
+	QueryOffset *time.Duration
+	// Limit is the maximum number of alerts or series produced by a rule. Zero means no limit.
+	Limit  int
+	Labels map[string]string
+	Rules  []Rule
+}
+
+// Rule is either a *RecordingRule or an *AlertingRule.
+type Rule interface {
+	toRulefmt() rulefmt.Rule
+}
+
+// RecordingRule stores the result of an expression as a new series.
+type RecordingRule struct {
+	Record string
+	Expr   parser.Expr
+	Labels map[string]string
+}
+
+func (r *RecordingRule) toRulefmt() rulefmt.Rule {
+	return rulefmt.Rule{
+		Record: r.Record,
+		Expr:   exprString(r.Expr),
+		Labels: r.Labels,
+	}
+}
+
+// AlertingRule fires an alert for every series returned by the expression.
+// The labels and annotations can use the Prometheus templating, like Label("instance") or Value.
+type AlertingRule struct {
+	Alert         string
+	Expr          parser.Expr
+	For           time.Duration
+	KeepFiringFor time.Duration
+	Labels        map[string]string
+	Annotations   map[string]string
+}
+
+func (r *AlertingRule) toRulefmt() rulefmt.Rule {
+	return rulefmt.Rule{
+		Alert:         r.Alert,
+		Expr:          exprString(r.Expr),
+		For:           model.Duration(r.For),
+		KeepFiringFor: model.Duration(r.KeepFiringFor),
+		Labels:        r.Labels,
+		Annotations:   r.Annotations,
+	}
+}
+
+func exprString(expr parser.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return expr.String()
+}
+
+func (g *RuleGroup) toRulefmt() rulefmt.RuleGroup {
+	result := rulefmt.RuleGroup{
+		Name:     g.Name,
+		Interval: model.Duration(g.Interval),
+		Limit:    g.Limit,
+		Labels:   g.Labels,
+		Rules:    make([]rulefmt.Rule, 0, len(g.Rules)),
+	}
+	if g.QueryOffset != nil {
+		offset := model.Duration(*g.QueryOffset)
+		result.QueryOffset = &offset
+	}
+	for _, r := range g.Rules {
+		result.Rules = append(result.Rules, r.toRulefmt())
+	}
+	return result
+}
+
+// Marshal returns the rule file containing the given groups, in the Prometheus YAML format.
+// The file is validated like Prometheus does when loading it, and every problem found is returned as error.
+func Marshal(groups ...*RuleGroup) ([]byte, error) {
+	file := rulefmt.RuleGroups{Groups: make([]rulefmt.RuleGroup, 0, len(groups))}
+	for _, g := range groups {
+		file.Groups = append(file.Groups, g.toRulefmt())
+	}
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(file); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	if err := validate(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Validate checks the given groups like Prometheus does when loading a rule file.
+func Validate(groups ...*RuleGroup) error {
+	_, err := Marshal(groups...)
+	return err
+}
+
+func validate(content []byte) error {
+	logger := slog.New(slog.DiscardHandler)
+	if _, errs := rulefmt.Parse(content, false, model.UTF8Validation, promqlParser, logger); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
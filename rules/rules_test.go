@@ -0,0 +1,128 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	offset := time.Minute
+	errorRate := promqlbuilder.Sum(promqlbuilder.Rate(matrix.New(
+		vector.New(
+			vector.WithMetricName("http_requests_total"),
+			vector.WithLabelMatchers(label.New("code").EqualRegexp("5..")),
+		),
+		matrix.WithRangeAsString("5m"),
+	))).By("job")
+	group := &RuleGroup{
+		Name:        "http",
+		Interval:    30 * time.Second,
+		QueryOffset: &offset,
+		Labels:      map[string]string{"team": "web"},
+		Rules: []Rule{
+			&RecordingRule{
+				Record: "job:http_errors:rate5m",
+				Expr:   errorRate,
+			},
+			&AlertingRule{
+				Alert:         "HighErrorRate",
+				Expr:          promqlbuilder.Gtr(vector.New(vector.WithMetricName("job:http_errors:rate5m")), promqlbuilder.NewNumber(10)),
+				For:           10 * time.Minute,
+				KeepFiringFor: 5 * time.Minute,
+				Labels:        map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "High error rate on " + Label("job"),
+					"description": HumanizedValue + " errors per second on " + Label("service.name"),
+				},
+			},
+		},
+	}
+	expected := `groups:
+  - name: http
+    interval: 30s
+    query_offset: 1m
+    rules:
+      - record: job:http_errors:rate5m
+        expr: sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))
+      - alert: HighErrorRate
+        expr: job:http_errors:rate5m > 10
+        for: 10m
+        keep_firing_for: 5m
+        labels:
+          severity: critical
+        annotations:
+          description: '{{ $value | humanize }} errors per second on {{ index $labels "service.name" }}'
+          summary: High error rate on {{ $labels.job }}
+    labels:
+      team: web
+`
+	result, err := Marshal(group)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(result))
+}
+
+func TestValidate(t *testing.T) {
+	foo := vector.New(vector.WithMetricName("foo"))
+	testSuite := []struct {
+		name  string
+		group *RuleGroup
+		err   string
+	}{
+		{
+			name:  "valid group",
+			group: &RuleGroup{Name: "foo", Rules: []Rule{&RecordingRule{Record: "foo:sum", Expr: promqlbuilder.Sum(foo)}}},
+		},
+		{
+			name:  "missing expression",
+			group: &RuleGroup{Name: "foo", Rules: []Rule{&RecordingRule{Record: "foo:sum"}}},
+			err:   "5:15: group \"foo\", rule 1, \"foo:sum\": field 'expr' must be set in rule",
+		},
+		{
+			name: "invalid expression",
+			group: &RuleGroup{Name: "foo", Rules: []Rule{&AlertingRule{
+				Alert: "Foo",
+				Expr:  promqlbuilder.Rate(matrix.New(foo, matrix.WithRangeAsVariable("$__rate_interval"))),
+			}}},
+			err: "5:15: group \"foo\", rule 1, \"Foo\": could not parse expression: 1:10: parse error: unexpected character in duration expression: '$'",
+		},
+		{
+			name: "invalid template",
+			group: &RuleGroup{Name: "foo", Rules: []Rule{&AlertingRule{
+				Alert:       "Foo",
+				Expr:        foo,
+				Annotations: map[string]string{"summary": "{{ $labels.job"},
+			}}},
+			err: "group \"foo\", rule 1, \"Foo\": annotation \"summary\": template: __alert_Foo:1: unclosed action",
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.group)
+			if len(test.err) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command generate-functions writes function.go, the helpers building every PromQL function of parser.Functions.
+// It is run with "go generate" from the root of the repository after upgrading Prometheus.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const output = "function.go"
+
+const license = `// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+`
+
+// goNames are the helper names that are not the camel case of the PromQL function name.
+var goNames = map[string]string{
+	"idelta": "IDelta",
+	"irate":  "IRate",
+	"pi":     "PI",
+}
+
+// paramNames are the names of the helper parameters, one per argument of the PromQL function. A name starting with
+// "..." is a variadic parameter taking the type of its argument. The functions without entry get default names.
+var paramNames = map[string][]string{
+	"clamp":                        {"vector", "min", "max"},
+	"clamp_max":                    {"vector", "max"},
+	"clamp_min":                    {"vector", "min"},
+	"double_exponential_smoothing": {"input", "smoothingFactor", "trendFactor"},
+	"histogram_fraction":           {"lower", "upper", "vector"},
+	"histogram_quantile":           {"quantile", "vector"},
+	"histogram_quantiles":          {"vector", "labelName", "...quantiles"},
+	"info":                         {"vector", "dataLabelSelector"},
+	"label_join":                   {"vector", "destinationLabel", "replacement", "...srcLabels"},
+	"label_replace":                {"vector", "destinationLabel", "replacement", "sourceLabel", "regexp"},
+	"predict_linear":               {"input", "t"},
+	"quantile_over_time":           {"t", "input"},
+	"round":                        {"vector", "t"},
+	"sort_by_label":                {"vector", "...labels"},
+	"sort_by_label_desc":           {"vector", "...labels"},
+	"vector":                       {"scalar"},
+}
+
+// docs are the comments of the helpers whose behavior is not obvious from their name.
+var docs = map[string]string{
+	"end":   "End returns the end time of the range query, or the evaluation time of an instant query.",
+	"range": "Range returns the duration of the range query in seconds, or 0 for an instant query.",
+	"start": "Start returns the start time of the range query, or the evaluation time of an instant query.",
+	"step":  "Step returns the step of the range query in seconds, or 0 for an instant query.",
+}
+
+var defaultParamNames = map[parser.ValueType]string{
+	parser.ValueTypeVector: "vector",
+	parser.ValueTypeMatrix: "input",
+	parser.ValueTypeScalar: "value",
+	parser.ValueTypeString: "value",
+}
+
+type param struct {
+	name      string
+	valueType parser.ValueType
+	variadic  bool
+}
+
+func goName(fn *parser.Function) string {
+	if name, ok := goNames[fn.Name]; ok {
+		return name
+	}
+	var b strings.Builder
+	for _, word := range strings.Split(fn.Name, "_") {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// params returns the parameters of the helper. The optional arguments of the function are required by the helper,
+// except the last one of the functions taking any number of arguments, which becomes variadic.
+func params(fn *parser.Function) []param {
+	if names, ok := paramNames[fn.Name]; ok {
+		result := make([]param, len(names))
+		for i, name := range names {
+			result[i] = param{name: strings.TrimPrefix(name, "..."), valueType: fn.ArgTypes[i], variadic: strings.HasPrefix(name, "...")}
+		}
+		return result
+	}
+	result := make([]param, len(fn.ArgTypes))
+	counts := map[string]int{}
+	for i, t := range fn.ArgTypes {
+		name := defaultParamNames[t]
+		counts[name]++
+		if counts[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, counts[name])
+		}
+		result[i] = param{name: name, valueType: t, variadic: fn.Variadic < 0 && i == len(fn.ArgTypes)-1}
+	}
+	return result
+}
+
+func goType(t parser.ValueType) string {
+	switch t {
+	case parser.ValueTypeMatrix:
+		return "T"
+	case parser.ValueTypeScalar:
+		return "float64"
+	case parser.ValueTypeString:
+		return "string"
+	default:
+		return "parser.Expr"
+	}
+}
+
+func argument(t parser.ValueType, name string) string {
+	switch t {
+	case parser.ValueTypeMatrix:
+		return fmt.Sprintf("convertToExpr(%s)", name)
+	case parser.ValueTypeScalar:
+		return fmt.Sprintf("NewNumber(%s)", name)
+	case parser.ValueTypeString:
+		return fmt.Sprintf("NewString(%s)", name)
+	default:
+		return name
+	}
+}
+
+func writeHelper(b *bytes.Buffer, fn *parser.Function) {
+	name := goName(fn)
+	ps := params(fn)
+	if doc, ok := docs[fn.Name]; ok {
+		fmt.Fprintf(b, "// %s\n", doc)
+	}
+	typeParams := ""
+	signature := make([]string, len(ps))
+	args := make([]string, 0, len(ps))
+	for i, p := range ps {
+		if p.valueType == parser.ValueTypeMatrix {
+			typeParams = "[T RangeVectorBuilder]"
+		}
+		if p.variadic {
+			signature[i] = fmt.Sprintf("%s ...%s", p.name, goType(p.valueType))
+			continue
+		}
+		signature[i] = fmt.Sprintf("%s %s", p.name, goType(p.valueType))
+		args = append(args, argument(p.valueType, p.name))
+	}
+	fmt.Fprintf(b, "func %s%s(%s) *parser.Call {\n", name, typeParams, strings.Join(signature, ", "))
+	if last := len(ps) - 1; last >= 0 && ps[last].variadic {
+		fmt.Fprintf(b, "args := []parser.Expr{%s}\n", strings.Join(args, ", "))
+		fmt.Fprintf(b, "for _, arg := range %s {\n", ps[last].name)
+		fmt.Fprintf(b, "args = append(args, %s)\n", argument(ps[last].valueType, "arg"))
+		b.WriteString("}\n")
+		fmt.Fprintf(b, "return NewFunction(%q, args...)\n", fn.Name)
+	} else {
+		fmt.Fprintf(b, "return NewFunction(%s)\n", strings.Join(append([]string{fmt.Sprintf("%q", fn.Name)}, args...), ", "))
+	}
+	b.WriteString("}\n\n")
+}
+
+// generate returns the content of function.go.
+func generate() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(license)
+	b.WriteString("// Code generated by scripts/generate-functions. DO NOT EDIT.\n\n")
+	b.WriteString("package promqlbuilder\n\n")
+	b.WriteString("import \"github.com/prometheus/prometheus/promql/parser\"\n\n")
+	names := make([]string, 0, len(parser.Functions))
+	for name := range parser.Functions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		writeHelper(&b, parser.Functions[name])
+	}
+	return format.Source(b.Bytes())
+}
+
+func main() {
+	content, err := generate()
+	if err == nil {
+		err = os.WriteFile(output, content, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to generate %s: %s\n", output, err)
+		os.Exit(1)
+	}
+}
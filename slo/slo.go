@@ -0,0 +1,228 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slo generates the recording rules, the multi-window multi-burn-rate alerts and the error budget queries of
+// a service level objective, as described in https://sre.google/workbook/alerting-on-slos/.
+package slo
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/rules"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// NameLabel is the label holding the name of the SLO on the recorded series and on the alerts.
+const NameLabel = "slo"
+
+// AlertName is the name of the burn rate alerts.
+const AlertName = "ErrorBudgetBurn"
+
+// SLI is the service level indicator: the ratio of good events among all the events.
+// Both selectors must select counters.
+type SLI struct {
+	Good  *parser.VectorSelector
+	Total *parser.VectorSelector
+}
+
+// Latency returns the SLI counting as good the requests faster than the threshold, from a classic latency histogram
+// with the given base metric name. The threshold must be the upper bound of one of the buckets.
+func Latency(metric string, threshold float64, matchers ...*labels.Matcher) SLI {
+	bucketMatchers := append(slices.Clone(matchers), label.New(labels.BucketLabel).Equal(labels.FormatOpenMetricsFloat(threshold)))
+	return SLI{
+		Good:  vector.New(vector.WithMetricName(metric+"_bucket"), vector.WithLabelMatchers(bucketMatchers...)),
+		Total: vector.New(vector.WithMetricName(metric+"_count"), vector.WithLabelMatchers(slices.Clone(matchers)...)),
+	}
+}
+
+// BurnRateWindow is a pair of windows over which the error budget must be burning faster than BurnRate times the
+// sustainable rate for the alert to fire. The short window makes the alert resolve quickly once the problem is fixed.
+type BurnRateWindow struct {
+	Long     time.Duration
+	Short    time.Duration
+	BurnRate float64
+	// Severity is the value of the label "severity" of the alert. The windows with the same severity are combined
+	// in a single alert.
+	Severity string
+}
+
+// GoogleSREWindows are the windows recommended by the Google SRE workbook for a 30 days period.
+var GoogleSREWindows = []BurnRateWindow{
+	{Long: time.Hour, Short: 5 * time.Minute, BurnRate: 14.4, Severity: "page"},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, BurnRate: 6, Severity: "page"},
+	{Long: 24 * time.Hour, Short: 2 * time.Hour, BurnRate: 3, Severity: "ticket"},
+	{Long: 72 * time.Hour, Short: 6 * time.Hour, BurnRate: 1, Severity: "ticket"},
+}
+
+// DefaultPeriod is the period over which the objective is measured when none is set.
+const DefaultPeriod = 30 * 24 * time.Hour
+
+// SLO is a service level objective.
+type SLO struct {
+	// Name identifies the SLO in the label NameLabel of the recorded series and of the alerts.
+	Name string
+	SLI  SLI
+	// Objective is the expected ratio of good events, like 0.999.
+	Objective float64
+	// Period is the period over which the objective is measured. When zero, DefaultPeriod is used.
+	Period time.Duration
+	// Windows are the burn rate windows of the alerts. When nil, GoogleSREWindows is used.
+	Windows []BurnRateWindow
+	// Grouping are the labels kept by the error ratio, to get one SLO per value like per service.
+	Grouping []string
+	// Labels are added to the recording and alerting rules.
+	Labels map[string]string
+}
+
+// ErrorRatio returns the ratio of bad events over the given window, computed from the SLI.
+func (s *SLO) ErrorRatio(window time.Duration) parser.Expr {
+	return promqlbuilder.Sub(
+		promqlbuilder.NewNumber(1),
+		promqlbuilder.Div(s.sumRate(s.SLI.Good, window), s.sumRate(s.SLI.Total, window)),
+	)
+}
+
+// RecordName returns the name of the series recording the error ratio over the given window,
+// like "slo:sli_error:ratio_rate5m".
+func RecordName(window time.Duration) string {
+	return "slo:sli_error:ratio_rate" + model.Duration(window).String()
+}
+
+// Recorded returns the series recorded by RecordingRules for the error ratio over the given window.
+func (s *SLO) Recorded(window time.Duration) *parser.VectorSelector {
+	return vector.New(vector.WithMetricName(RecordName(window)), vector.WithLabelMatchers(label.New(NameLabel).Equal(s.Name)))
+}
+
+// ErrorBudgetRemaining returns the ratio of the error budget of the period that is not consumed yet, from the series
+// recorded by RecordingRules. It is negative when the objective is not met.
+func (s *SLO) ErrorBudgetRemaining() parser.Expr {
+	return promqlbuilder.Sub(
+		promqlbuilder.NewNumber(1),
+		promqlbuilder.Div(s.Recorded(s.period()), s.errorBudget()),
+	)
+}
+
+// BurnRateAlert returns the expression of the alert with the given severity, from the series recorded by
+// RecordingRules. It returns nil when no window has this severity.
+func (s *SLO) BurnRateAlert(severity string) parser.Expr {
+	var result parser.Expr
+	for _, w := range s.windows() {
+		if w.Severity != severity {
+			continue
+		}
+		threshold := promqlbuilder.Mul(promqlbuilder.NewNumber(w.BurnRate), s.errorBudget())
+		expr := promqlbuilder.And(
+			promqlbuilder.Gtr(s.Recorded(w.Long), threshold),
+			promqlbuilder.Gtr(s.Recorded(w.Short), promqlbuilder.DeepCopyExpr(threshold)),
+		)
+		if result == nil {
+			result = expr
+		} else {
+			result = promqlbuilder.Or(result, expr)
+		}
+	}
+	return result
+}
+
+// RecordingRules returns the rules recording the error ratio over every window and over the period.
+func (s *SLO) RecordingRules() []rules.Rule {
+	var windows []time.Duration
+	for _, w := range s.windows() {
+		windows = append(windows, w.Short, w.Long)
+	}
+	windows = append(windows, s.period())
+	slices.Sort(windows)
+	windows = slices.Compact(windows)
+	result := make([]rules.Rule, 0, len(windows))
+	for _, window := range windows {
+		result = append(result, &rules.RecordingRule{
+			Record: RecordName(window),
+			Expr:   s.ErrorRatio(window),
+			Labels: s.labels(nil),
+		})
+	}
+	return result
+}
+
+// AlertingRules returns one burn rate alert per severity, in the order of the windows.
+func (s *SLO) AlertingRules() []rules.Rule {
+	var result []rules.Rule
+	var severities []string
+	for _, w := range s.windows() {
+		if slices.Contains(severities, w.Severity) {
+			continue
+		}
+		severities = append(severities, w.Severity)
+		result = append(result, &rules.AlertingRule{
+			Alert:  AlertName,
+			Expr:   s.BurnRateAlert(w.Severity),
+			Labels: s.labels(map[string]string{"severity": w.Severity}),
+			Annotations: map[string]string{
+				"summary": fmt.Sprintf("The SLO %s is burning its error budget too fast.", s.Name),
+			},
+		})
+	}
+	return result
+}
+
+// RuleGroup returns the group with the recording and alerting rules of the SLO.
+func (s *SLO) RuleGroup() *rules.RuleGroup {
+	return &rules.RuleGroup{
+		Name:  "slo-" + s.Name,
+		Rules: append(s.RecordingRules(), s.AlertingRules()...),
+	}
+}
+
+func (s *SLO) sumRate(selector *parser.VectorSelector, window time.Duration) parser.Expr {
+	v := promqlbuilder.DeepCopyExpr(selector).(*parser.VectorSelector)
+	return promqlbuilder.Sum(promqlbuilder.Rate(matrix.New(v, matrix.WithRange(window)))).By(s.Grouping...)
+}
+
+// errorBudget returns the ratio of bad events allowed by the objective, written "(1 - objective)" to keep the
+// objective readable.
+func (s *SLO) errorBudget() parser.Expr {
+	return promqlbuilder.Parenthesis(promqlbuilder.Sub(promqlbuilder.NewNumber(1), promqlbuilder.NewNumber(s.Objective)))
+}
+
+func (s *SLO) period() time.Duration {
+	if s.Period == 0 {
+		return DefaultPeriod
+	}
+	return s.Period
+}
+
+func (s *SLO) windows() []BurnRateWindow {
+	if s.Windows == nil {
+		return GoogleSREWindows
+	}
+	return s.Windows
+}
+
+func (s *SLO) labels(extra map[string]string) map[string]string {
+	result := maps.Clone(s.Labels)
+	if result == nil {
+		result = map[string]string{}
+	}
+	maps.Copy(result, extra)
+	result[NameLabel] = s.Name
+	return result
+}
@@ -0,0 +1,97 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/rules"
+	"github.com/perses/promql-builder/vector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func availability() *SLO {
+	return &SLO{
+		Name: "api-availability",
+		SLI: SLI{
+			Good: vector.New(
+				vector.WithMetricName("http_requests_total"),
+				vector.WithLabelMatchers(label.New("job").Equal("api"), label.New("code").NotEqualRegexp("5..")),
+			),
+			Total: vector.New(vector.WithMetricName("http_requests_total"), vector.WithLabelMatchers(label.New("job").Equal("api"))),
+		},
+		Objective: 0.999,
+		Grouping:  []string{"service"},
+		Labels:    map[string]string{"team": "platform"},
+	}
+}
+
+func TestErrorRatio(t *testing.T) {
+	assert.Equal(t,
+		`1 - sum by (service) (rate(http_requests_total{code!~"5..",job="api"}[5m])) / sum by (service) (rate(http_requests_total{job="api"}[5m]))`,
+		availability().ErrorRatio(5*time.Minute).String(),
+	)
+	latency := &SLO{Name: "api-latency", SLI: Latency("http_request_duration_seconds", 0.5, label.New("job").Equal("api")), Objective: 0.99}
+	assert.Equal(t,
+		`1 - sum(rate(http_request_duration_seconds_bucket{job="api",le="0.5"}[1h])) / sum(rate(http_request_duration_seconds_count{job="api"}[1h]))`,
+		latency.ErrorRatio(time.Hour).String(),
+	)
+}
+
+func TestBurnRateAlert(t *testing.T) {
+	s := availability()
+	assert.Equal(t,
+		`slo:sli_error:ratio_rate1h{slo="api-availability"} > 14.4 * (1 - 0.999) and slo:sli_error:ratio_rate5m{slo="api-availability"} > 14.4 * (1 - 0.999) or slo:sli_error:ratio_rate6h{slo="api-availability"} > 6 * (1 - 0.999) and slo:sli_error:ratio_rate30m{slo="api-availability"} > 6 * (1 - 0.999)`,
+		s.BurnRateAlert("page").String(),
+	)
+	assert.Nil(t, s.BurnRateAlert("unknown"))
+}
+
+func TestErrorBudgetRemaining(t *testing.T) {
+	assert.Equal(t,
+		`1 - slo:sli_error:ratio_rate30d{slo="api-availability"} / (1 - 0.999)`,
+		availability().ErrorBudgetRemaining().String(),
+	)
+}
+
+func TestRuleGroup(t *testing.T) {
+	group := availability().RuleGroup()
+	var records []string
+	var severities []string
+	for _, rule := range group.Rules {
+		switch r := rule.(type) {
+		case *rules.RecordingRule:
+			records = append(records, r.Record)
+			assert.Equal(t, map[string]string{"slo": "api-availability", "team": "platform"}, r.Labels)
+		case *rules.AlertingRule:
+			severities = append(severities, r.Labels["severity"])
+		}
+	}
+	assert.Equal(t, []string{
+		"slo:sli_error:ratio_rate5m",
+		"slo:sli_error:ratio_rate30m",
+		"slo:sli_error:ratio_rate1h",
+		"slo:sli_error:ratio_rate2h",
+		"slo:sli_error:ratio_rate6h",
+		"slo:sli_error:ratio_rate1d",
+		"slo:sli_error:ratio_rate3d",
+		"slo:sli_error:ratio_rate30d",
+	}, records)
+	assert.Equal(t, []string{"page", "ticket"}, severities)
+	_, err := rules.Marshal(group)
+	require.NoError(t, err)
+}
@@ -0,0 +1,83 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// StrictString returns the string representation of the expression, only if parsing it back gives the same tree.
+// Parentheses are ignored in the comparison, except when they change the structure of the tree.
+//
+// Binary operations made with this library are parenthesized according to the PromQL precedence rules,
+// but some trees cannot be rendered faithfully, like a *parser.UnaryExpr or a *parser.BinaryExpr wrapping
+// another binary operation without parentheses. StrictString returns an error for those.
+func StrictString(expr parser.Expr) (string, error) {
+	s := expr.String()
+	parsed, err := Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%q cannot be parsed: %w", s, err)
+	}
+	if want, got := structuralString(expr), structuralString(parsed); want != got {
+		return "", fmt.Errorf("%q is parsed as %s instead of %s", s, got, want)
+	}
+	return s, nil
+}
+
+// structuralString renders the expression with parentheses around every operand of a binary or unary operation,
+// and nowhere else, so two expressions with the same structure have the same structural string.
+// Negated numbers are rendered as negative numbers, like the parser does.
+func structuralString(expr parser.Expr) string {
+	withoutParens, err := rewrite(DeepCopyExpr(expr), func(node parser.Expr) (parser.Expr, error) {
+		switch n := node.(type) {
+		case *parser.ParenExpr:
+			return n.Expr, nil
+		case *parser.UnaryExpr:
+			// The parser reads "-1" as a negative number.
+			if number, ok := n.Expr.(*parser.NumberLiteral); ok && n.Op == parser.SUB {
+				return NewNumber(-number.Val), nil
+			}
+		}
+		return node, nil
+	})
+	if err != nil {
+		return expr.String()
+	}
+	result, err := rewrite(withoutParens, func(node parser.Expr) (parser.Expr, error) {
+		if unary, ok := node.(*parser.UnaryExpr); ok && isOperation(unary.Expr) {
+			unary.Expr = Parenthesis(unary.Expr)
+		}
+		if b := BinaryExprOf(node); b != nil {
+			if isOperation(b.LHS) {
+				b.LHS = Parenthesis(b.LHS)
+			}
+			if isOperation(b.RHS) {
+				b.RHS = Parenthesis(b.RHS)
+			}
+		}
+		return node, nil
+	})
+	if err != nil {
+		return expr.String()
+	}
+	return result.String()
+}
+
+// isOperation returns true for binary and unary operations.
+func isOperation(expr parser.Expr) bool {
+	_, isUnary := expr.(*parser.UnaryExpr)
+	return isUnary || BinaryExprOf(expr) != nil
+}
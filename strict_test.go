@@ -0,0 +1,71 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictString(t *testing.T) {
+	a := vector.New(vector.WithMetricName("a"))
+	b := vector.New(vector.WithMetricName("b"))
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		expected string
+		err      string
+	}{
+		{
+			name:     "parsed query",
+			expr:     MustParse("sum by (job) (rate(foo[$__rate_interval])) / -(a + b) ^ 2"),
+			expected: "sum by (job) (rate(foo[$__rate_interval])) / -(a + b) ^ 2",
+		},
+		{
+			name:     "negative number",
+			expr:     Mul(a, &parser.UnaryExpr{Op: parser.SUB, Expr: NewNumber(1)}),
+			expected: "a * -1",
+		},
+		{
+			name: "unary expression wrapping a binary operation",
+			expr: &parser.UnaryExpr{Op: parser.SUB, Expr: Add(a, b)},
+			err:  `"-a + b" is parsed as (-a) + b instead of -(a + b)`,
+		},
+		{
+			name: "Prometheus binary expression wrapping a binary operation",
+			expr: &parser.BinaryExpr{Op: parser.MUL, LHS: Add(a, b), RHS: b},
+			err:  `"a + b * b" is parsed as a + (b * b) instead of (a + b) * b`,
+		},
+		{
+			name: "invalid query",
+			expr: Rate(matrix.New(a)),
+			err:  `"rate(a[0s])" cannot be parsed: 1:8: parse error: duration must be greater than 0`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := StrictString(test.expr)
+			if len(test.err) > 0 {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, s)
+		})
+	}
+}
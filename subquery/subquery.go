@@ -14,10 +14,13 @@
 package subquery
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/perses/promql-builder/duration"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
 )
 
 type Builder parser.SubqueryExpr
@@ -86,3 +89,126 @@ func WithAtSpecificTimeStamp(timestamp int64) Option {
 		vector.Timestamp = &timestamp
 	}
 }
+
+// VariableBuilder wraps a subquery that uses dashboard variables for its range, step or offset,
+// like "rate(foo[5m])[$__range:$__interval]".
+type VariableBuilder struct {
+	InternalSubquery *parser.SubqueryExpr
+	RangeAsVariable  string
+	StepAsVariable   string
+	OffsetAsVariable string
+}
+
+type VariableOption func(subquery *VariableBuilder)
+
+// NewWithVariables wraps the given subquery so it can use dashboard variables.
+func NewWithVariables(s *parser.SubqueryExpr, options ...VariableOption) *VariableBuilder {
+	b := &VariableBuilder{
+		InternalSubquery: s,
+	}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// WithRangeAsVariable sets the range as a variable name like "$__range".
+func WithRangeAsVariable(name string) VariableOption {
+	return func(subquery *VariableBuilder) {
+		subquery.RangeAsVariable = name
+	}
+}
+
+// WithStepAsVariable sets the step as a variable name like "$__interval".
+func WithStepAsVariable(name string) VariableOption {
+	return func(subquery *VariableBuilder) {
+		subquery.StepAsVariable = name
+	}
+}
+
+// WithRangeAndStepAsVariable sets both the range and the step as variable names.
+func WithRangeAndStepAsVariable(rangeName string, stepName string) VariableOption {
+	return func(subquery *VariableBuilder) {
+		subquery.RangeAsVariable = rangeName
+		subquery.StepAsVariable = stepName
+	}
+}
+
+// WithOffsetAsVariable sets the offset as a variable name like "$offset".
+func WithOffsetAsVariable(name string) VariableOption {
+	return func(subquery *VariableBuilder) {
+		subquery.OffsetAsVariable = name
+	}
+}
+
+// Type returns the type the expression evaluates to.
+func (b *VariableBuilder) Type() parser.ValueType {
+	return b.InternalSubquery.Type()
+}
+
+// PromQLExpr ensures that no other types accidentally implement the interface.
+func (b *VariableBuilder) PromQLExpr() {
+	b.InternalSubquery.PromQLExpr()
+}
+
+// String representation of the node. The variables are rendered as is.
+func (b *VariableBuilder) String() string {
+	return fmt.Sprintf("%s%s", b.InternalSubquery.Expr.String(), b.timeSuffix())
+}
+
+// timeSuffix returns the '[<range>:<step>] @ <timestamp> offset <offset>' suffix of the subquery.
+//
+// Taken from https://github.com/prometheus/prometheus/blob/v3.4.0/promql/parser/printer.go
+// But uses the variables when they are set.
+func (b *VariableBuilder) timeSuffix() string {
+	s := b.InternalSubquery
+	rangeStr := model.Duration(s.Range).String()
+	if len(b.RangeAsVariable) > 0 {
+		rangeStr = b.RangeAsVariable
+	}
+	step := ""
+	switch {
+	case len(b.StepAsVariable) > 0:
+		step = b.StepAsVariable
+	case s.Step != 0:
+		step = model.Duration(s.Step).String()
+	}
+	// The parser sets OriginalOffset, while WithOffset only sets Offset.
+	d := s.OriginalOffset
+	if d == 0 {
+		d = s.Offset
+	}
+	offset := ""
+	switch {
+	case len(b.OffsetAsVariable) > 0:
+		offset = fmt.Sprintf(" offset %s", b.OffsetAsVariable)
+	case d > time.Duration(0):
+		offset = fmt.Sprintf(" offset %s", model.Duration(d))
+	case d < time.Duration(0):
+		offset = fmt.Sprintf(" offset -%s", model.Duration(-d))
+	}
+	at := ""
+	switch {
+	case s.Timestamp != nil:
+		at = fmt.Sprintf(" @ %.3f", float64(*s.Timestamp)/1000.0)
+	case s.StartOrEnd == parser.START:
+		at = " @ start()"
+	case s.StartOrEnd == parser.END:
+		at = " @ end()"
+	}
+	return fmt.Sprintf("[%s:%s]%s%s", rangeStr, step, at, offset)
+}
+
+func (b *VariableBuilder) Pretty(level int) string {
+	if len(b.String()) <= maxCharactersPerLine {
+		return b.String()
+	}
+	return fmt.Sprintf("%s%s", b.InternalSubquery.Expr.Pretty(level), b.timeSuffix())
+}
+
+func (b *VariableBuilder) PositionRange() posrange.PositionRange {
+	return b.InternalSubquery.PositionRange()
+}
+
+// maxCharactersPerLine is the same limit as the one used by the Prometheus prettier.
+const maxCharactersPerLine = 100
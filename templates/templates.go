@@ -0,0 +1,189 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package templates provides the queries of the RED method (rate, errors, duration) for services and of the USE
+// method (utilization, saturation, errors) for resources.
+//
+// The package functions compute the rates over "$__rate_interval", for dashboards. Use New to change the range or
+// to filter every selector. The queries are builder trees, so they can be wrapped by other helpers like
+// promqlbuilder.TopK or compared with promqlbuilder.Gtr.
+package templates
+
+import (
+	"slices"
+	"time"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/histogram"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Builder builds the queries with the same range and label matchers.
+type Builder struct {
+	rangeOpt      matrix.Option
+	histogramOpts []histogram.Option
+	matchers      []*labels.Matcher
+}
+
+type Option func(b *Builder)
+
+// Default is the builder used by the package functions.
+var Default = New()
+
+// New returns a builder computing the rates over "$__rate_interval" by default.
+func New(options ...Option) *Builder {
+	b := &Builder{}
+	WithRangeAsVariable("$__rate_interval")(b)
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// WithRange sets the range over which the rates are computed.
+func WithRange(d time.Duration) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRange(d)
+		b.histogramOpts = []histogram.Option{histogram.WithRange(d)}
+	}
+}
+
+// WithRangeAsString sets the range over which the rates are computed as a string like "5m".
+func WithRangeAsString(d string) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRangeAsString(d)
+		b.histogramOpts = []histogram.Option{histogram.WithRangeAsString(d)}
+	}
+}
+
+// WithRangeAsVariable sets the range over which the rates are computed as a variable like "$__range".
+func WithRangeAsVariable(name string) Option {
+	return func(b *Builder) {
+		b.rangeOpt = matrix.WithRangeAsVariable(name)
+		b.histogramOpts = []histogram.Option{histogram.WithRangeAsVariable(name)}
+	}
+}
+
+// WithLabelMatchers filters every selector of the queries, like with job="$job".
+func WithLabelMatchers(matchers ...*labels.Matcher) Option {
+	return func(b *Builder) {
+		b.matchers = matchers
+	}
+}
+
+// RequestRate returns the number of requests per second, from a counter of requests.
+func (b *Builder) RequestRate(metric string, by ...string) *promqlbuilder.AggregationBuilder {
+	return promqlbuilder.Sum(b.rate(metric)).By(by...)
+}
+
+// ErrorRate returns the number of errors per second, from a counter of requests where the errors are selected by
+// errorMatcher, like code=~"5..". When errorMatcher is nil, every event counted by the metric is an error.
+func (b *Builder) ErrorRate(metric string, errorMatcher *labels.Matcher, by ...string) *promqlbuilder.AggregationBuilder {
+	if errorMatcher == nil {
+		return promqlbuilder.Sum(b.rate(metric)).By(by...)
+	}
+	return promqlbuilder.Sum(b.rate(metric, errorMatcher)).By(by...)
+}
+
+// ErrorRatio returns the ratio, between 0 and 1, of the requests that are errors.
+func (b *Builder) ErrorRatio(metric string, errorMatcher *labels.Matcher, by ...string) *promqlbuilder.BinaryBuilder {
+	return promqlbuilder.Div(b.ErrorRate(metric, errorMatcher, by...), b.RequestRate(metric, by...))
+}
+
+// LatencyQuantile returns the quantile, between 0 and 1, of the latency recorded by the given histogram.
+func (b *Builder) LatencyQuantile(metric string, quantile float64, by ...string) parser.Expr {
+	return b.histogram(metric, by).Quantile(quantile)
+}
+
+// LatencyAverage returns the average latency recorded by the given histogram.
+func (b *Builder) LatencyAverage(metric string, by ...string) parser.Expr {
+	return b.histogram(metric, by).Average()
+}
+
+// Utilization returns the ratio, between 0 and 1, of the time the resource is busy, from a counter of busy seconds
+// like node_disk_io_time_seconds_total.
+func (b *Builder) Utilization(busySeconds string, by ...string) *promqlbuilder.AggregationBuilder {
+	return promqlbuilder.Avg(b.rate(busySeconds)).By(by...)
+}
+
+// UsageRatio returns the ratio, between 0 and 1, of the capacity of the resource that is used, from two gauges like
+// the used and the total bytes of a filesystem.
+func (b *Builder) UsageRatio(used string, capacity string, by ...string) *promqlbuilder.BinaryBuilder {
+	return promqlbuilder.Div(
+		promqlbuilder.Sum(b.selector(used)).By(by...),
+		promqlbuilder.Sum(b.selector(capacity)).By(by...),
+	)
+}
+
+// Saturation returns the time per second spent waiting for the resource, from a counter of waiting seconds like
+// node_pressure_cpu_waiting_seconds_total.
+func (b *Builder) Saturation(waitingSeconds string, by ...string) *promqlbuilder.AggregationBuilder {
+	return promqlbuilder.Sum(b.rate(waitingSeconds)).By(by...)
+}
+
+func (b *Builder) selector(metric string, extraMatchers ...*labels.Matcher) *parser.VectorSelector {
+	matchers := append(slices.Clone(b.matchers), extraMatchers...)
+	return vector.New(vector.WithMetricName(metric), vector.WithLabelMatchers(matchers...))
+}
+
+func (b *Builder) rate(metric string, extraMatchers ...*labels.Matcher) parser.Expr {
+	return promqlbuilder.Rate(matrix.New(b.selector(metric, extraMatchers...), b.rangeOpt))
+}
+
+func (b *Builder) histogram(metric string, by []string) *histogram.Builder {
+	options := append(slices.Clone(b.histogramOpts), histogram.WithLabelMatchers(b.matchers...), histogram.WithGrouping(by...))
+	return histogram.New(metric, options...)
+}
+
+// RequestRate calls Builder.RequestRate on Default.
+func RequestRate(metric string, by ...string) *promqlbuilder.AggregationBuilder {
+	return Default.RequestRate(metric, by...)
+}
+
+// ErrorRate calls Builder.ErrorRate on Default.
+func ErrorRate(metric string, errorMatcher *labels.Matcher, by ...string) *promqlbuilder.AggregationBuilder {
+	return Default.ErrorRate(metric, errorMatcher, by...)
+}
+
+// ErrorRatio calls Builder.ErrorRatio on Default.
+func ErrorRatio(metric string, errorMatcher *labels.Matcher, by ...string) *promqlbuilder.BinaryBuilder {
+	return Default.ErrorRatio(metric, errorMatcher, by...)
+}
+
+// LatencyQuantile calls Builder.LatencyQuantile on Default.
+func LatencyQuantile(metric string, quantile float64, by ...string) parser.Expr {
+	return Default.LatencyQuantile(metric, quantile, by...)
+}
+
+// LatencyAverage calls Builder.LatencyAverage on Default.
+func LatencyAverage(metric string, by ...string) parser.Expr {
+	return Default.LatencyAverage(metric, by...)
+}
+
+// Utilization calls Builder.Utilization on Default.
+func Utilization(busySeconds string, by ...string) *promqlbuilder.AggregationBuilder {
+	return Default.Utilization(busySeconds, by...)
+}
+
+// UsageRatio calls Builder.UsageRatio on Default.
+func UsageRatio(used string, capacity string, by ...string) *promqlbuilder.BinaryBuilder {
+	return Default.UsageRatio(used, capacity, by...)
+}
+
+// Saturation calls Builder.Saturation on Default.
+func Saturation(waitingSeconds string, by ...string) *promqlbuilder.AggregationBuilder {
+	return Default.Saturation(waitingSeconds, by...)
+}
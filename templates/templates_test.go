@@ -0,0 +1,83 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"testing"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/label"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates(t *testing.T) {
+	filtered := New(WithRangeAsString("5m"), WithLabelMatchers(label.New("job").Equal("$job")))
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		expected string
+	}{
+		{
+			name:     "request rate",
+			expr:     RequestRate("http_requests_total", "handler"),
+			expected: `sum by (handler) (rate(http_requests_total[$__rate_interval]))`,
+		},
+		{
+			name:     "error ratio",
+			expr:     filtered.ErrorRatio("http_requests_total", label.New("code").EqualRegexp("5.."), "handler"),
+			expected: `sum by (handler) (rate(http_requests_total{code=~"5..",job="$job"}[5m])) / sum by (handler) (rate(http_requests_total{job="$job"}[5m]))`,
+		},
+		{
+			name:     "error rate without matcher",
+			expr:     ErrorRate("grpc_client_errors_total", nil),
+			expected: `sum(rate(grpc_client_errors_total[$__rate_interval]))`,
+		},
+		{
+			name:     "latency quantile",
+			expr:     filtered.LatencyQuantile("http_request_duration_seconds", 0.95, "handler"),
+			expected: `histogram_quantile(0.95, sum by (le, handler) (rate(http_request_duration_seconds_bucket{job="$job"}[5m])))`,
+		},
+		{
+			name:     "latency average",
+			expr:     LatencyAverage("http_request_duration_seconds"),
+			expected: `sum(rate(http_request_duration_seconds_sum[$__rate_interval])) / sum(rate(http_request_duration_seconds_count[$__rate_interval]))`,
+		},
+		{
+			name:     "utilization",
+			expr:     Utilization("node_disk_io_time_seconds_total", "instance", "device"),
+			expected: `avg by (instance, device) (rate(node_disk_io_time_seconds_total[$__rate_interval]))`,
+		},
+		{
+			name:     "usage ratio",
+			expr:     filtered.UsageRatio("node_filesystem_used_bytes", "node_filesystem_size_bytes", "instance"),
+			expected: `sum by (instance) (node_filesystem_used_bytes{job="$job"}) / sum by (instance) (node_filesystem_size_bytes{job="$job"})`,
+		},
+		{
+			name:     "saturation",
+			expr:     Saturation("node_pressure_cpu_waiting_seconds_total", "instance"),
+			expected: `sum by (instance) (rate(node_pressure_cpu_waiting_seconds_total[$__rate_interval]))`,
+		},
+		{
+			name:     "composed with aggregation helpers",
+			expr:     promqlbuilder.TopK(RequestRate("http_requests_total", "handler"), 5),
+			expected: `topk(5, sum by (handler) (rate(http_requests_total[$__rate_interval])))`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// SkipChildren can be returned by a TransformFunc, with the node to keep, to not transform its children.
+// It is only useful with TopDown, as the children are already transformed otherwise.
+var SkipChildren = errors.New("skip children")
+
+// TransformFunc is called by Transform on every node of an expression with the path of the node, like "$.args[0]".
+// It returns the node replacing the given one, which can be the node itself, modified or not.
+// Returning nil keeps the node unchanged.
+type TransformFunc func(node parser.Expr, path string) (parser.Expr, error)
+
+type TransformOption func(t *transformer)
+
+// TopDown makes Transform call the function on a node before its children, and then on the children of the node
+// returned by the function. By default, the children are transformed first.
+func TopDown() TransformOption {
+	return func(t *transformer) {
+		t.topDown = true
+	}
+}
+
+type transformer struct {
+	fn      TransformFunc
+	topDown bool
+}
+
+// Transform returns a copy of the expression where every node is replaced by the result of fn.
+// The builder types (*AggregationBuilder, *matrix.Builder, ...) are handled like the nodes returned by the parser,
+// so the children of any node can be replaced. The given expression is not modified.
+//
+// For example, to replace every rate by irate:
+//
+//	result, err := promqlbuilder.Transform(expr, func(node parser.Expr, _ string) (parser.Expr, error) {
+//		if call, ok := node.(*parser.Call); ok && call.Func.Name == "rate" {
+//			call.Func = parser.Functions["irate"]
+//		}
+//		return node, nil
+//	})
+func Transform(expr parser.Expr, fn TransformFunc, opts ...TransformOption) (parser.Expr, error) {
+	t := &transformer{fn: fn}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t.transform(DeepCopyExpr(expr), rootPath)
+}
+
+// Replace returns a copy of the expression where every subexpression Equal to old, with the given options,
+// is replaced by a copy of new.
+func Replace(expr, old, new parser.Expr, opts ...EqualOption) (parser.Expr, error) {
+	o := newEqualOptions(opts)
+	key := o.canonical(old)
+	return Transform(expr, func(node parser.Expr, _ string) (parser.Expr, error) {
+		if o.canonical(node) == key {
+			return DeepCopyExpr(new), nil
+		}
+		return node, nil
+	})
+}
+
+func (t *transformer) transform(expr parser.Expr, path string) (parser.Expr, error) {
+	if t.topDown {
+		result, err := t.apply(expr, path)
+		if errors.Is(err, SkipChildren) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := t.transformChildren(result, path); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	if err := t.transformChildren(expr, path); err != nil {
+		return nil, err
+	}
+	result, err := t.apply(expr, path)
+	if errors.Is(err, SkipChildren) {
+		return result, nil
+	}
+	return result, err
+}
+
+func (t *transformer) apply(expr parser.Expr, path string) (parser.Expr, error) {
+	result, err := t.fn(expr, path)
+	if result == nil && (err == nil || errors.Is(err, SkipChildren)) {
+		result = expr
+	}
+	return result, err
+}
+
+func (t *transformer) transformChildren(expr parser.Expr, path string) error {
+	children := Children(expr)
+	if len(children) == 0 {
+		return nil
+	}
+	newChildren := make([]parser.Node, len(children))
+	for i, child := range children {
+		newChild, err := t.transform(child.(parser.Expr), childPath(path, expr, i))
+		if err != nil {
+			return err
+		}
+		newChildren[i] = newChild
+	}
+	if err := setChildren(expr, newChildren); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateToIrate(node parser.Expr, _ string) (parser.Expr, error) {
+	if call, ok := node.(*parser.Call); ok && call.Func.Name == "rate" {
+		call.Func = parser.Functions["irate"]
+	}
+	return node, nil
+}
+
+func renameMetrics(node parser.Expr, _ string) (parser.Expr, error) {
+	if vs, ok := node.(*parser.VectorSelector); ok {
+		vs.Name = strings.Replace(vs.Name, "old_", "new_", 1)
+		vs.LabelMatchers = slices.DeleteFunc(vs.LabelMatchers, func(m *labels.Matcher) bool { return m.Name == labels.MetricName })
+	}
+	return nil, nil
+}
+
+func TestTransform(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		fn       TransformFunc
+		opts     []TransformOption
+		expected string
+	}{
+		{
+			name: "rate to irate in builders",
+			expr: Div(
+				Sum(Rate(matrix.New(
+					vector.New(vector.WithMetricName("foo"), vector.WithLabelMatchers(label.New("job").Equal("a"))),
+					matrix.WithRangeAsVariable("$__rate_interval"),
+				))).By("job"),
+				vector.New(vector.WithMetricName("bar")),
+			).On("job"),
+			fn:       rateToIrate,
+			expected: `sum by (job) (irate(foo{job="a"}[$__rate_interval])) / on (job) bar`,
+		},
+		{
+			name:     "metric name prefix",
+			expr:     MustParse(`old_foo / on (job) group_left () sum by (job) (rate(old_bar[5m] offset 1m))`),
+			fn:       renameMetrics,
+			expected: `new_foo / on (job) group_left () sum by (job) (rate(new_bar[5m] offset 1m))`,
+		},
+		{
+			name: "paths",
+			expr: MustParse(`topk(5, rate(foo[5m]))`),
+			fn: func(node parser.Expr, path string) (parser.Expr, error) {
+				if _, ok := node.(*parser.VectorSelector); ok {
+					return vector.New(vector.WithMetricName(strings.NewReplacer("$", "", ".", "_", "[", "_", "]", "").Replace(path))), nil
+				}
+				return node, nil
+			},
+			expected: `topk(5, rate(_expr_args_0_vector[5m]))`,
+		},
+		{
+			name: "top down",
+			expr: MustParse(`sum(foo)`),
+			fn: func(node parser.Expr, _ string) (parser.Expr, error) {
+				vs, ok := node.(*parser.VectorSelector)
+				if !ok {
+					return node, nil
+				}
+				switch vs.Name {
+				case "foo":
+					return Max(vector.New(vector.WithMetricName("bar"))), nil
+				case "bar":
+					return vector.New(vector.WithMetricName("baz")), nil
+				}
+				return node, nil
+			},
+			opts:     []TransformOption{TopDown()},
+			expected: `sum(max(baz))`,
+		},
+		{
+			name: "skip children",
+			expr: MustParse(`rate(foo[5m]) + sum(rate(bar[5m]))`),
+			fn: func(node parser.Expr, _ string) (parser.Expr, error) {
+				switch node.(type) {
+				case *parser.AggregateExpr, *AggregationBuilder:
+					return node, SkipChildren
+				}
+				return rateToIrate(node, "")
+			},
+			opts:     []TransformOption{TopDown()},
+			expected: `irate(foo[5m]) + sum(rate(bar[5m]))`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.expr.String()
+			result, err := Transform(test.expr, test.fn, test.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result.String())
+			assert.Equal(t, original, test.expr.String())
+		})
+	}
+}
+
+func TestTransformError(t *testing.T) {
+	expected := errors.New("boom")
+	_, err := Transform(MustParse("rate(foo[5m])"), func(node parser.Expr, path string) (parser.Expr, error) {
+		if path == "$.args[0].vector" {
+			return nil, expected
+		}
+		return node, nil
+	})
+	assert.ErrorIs(t, err, expected)
+
+	_, err = Transform(Rate(matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsString("5m"))), func(node parser.Expr, _ string) (parser.Expr, error) {
+		if _, ok := node.(*parser.VectorSelector); ok {
+			return NewNumber(1), nil
+		}
+		return node, nil
+	})
+	assert.EqualError(t, err, "$.args[0]: a range vector can only wrap a vector selector, got *parser.NumberLiteral")
+}
+
+func TestReplace(t *testing.T) {
+	result, err := Replace(
+		MustParse(`sum by (job) (rate(foo{b="2",a="1"}[5m])) / sum by (job) (rate(foo{a="1",b="2"}[5m]))`),
+		MustParse(`rate(foo{a="1",b="2"}[5m])`),
+		vector.New(vector.WithMetricName("foo:rate5m")),
+		IgnoreMatcherOrder(),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, `sum by (job) (foo:rate5m) / sum by (job) (foo:rate5m)`, result.String())
+}
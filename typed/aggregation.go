@@ -0,0 +1,99 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// AggregationOption sets the grouping of an aggregation.
+type AggregationOption func(a *promqlbuilder.AggregationBuilder)
+
+// By keeps only the given labels, like "sum by (job) (...)".
+func By(labels ...string) AggregationOption {
+	return func(a *promqlbuilder.AggregationBuilder) {
+		a.By(labels...)
+	}
+}
+
+// Without removes the given labels, like "sum without (instance) (...)".
+func Without(labels ...string) AggregationOption {
+	return func(a *promqlbuilder.AggregationBuilder) {
+		a.Without(labels...)
+	}
+}
+
+func aggregate(a *promqlbuilder.AggregationBuilder, options []AggregationOption) InstantVector {
+	for _, opt := range options {
+		opt(a)
+	}
+	return InstantVector{expr: a}
+}
+
+func Avg(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Avg(vector.expr), options)
+}
+
+func Count(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Count(vector.expr), options)
+}
+
+func Group(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Group(vector.expr), options)
+}
+
+func Max(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Max(vector.expr), options)
+}
+
+func Min(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Min(vector.expr), options)
+}
+
+func Stddev(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Stddev(vector.expr), options)
+}
+
+func Stdvar(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Stdvar(vector.expr), options)
+}
+
+func Sum(vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.Sum(vector.expr), options)
+}
+
+func BottomK(vector InstantVector, k Scalar, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.NewAggregation(parser.BOTTOMK, vector.expr, k.expr), options)
+}
+
+func LimitK(vector InstantVector, k Scalar, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.NewAggregation(parser.LIMITK, vector.expr, k.expr), options)
+}
+
+func LimitRatio(vector InstantVector, ratio Scalar, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.NewAggregation(parser.LIMIT_RATIO, vector.expr, ratio.expr), options)
+}
+
+func Quantile(vector InstantVector, quantile Scalar, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.NewAggregation(parser.QUANTILE, vector.expr, quantile.expr), options)
+}
+
+func TopK(vector InstantVector, k Scalar, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.NewAggregation(parser.TOPK, vector.expr, k.expr), options)
+}
+
+func CountValues(label string, vector InstantVector, options ...AggregationOption) InstantVector {
+	return aggregate(promqlbuilder.CountValues(label, vector.expr), options)
+}
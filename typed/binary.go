@@ -0,0 +1,430 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// BinaryOption is an option of an arithmetic operation between two instant vectors: On, Ignoring, GroupLeft or
+// GroupRight.
+type BinaryOption interface {
+	applyBinary(m *binaryModifiers)
+}
+
+// ComparisonOption is an option of a comparison between two instant vectors: Bool or any BinaryOption.
+type ComparisonOption interface {
+	applyComparison(m *binaryModifiers)
+}
+
+// SetOption is an option of a set operation: On or Ignoring.
+type SetOption interface {
+	applySet(m *binaryModifiers)
+}
+
+type binaryModifiers struct {
+	matching   bool
+	on         bool
+	labels     []string
+	groupLeft  bool
+	groupRight bool
+	include    []string
+	returnBool bool
+}
+
+// Matching sets the labels on which the series of both sides are matched, see On and Ignoring.
+type Matching func(m *binaryModifiers)
+
+func (f Matching) applyBinary(m *binaryModifiers)     { f(m) }
+func (f Matching) applyComparison(m *binaryModifiers) { f(m) }
+func (f Matching) applySet(m *binaryModifiers)        { f(m) }
+
+// Grouping allows a many-to-one matching, see GroupLeft and GroupRight. It is not allowed with the set operators.
+type Grouping func(m *binaryModifiers)
+
+func (f Grouping) applyBinary(m *binaryModifiers)     { f(m) }
+func (f Grouping) applyComparison(m *binaryModifiers) { f(m) }
+
+// BoolModifier makes a comparison return 0 or 1, see Bool. It is only allowed with the comparison operators.
+type BoolModifier func(m *binaryModifiers)
+
+func (f BoolModifier) applyComparison(m *binaryModifiers) { f(m) }
+
+// On matches the series of both sides on the given labels only.
+func On(labels ...string) Matching {
+	return func(m *binaryModifiers) {
+		m.matching, m.on, m.labels = true, true, labels
+	}
+}
+
+// Ignoring matches the series of both sides on all their labels but the given ones.
+func Ignoring(labels ...string) Matching {
+	return func(m *binaryModifiers) {
+		m.matching, m.on, m.labels = true, false, labels
+	}
+}
+
+// GroupLeft allows several series of the left side to match a series of the right side, copying the given labels
+// from the right side. Without On, the series are matched ignoring no label.
+func GroupLeft(labels ...string) Grouping {
+	return func(m *binaryModifiers) {
+		m.groupLeft, m.groupRight, m.include = true, false, labels
+	}
+}
+
+// GroupRight is like GroupLeft with the sides swapped.
+func GroupRight(labels ...string) Grouping {
+	return func(m *binaryModifiers) {
+		m.groupLeft, m.groupRight, m.include = false, true, labels
+	}
+}
+
+// Bool makes a comparison return 0 or 1 instead of filtering the series.
+func Bool() BoolModifier {
+	return func(m *binaryModifiers) {
+		m.returnBool = true
+	}
+}
+
+func arithmetic(operator func(left, right parser.Expr) *promqlbuilder.BinaryBuilder, left, right parser.Expr, options []BinaryOption) InstantVector {
+	m := &binaryModifiers{}
+	for _, opt := range options {
+		opt.applyBinary(m)
+	}
+	return InstantVector{expr: m.binary(operator, left, right)}
+}
+
+func comparison(operator func(left, right parser.Expr) *promqlbuilder.BinaryBuilder, left, right parser.Expr, options []ComparisonOption) InstantVector {
+	m := &binaryModifiers{}
+	for _, opt := range options {
+		opt.applyComparison(m)
+	}
+	return InstantVector{expr: m.binary(operator, left, right)}
+}
+
+func set(operator func(left, right parser.Expr) *promqlbuilder.BinaryBuilder, left, right parser.Expr, options []SetOption) InstantVector {
+	m := &binaryModifiers{}
+	for _, opt := range options {
+		opt.applySet(m)
+	}
+	return InstantVector{expr: m.binary(operator, left, right)}
+}
+
+// withScalar returns an operation between an instant vector and a scalar, where only the bool modifier is allowed.
+func withScalar(operator func(left, right parser.Expr) *promqlbuilder.BinaryBuilder, left, right parser.Expr, options []BoolModifier) InstantVector {
+	m := &binaryModifiers{}
+	for _, opt := range options {
+		opt(m)
+	}
+	return InstantVector{expr: m.binary(operator, left, right)}
+}
+
+func (m *binaryModifiers) binary(operator func(left, right parser.Expr) *promqlbuilder.BinaryBuilder, left, right parser.Expr) parser.Expr {
+	b := operator(left, right)
+	if m.returnBool {
+		b.Bool()
+	}
+	if !m.matching && !m.groupLeft && !m.groupRight {
+		return b
+	}
+	var result *promqlbuilder.BinaryWithVectorMatching
+	if m.on {
+		result = b.On(m.labels...)
+	} else {
+		result = b.Ignoring(m.labels...)
+	}
+	if m.groupLeft {
+		result.GroupLeft(m.include...)
+	}
+	if m.groupRight {
+		result.GroupRight(m.include...)
+	}
+	return result
+}
+
+// Add returns "v + right".
+func (v InstantVector) Add(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Add, v.expr, right.expr, options)
+}
+
+// Sub returns "v - right".
+func (v InstantVector) Sub(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Sub, v.expr, right.expr, options)
+}
+
+// Mul returns "v * right".
+func (v InstantVector) Mul(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Mul, v.expr, right.expr, options)
+}
+
+// Div returns "v / right".
+func (v InstantVector) Div(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Div, v.expr, right.expr, options)
+}
+
+// Mod returns "v % right".
+func (v InstantVector) Mod(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Mod, v.expr, right.expr, options)
+}
+
+// Pow returns "v ^ right".
+func (v InstantVector) Pow(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Pow, v.expr, right.expr, options)
+}
+
+// Atan2 returns "v atan2 right".
+func (v InstantVector) Atan2(right InstantVector, options ...BinaryOption) InstantVector {
+	return arithmetic(promqlbuilder.Atan2, v.expr, right.expr, options)
+}
+
+// Eql returns "v == right".
+func (v InstantVector) Eql(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Eql, v.expr, right.expr, options)
+}
+
+// Neq returns "v != right".
+func (v InstantVector) Neq(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Neq, v.expr, right.expr, options)
+}
+
+// Gtr returns "v > right".
+func (v InstantVector) Gtr(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Gtr, v.expr, right.expr, options)
+}
+
+// Gte returns "v >= right".
+func (v InstantVector) Gte(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Gte, v.expr, right.expr, options)
+}
+
+// Lss returns "v < right".
+func (v InstantVector) Lss(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Lss, v.expr, right.expr, options)
+}
+
+// Lte returns "v <= right".
+func (v InstantVector) Lte(right InstantVector, options ...ComparisonOption) InstantVector {
+	return comparison(promqlbuilder.Lte, v.expr, right.expr, options)
+}
+
+// And returns "v and right".
+func (v InstantVector) And(right InstantVector, options ...SetOption) InstantVector {
+	return set(promqlbuilder.And, v.expr, right.expr, options)
+}
+
+// Or returns "v or right".
+func (v InstantVector) Or(right InstantVector, options ...SetOption) InstantVector {
+	return set(promqlbuilder.Or, v.expr, right.expr, options)
+}
+
+// Unless returns "v unless right".
+func (v InstantVector) Unless(right InstantVector, options ...SetOption) InstantVector {
+	return set(promqlbuilder.Unless, v.expr, right.expr, options)
+}
+
+// AddScalar returns "v + right".
+func (v InstantVector) AddScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Add, v.expr, right.expr, nil)
+}
+
+// SubScalar returns "v - right".
+func (v InstantVector) SubScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Sub, v.expr, right.expr, nil)
+}
+
+// MulScalar returns "v * right".
+func (v InstantVector) MulScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Mul, v.expr, right.expr, nil)
+}
+
+// DivScalar returns "v / right".
+func (v InstantVector) DivScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Div, v.expr, right.expr, nil)
+}
+
+// ModScalar returns "v % right".
+func (v InstantVector) ModScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Mod, v.expr, right.expr, nil)
+}
+
+// PowScalar returns "v ^ right".
+func (v InstantVector) PowScalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Pow, v.expr, right.expr, nil)
+}
+
+// Atan2Scalar returns "v atan2 right".
+func (v InstantVector) Atan2Scalar(right Scalar) InstantVector {
+	return withScalar(promqlbuilder.Atan2, v.expr, right.expr, nil)
+}
+
+// EqlScalar returns "v == right".
+func (v InstantVector) EqlScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Eql, v.expr, right.expr, options)
+}
+
+// NeqScalar returns "v != right".
+func (v InstantVector) NeqScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Neq, v.expr, right.expr, options)
+}
+
+// GtrScalar returns "v > right".
+func (v InstantVector) GtrScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Gtr, v.expr, right.expr, options)
+}
+
+// GteScalar returns "v >= right".
+func (v InstantVector) GteScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Gte, v.expr, right.expr, options)
+}
+
+// LssScalar returns "v < right".
+func (v InstantVector) LssScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Lss, v.expr, right.expr, options)
+}
+
+// LteScalar returns "v <= right".
+func (v InstantVector) LteScalar(right Scalar, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Lte, v.expr, right.expr, options)
+}
+
+// Add returns "s + right".
+func (s Scalar) Add(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Add(s.expr, right.expr)}
+}
+
+// Sub returns "s - right".
+func (s Scalar) Sub(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Sub(s.expr, right.expr)}
+}
+
+// Mul returns "s * right".
+func (s Scalar) Mul(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Mul(s.expr, right.expr)}
+}
+
+// Div returns "s / right".
+func (s Scalar) Div(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Div(s.expr, right.expr)}
+}
+
+// Mod returns "s % right".
+func (s Scalar) Mod(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Mod(s.expr, right.expr)}
+}
+
+// Pow returns "s ^ right".
+func (s Scalar) Pow(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Pow(s.expr, right.expr)}
+}
+
+// Atan2 returns "s atan2 right".
+func (s Scalar) Atan2(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Atan2(s.expr, right.expr)}
+}
+
+// Eql returns "s == bool right", the bool modifier being required between two scalars.
+func (s Scalar) Eql(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Eql(s.expr, right.expr).Bool()}
+}
+
+// Neq returns "s != bool right", the bool modifier being required between two scalars.
+func (s Scalar) Neq(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Neq(s.expr, right.expr).Bool()}
+}
+
+// Gtr returns "s > bool right", the bool modifier being required between two scalars.
+func (s Scalar) Gtr(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Gtr(s.expr, right.expr).Bool()}
+}
+
+// Gte returns "s >= bool right", the bool modifier being required between two scalars.
+func (s Scalar) Gte(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Gte(s.expr, right.expr).Bool()}
+}
+
+// Lss returns "s < bool right", the bool modifier being required between two scalars.
+func (s Scalar) Lss(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Lss(s.expr, right.expr).Bool()}
+}
+
+// Lte returns "s <= bool right", the bool modifier being required between two scalars.
+func (s Scalar) Lte(right Scalar) Scalar {
+	return Scalar{expr: promqlbuilder.Lte(s.expr, right.expr).Bool()}
+}
+
+// AddVector returns "s + right", an instant vector.
+func (s Scalar) AddVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Add, s.expr, right.expr, nil)
+}
+
+// SubVector returns "s - right", an instant vector.
+func (s Scalar) SubVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Sub, s.expr, right.expr, nil)
+}
+
+// MulVector returns "s * right", an instant vector.
+func (s Scalar) MulVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Mul, s.expr, right.expr, nil)
+}
+
+// DivVector returns "s / right", an instant vector.
+func (s Scalar) DivVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Div, s.expr, right.expr, nil)
+}
+
+// ModVector returns "s % right", an instant vector.
+func (s Scalar) ModVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Mod, s.expr, right.expr, nil)
+}
+
+// PowVector returns "s ^ right", an instant vector.
+func (s Scalar) PowVector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Pow, s.expr, right.expr, nil)
+}
+
+// Atan2Vector returns "s atan2 right", an instant vector.
+func (s Scalar) Atan2Vector(right InstantVector) InstantVector {
+	return withScalar(promqlbuilder.Atan2, s.expr, right.expr, nil)
+}
+
+// EqlVector returns "s == right", an instant vector.
+func (s Scalar) EqlVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Eql, s.expr, right.expr, options)
+}
+
+// NeqVector returns "s != right", an instant vector.
+func (s Scalar) NeqVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Neq, s.expr, right.expr, options)
+}
+
+// GtrVector returns "s > right", an instant vector.
+func (s Scalar) GtrVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Gtr, s.expr, right.expr, options)
+}
+
+// GteVector returns "s >= right", an instant vector.
+func (s Scalar) GteVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Gte, s.expr, right.expr, options)
+}
+
+// LssVector returns "s < right", an instant vector.
+func (s Scalar) LssVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Lss, s.expr, right.expr, options)
+}
+
+// LteVector returns "s <= right", an instant vector.
+func (s Scalar) LteVector(right InstantVector, options ...BoolModifier) InstantVector {
+	return withScalar(promqlbuilder.Lte, s.expr, right.expr, options)
+}
@@ -0,0 +1,385 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// rangeFunction calls a function taking a range vector. The untyped helpers only accept the range vector builders,
+// while a RangeVector can hold any range vector expression.
+func rangeFunction(name string, input RangeVector, args ...parser.Expr) InstantVector {
+	return InstantVector{expr: promqlbuilder.NewFunction(name, append([]parser.Expr{input.expr}, args...)...)}
+}
+
+func Abs(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Abs(vector.expr)}
+}
+
+func Absent(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Absent(vector.expr)}
+}
+
+func Acos(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Acos(vector.expr)}
+}
+
+func Acosh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Acosh(vector.expr)}
+}
+
+func Asin(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Asin(vector.expr)}
+}
+
+func Asinh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Asinh(vector.expr)}
+}
+
+func Atan(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Atan(vector.expr)}
+}
+
+func Atanh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Atanh(vector.expr)}
+}
+
+func Ceil(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Ceil(vector.expr)}
+}
+
+func Cos(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Cos(vector.expr)}
+}
+
+func Cosh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Cosh(vector.expr)}
+}
+
+func DayOfMonth(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.DayOfMonth(vector.expr)}
+}
+
+func DayOfWeek(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.DayOfWeek(vector.expr)}
+}
+
+func DayOfYear(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.DayOfYear(vector.expr)}
+}
+
+func DaysInMonth(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.DaysInMonth(vector.expr)}
+}
+
+func Deg(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Deg(vector.expr)}
+}
+
+func Exp(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Exp(vector.expr)}
+}
+
+func Floor(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Floor(vector.expr)}
+}
+
+func HistogramAvg(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramAvg(vector.expr)}
+}
+
+func HistogramCount(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramCount(vector.expr)}
+}
+
+func HistogramStddev(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramStddev(vector.expr)}
+}
+
+func HistogramStdvar(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramStdvar(vector.expr)}
+}
+
+func HistogramSum(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramSum(vector.expr)}
+}
+
+func Hour(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Hour(vector.expr)}
+}
+
+func Ln(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Ln(vector.expr)}
+}
+
+func Log10(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Log10(vector.expr)}
+}
+
+func Log2(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Log2(vector.expr)}
+}
+
+func Minute(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Minute(vector.expr)}
+}
+
+func Month(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Month(vector.expr)}
+}
+
+func Rad(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Rad(vector.expr)}
+}
+
+func Sgn(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Sgn(vector.expr)}
+}
+
+func Sin(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Sin(vector.expr)}
+}
+
+func Sinh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Sinh(vector.expr)}
+}
+
+func Sort(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Sort(vector.expr)}
+}
+
+func SortDesc(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.SortDesc(vector.expr)}
+}
+
+func Sqrt(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Sqrt(vector.expr)}
+}
+
+func Tan(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Tan(vector.expr)}
+}
+
+func Tanh(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Tanh(vector.expr)}
+}
+
+func Timestamp(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Timestamp(vector.expr)}
+}
+
+func Year(vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Year(vector.expr)}
+}
+
+func AbsentOverTime(input RangeVector) InstantVector {
+	return rangeFunction("absent_over_time", input)
+}
+
+func AvgOverTime(input RangeVector) InstantVector {
+	return rangeFunction("avg_over_time", input)
+}
+
+func Changes(input RangeVector) InstantVector {
+	return rangeFunction("changes", input)
+}
+
+func CountOverTime(input RangeVector) InstantVector {
+	return rangeFunction("count_over_time", input)
+}
+
+func Delta(input RangeVector) InstantVector {
+	return rangeFunction("delta", input)
+}
+
+func Deriv(input RangeVector) InstantVector {
+	return rangeFunction("deriv", input)
+}
+
+func FirstOverTime(input RangeVector) InstantVector {
+	return rangeFunction("first_over_time", input)
+}
+
+func IDelta(input RangeVector) InstantVector {
+	return rangeFunction("idelta", input)
+}
+
+func Increase(input RangeVector) InstantVector {
+	return rangeFunction("increase", input)
+}
+
+func IRate(input RangeVector) InstantVector {
+	return rangeFunction("irate", input)
+}
+
+func LastOverTime(input RangeVector) InstantVector {
+	return rangeFunction("last_over_time", input)
+}
+
+func MadOverTime(input RangeVector) InstantVector {
+	return rangeFunction("mad_over_time", input)
+}
+
+func MaxOverTime(input RangeVector) InstantVector {
+	return rangeFunction("max_over_time", input)
+}
+
+func MinOverTime(input RangeVector) InstantVector {
+	return rangeFunction("min_over_time", input)
+}
+
+func PresentOverTime(input RangeVector) InstantVector {
+	return rangeFunction("present_over_time", input)
+}
+
+func Rate(input RangeVector) InstantVector {
+	return rangeFunction("rate", input)
+}
+
+func Resets(input RangeVector) InstantVector {
+	return rangeFunction("resets", input)
+}
+
+func StddevOverTime(input RangeVector) InstantVector {
+	return rangeFunction("stddev_over_time", input)
+}
+
+func StdvarOverTime(input RangeVector) InstantVector {
+	return rangeFunction("stdvar_over_time", input)
+}
+
+func SumOverTime(input RangeVector) InstantVector {
+	return rangeFunction("sum_over_time", input)
+}
+
+func TsOfFirstOverTime(input RangeVector) InstantVector {
+	return rangeFunction("ts_of_first_over_time", input)
+}
+
+func TsOfLastOverTime(input RangeVector) InstantVector {
+	return rangeFunction("ts_of_last_over_time", input)
+}
+
+func TsOfMaxOverTime(input RangeVector) InstantVector {
+	return rangeFunction("ts_of_max_over_time", input)
+}
+
+func TsOfMinOverTime(input RangeVector) InstantVector {
+	return rangeFunction("ts_of_min_over_time", input)
+}
+
+func Clamp(vector InstantVector, min float64, max float64) InstantVector {
+	return InstantVector{expr: promqlbuilder.Clamp(vector.expr, min, max)}
+}
+
+func ClampMax(vector InstantVector, max float64) InstantVector {
+	return InstantVector{expr: promqlbuilder.ClampMax(vector.expr, max)}
+}
+
+func ClampMin(vector InstantVector, min float64) InstantVector {
+	return InstantVector{expr: promqlbuilder.ClampMin(vector.expr, min)}
+}
+
+func Round(vector InstantVector, t float64) InstantVector {
+	return InstantVector{expr: promqlbuilder.Round(vector.expr, t)}
+}
+
+func HistogramFraction(lower float64, upper float64, vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramFraction(lower, upper, vector.expr)}
+}
+
+func HistogramQuantile(quantile float64, vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramQuantile(quantile, vector.expr)}
+}
+
+// HistogramQuantileAsVariable is like HistogramQuantile but the quantile is a dashboard variable like "$quantile".
+func HistogramQuantileAsVariable(quantile string, vector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramQuantileAsVariable(quantile, vector.expr)}
+}
+
+func HistogramQuantiles(vector InstantVector, labelName string, quantiles ...float64) InstantVector {
+	return InstantVector{expr: promqlbuilder.HistogramQuantiles(vector.expr, labelName, quantiles...)}
+}
+
+func Info(vector InstantVector, dataLabelSelector InstantVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.Info(vector.expr, dataLabelSelector.expr)}
+}
+
+func LabelReplace(vector InstantVector, destinationLabel string, replacement string, sourceLabel string, regexp string) InstantVector {
+	return InstantVector{expr: promqlbuilder.LabelReplace(vector.expr, destinationLabel, replacement, sourceLabel, regexp)}
+}
+
+func LabelJoin(vector InstantVector, destinationLabel string, replacement string, srcLabels ...string) InstantVector {
+	return InstantVector{expr: promqlbuilder.LabelJoin(vector.expr, destinationLabel, replacement, srcLabels...)}
+}
+
+func SortByLabel(vector InstantVector, labels ...string) InstantVector {
+	return InstantVector{expr: promqlbuilder.SortByLabel(vector.expr, labels...)}
+}
+
+func SortByLabelDesc(vector InstantVector, labels ...string) InstantVector {
+	return InstantVector{expr: promqlbuilder.SortByLabelDesc(vector.expr, labels...)}
+}
+
+func DoubleExponentialSmoothing(input RangeVector, smoothingFactor float64, trendFactor float64) InstantVector {
+	return rangeFunction("double_exponential_smoothing", input, promqlbuilder.NewNumber(smoothingFactor), promqlbuilder.NewNumber(trendFactor))
+}
+
+func PredictLinear(input RangeVector, t float64) InstantVector {
+	return rangeFunction("predict_linear", input, promqlbuilder.NewNumber(t))
+}
+
+func QuantileOverTime(t float64, input RangeVector) InstantVector {
+	return InstantVector{expr: promqlbuilder.NewFunction("quantile_over_time", promqlbuilder.NewNumber(t), input.expr)}
+}
+
+// ScalarOf is the function scalar, named so as not to clash with the type Scalar. It returns the value of the single
+// series of the vector, or NaN when there is not exactly one series.
+func ScalarOf(vector InstantVector) Scalar {
+	return Scalar{expr: promqlbuilder.Scalar(vector.expr)}
+}
+
+// Vector returns the scalar as a vector with a single series without labels.
+func Vector(scalar Scalar) InstantVector {
+	return InstantVector{expr: promqlbuilder.NewFunction("vector", scalar.expr)}
+}
+
+func PI() Scalar {
+	return Scalar{expr: promqlbuilder.PI()}
+}
+
+func Time() Scalar {
+	return Scalar{expr: promqlbuilder.Time()}
+}
+
+// Start returns the start time of the range query, or the evaluation time of an instant query.
+func Start() Scalar {
+	return Scalar{expr: promqlbuilder.Start()}
+}
+
+// End returns the end time of the range query, or the evaluation time of an instant query.
+func End() Scalar {
+	return Scalar{expr: promqlbuilder.End()}
+}
+
+// Range returns the duration of the range query in seconds, or 0 for an instant query.
+func Range() Scalar {
+	return Scalar{expr: promqlbuilder.Range()}
+}
+
+// Step returns the step of the range query in seconds, or 0 for an instant query.
+func Step() Scalar {
+	return Scalar{expr: promqlbuilder.Step()}
+}
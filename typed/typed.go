@@ -0,0 +1,182 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package typed wraps the expressions in handles carrying their PromQL value type, so that the Go compiler rejects
+// an argument of the wrong type, like a range vector given to abs or a string given to round.
+//
+// The functions and aggregations have the same names as in promqlbuilder, except ScalarOf for the function scalar.
+// The binary operators are methods, as their result type depends on the type of the operands: an operation between
+// two scalars is a scalar, any other one is an instant vector. The methods of Scalar with the suffix Vector, like
+// SubVector, take an instant vector as right operand, and the methods of InstantVector with the suffix Scalar, like
+// GtrScalar, take a scalar. The vector matching options, like On, are only accepted between two instant vectors, and
+// Bool only by the comparisons.
+//
+//	requests := vector.New(vector.WithMetricName("http_requests_total"))
+//	rate := typed.Rate(typed.Matrix(matrix.New(requests, matrix.WithRangeAsString("5m"))))
+//	typed.Sum(rate, typed.By("job")).GtrScalar(typed.NewNumber(10))
+//
+// The untyped expression is given by Expr, and an untyped expression is wrapped with As after checking its type.
+package typed
+
+import (
+	"fmt"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/variable"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// InstantVector is an expression giving a set of series with a single sample each.
+type InstantVector struct {
+	expr parser.Expr
+}
+
+// Expr returns the untyped expression.
+func (v InstantVector) Expr() parser.Expr {
+	return v.expr
+}
+
+func (v InstantVector) String() string {
+	return v.expr.String()
+}
+
+// RangeVector is an expression giving a set of series with the samples of a time range each.
+type RangeVector struct {
+	expr parser.Expr
+}
+
+// Expr returns the untyped expression.
+func (v RangeVector) Expr() parser.Expr {
+	return v.expr
+}
+
+func (v RangeVector) String() string {
+	return v.expr.String()
+}
+
+// Scalar is an expression giving a single number.
+type Scalar struct {
+	expr parser.Expr
+}
+
+// Expr returns the untyped expression.
+func (s Scalar) Expr() parser.Expr {
+	return s.expr
+}
+
+func (s Scalar) String() string {
+	return s.expr.String()
+}
+
+// String is an expression giving a string, only a string literal in practice.
+type String struct {
+	expr parser.Expr
+}
+
+// Expr returns the untyped expression.
+func (s String) Expr() parser.Expr {
+	return s.expr
+}
+
+func (s String) String() string {
+	return s.expr.String()
+}
+
+// Value is any of the typed expressions.
+type Value interface {
+	InstantVector | RangeVector | Scalar | String
+	Expr() parser.Expr
+}
+
+// As wraps an untyped expression in the typed handle T, after checking that the expression has the value type of T.
+func As[T Value](expr parser.Expr) (T, error) {
+	var result T
+	if expected := valueType(result); expr.Type() != expected {
+		return result, fmt.Errorf("the expression %s is of type %s, not %s", expr, parser.DocumentedType(expr.Type()), parser.DocumentedType(expected))
+	}
+	switch r := any(&result).(type) {
+	case *InstantVector:
+		r.expr = expr
+	case *RangeVector:
+		r.expr = expr
+	case *Scalar:
+		r.expr = expr
+	case *String:
+		r.expr = expr
+	}
+	return result, nil
+}
+
+// MustAs is like As but panics if the expression does not have the value type of T.
+func MustAs[T Value](expr parser.Expr) T {
+	result, err := As[T](expr)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func valueType[T Value](value T) parser.ValueType {
+	switch any(value).(type) {
+	case InstantVector:
+		return parser.ValueTypeVector
+	case RangeVector:
+		return parser.ValueTypeMatrix
+	case Scalar:
+		return parser.ValueTypeScalar
+	default:
+		return parser.ValueTypeString
+	}
+}
+
+// Exprs returns the untyped expressions of the given typed ones.
+func Exprs[T Value](values ...T) []parser.Expr {
+	result := make([]parser.Expr, len(values))
+	for i, v := range values {
+		result[i] = v.Expr()
+	}
+	return result
+}
+
+// Selector returns the instant vector of a vector selector built with vector.New.
+func Selector(v *parser.VectorSelector) InstantVector {
+	return InstantVector{expr: v}
+}
+
+// Matrix returns the range vector of a range vector builder, like matrix.New or a subquery.
+func Matrix[T promqlbuilder.RangeVectorBuilder](input T) RangeVector {
+	return RangeVector{expr: parser.Expr(input)}
+}
+
+// NewNumber returns a number literal.
+func NewNumber(num float64) Scalar {
+	return Scalar{expr: promqlbuilder.NewNumber(num)}
+}
+
+// Variable returns a dashboard variable used in place of a number, like "$k", see variable.New.
+func Variable(reference string) Scalar {
+	return Scalar{expr: variable.New(reference)}
+}
+
+// NewString returns a string literal.
+func NewString(s string) String {
+	return String{expr: promqlbuilder.NewString(s)}
+}
+
+// Parenthesis wraps the expression in parentheses.
+func Parenthesis[T interface {
+	InstantVector | Scalar
+	Expr() parser.Expr
+}](value T) T {
+	return MustAs[T](promqlbuilder.Parenthesis(value.Expr()))
+}
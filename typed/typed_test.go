@@ -0,0 +1,126 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"testing"
+
+	promqlbuilder "github.com/perses/promql-builder"
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedExpressions(t *testing.T) {
+	requestsSelector := vector.New(vector.WithMetricName("http_requests_total"))
+	errorsSelector := vector.New(
+		vector.WithMetricName("http_requests_total"),
+		vector.WithLabelMatchers(label.New("code").EqualRegexp("5..")),
+	)
+	requests, errors := Selector(requestsSelector), Selector(errorsSelector)
+	rate := func(v *parser.VectorSelector) InstantVector {
+		return Rate(Matrix(matrix.New(v, matrix.WithRangeAsString("5m"))))
+	}
+	testSuite := []struct {
+		name     string
+		expr     interface{ String() string }
+		expected string
+	}{
+		{
+			name:     "range vector function",
+			expr:     Sum(rate(requestsSelector), By("job")),
+			expected: `sum by (job) (rate(http_requests_total[5m]))`,
+		},
+		{
+			name:     "vector arithmetic with vector matching",
+			expr:     Sum(rate(errorsSelector), By("job")).Div(Sum(rate(requestsSelector), By("job")), On("job")),
+			expected: `sum by (job) (rate(http_requests_total{code=~"5.."}[5m])) / on (job) sum by (job) (rate(http_requests_total[5m]))`,
+		},
+		{
+			name:     "vector and scalar",
+			expr:     TopK(rate(requestsSelector), NewNumber(5)).GtrScalar(NewNumber(10), Bool()),
+			expected: `topk(5, rate(http_requests_total[5m])) > bool 10`,
+		},
+		{
+			name:     "comparison between vectors",
+			expr:     requests.Gtr(errors, Bool(), On("job")),
+			expected: `http_requests_total > bool on (job) http_requests_total{code=~"5.."}`,
+		},
+		{
+			name:     "aggregation parameter as variable",
+			expr:     Quantile(requests, Variable("$quantile"), By("job")).MulScalar(NewNumber(100)),
+			expected: `quantile by (job) ($quantile, http_requests_total) * 100`,
+		},
+		{
+			name:     "scalar and vector",
+			expr:     NewNumber(1).SubVector(Sum(rate(errorsSelector)).Div(Sum(rate(requestsSelector)))),
+			expected: `1 - sum(rate(http_requests_total{code=~"5.."}[5m])) / sum(rate(http_requests_total[5m]))`,
+		},
+		{
+			name:     "scalar arithmetic and comparison",
+			expr:     Time().Sub(NewNumber(3600)).Gtr(ScalarOf(requests)),
+			expected: `time() - 3600 > bool scalar(http_requests_total)`,
+		},
+		{
+			name:     "group left",
+			expr:     requests.Mul(Selector(vector.New(vector.WithMetricName("build_info"))), Ignoring("version"), GroupLeft("version")),
+			expected: `http_requests_total * ignoring (version) group_left (version) build_info`,
+		},
+		{
+			name:     "instant vector function",
+			expr:     Round(Abs(Vector(Time())), 0.1),
+			expected: `round(abs(vector(time())), 0.1)`,
+		},
+		{
+			name:     "range vector functions with arguments",
+			expr:     PredictLinear(Matrix(matrix.New(requestsSelector, matrix.WithRangeAsString("1h"))), 3600),
+			expected: `predict_linear(http_requests_total[1h], 3600)`,
+		},
+		{
+			name:     "set operator",
+			expr:     requests.Unless(errors, On("job")),
+			expected: `http_requests_total unless on (job) http_requests_total{code=~"5.."}`,
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+			if v, ok := test.expr.(interface{ Expr() parser.Expr }); ok {
+				assert.NoError(t, promqlbuilder.Validate(v.Expr()))
+			}
+		})
+	}
+}
+
+func TestAs(t *testing.T) {
+	v, err := As[InstantVector](promqlbuilder.MustParse("sum(foo)"))
+	require.NoError(t, err)
+	assert.Equal(t, "abs(sum(foo))", Abs(v).String())
+
+	r, err := As[RangeVector](promqlbuilder.MustParse("foo[5m]"))
+	require.NoError(t, err)
+	assert.Equal(t, "rate(foo[5m])", Rate(r).String())
+
+	_, err = As[InstantVector](promqlbuilder.MustParse("foo[5m]"))
+	assert.EqualError(t, err, "the expression foo[5m] is of type range vector, not instant vector")
+
+	_, err = As[Scalar](promqlbuilder.MustParse(`"foo"`))
+	assert.EqualError(t, err, `the expression "foo" is of type string, not scalar`)
+
+	assert.Equal(t, "(1 + 2)", Parenthesis(NewNumber(1).Add(NewNumber(2))).String())
+	assert.Panics(t, func() { MustAs[Scalar](promqlbuilder.MustParse("foo")) })
+}
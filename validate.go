@@ -0,0 +1,396 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ValidationError describes a problem found on a node of an expression.
+type ValidationError struct {
+	// Path is the location of the offending node in the expression, like "$.expr.args[0]".
+	Path    string
+	Node    parser.Node
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is the list of problems returned by Validate.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate statically checks an expression, built or parsed, and reports every problem that would make
+// Prometheus reject the query or return a meaningless result:
+//   - type mismatches between an expression and where it is used,
+//   - wrong number of arguments in a function call,
+//   - parameters out of range like a quantile greater than 1,
+//   - invalid regular expressions in label matchers,
+//   - vector selectors without any non-empty matcher.
+//
+// When the expression is not valid, the returned error is a ValidationErrors.
+func Validate(expr parser.Expr) error {
+	v := &validator{}
+	v.validate(expr, rootPath)
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// CheckedString validates the expression and returns its string representation.
+func CheckedString(expr parser.Expr) (string, error) {
+	if err := Validate(expr); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(path string, node parser.Node, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		Path:    path,
+		Node:    node,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(node parser.Node, path string) {
+	if node == nil {
+		v.errorf(path, nil, "missing expression")
+		return
+	}
+	switch n := node.(type) {
+	case *parser.AggregateExpr:
+		v.validateAggregation(n, node, path)
+	case *AggregationBuilder:
+		v.validateAggregation(n.internal, node, path)
+	case *parser.BinaryExpr:
+		v.validateBinary(n, node, path)
+	case *BinaryBuilder:
+		v.validateBinary(n.internal, node, path)
+	case *BinaryWithVectorMatching:
+		v.validateBinary(n.binaryOpt.internal, node, path)
+	case *parser.Call:
+		v.validateCall(n, path)
+	case *parser.MatrixSelector:
+		v.validateMatrix(n, node, path, "")
+	case *matrix.Builder:
+		v.validateMatrix(n.InternalMatrix, node, path, n.RangeAsVariable)
+	case *parser.SubqueryExpr:
+		v.validateSubquery(n, node, path, "")
+	case *subquery.VariableBuilder:
+		v.validateSubquery(n.InternalSubquery, node, path, n.RangeAsVariable)
+	case *parser.UnaryExpr:
+		if n.Op != parser.ADD && n.Op != parser.SUB {
+			v.errorf(path, n, "only + and - operators allowed for unary expressions")
+		}
+		if t := typeOf(n.Expr); isKnownType(t) && t != parser.ValueTypeScalar && t != parser.ValueTypeVector {
+			v.errorf(path, n, "unary expression only allowed on expressions of type scalar or instant vector, got %s", parser.DocumentedType(t))
+		}
+	case *parser.VectorSelector:
+		v.validateVectorSelector(n, path)
+	case *variable.Expr:
+		if !variable.IsReference(n.Reference) {
+			v.errorf(path, n, "%q is not a valid variable reference", n.Reference)
+		}
+	case *vector.VariableBuilder:
+		if n.InternalVector == nil {
+			v.errorf(path, n, "missing vector selector")
+			return
+		}
+	case *parser.ParenExpr, *parser.StepInvariantExpr, *parser.NumberLiteral, *parser.StringLiteral:
+		// nothing to check on the node itself
+	default:
+		v.errorf(path, node, "unknown node type %T", node)
+		return
+	}
+	for i, child := range Children(node) {
+		v.validate(child, childPath(path, node, i))
+	}
+}
+
+func (v *validator) validateAggregation(n *parser.AggregateExpr, node parser.Node, path string) {
+	if !n.Op.IsAggregator() {
+		v.errorf(path, node, "aggregation operator expected in aggregation expression but got %q", n.Op)
+		return
+	}
+	if n.Expr == nil {
+		v.errorf(path, node, "missing expression in aggregation %q", n.Op)
+	} else {
+		v.expectType(n.Expr, parser.ValueTypeVector, "aggregation expression", path+".expr")
+	}
+	if !n.Op.IsAggregatorWithParam() {
+		return
+	}
+	paramPath := path + ".param"
+	if n.Param == nil {
+		v.errorf(path, node, "missing parameter in aggregation %q", n.Op)
+		return
+	}
+	if n.Op == parser.COUNT_VALUES {
+		v.expectType(n.Param, parser.ValueTypeString, "aggregation parameter", paramPath)
+		return
+	}
+	v.expectType(n.Param, parser.ValueTypeScalar, "aggregation parameter", paramPath)
+	switch n.Op {
+	case parser.QUANTILE:
+		v.expectNumberBetween(n.Param, 0, 1, "quantile", paramPath)
+	case parser.LIMIT_RATIO:
+		v.expectNumberBetween(n.Param, -1, 1, "limit_ratio", paramPath)
+	}
+}
+
+func (v *validator) validateBinary(n *parser.BinaryExpr, node parser.Node, path string) {
+	if !n.Op.IsOperator() {
+		v.errorf(path, node, "binary expression does not support operator %q", n.Op)
+		return
+	}
+	if n.ReturnBool && !n.Op.IsComparisonOperator() {
+		v.errorf(path, node, "bool modifier can only be used on comparison operators")
+	}
+	lt, rt := typeOf(n.LHS), typeOf(n.RHS)
+	if isKnownType(lt) && lt != parser.ValueTypeScalar && lt != parser.ValueTypeVector {
+		v.errorf(path+".lhs", n.LHS, "binary expression must contain only scalar and instant vector types, got %s", parser.DocumentedType(lt))
+	}
+	if isKnownType(rt) && rt != parser.ValueTypeScalar && rt != parser.ValueTypeVector {
+		v.errorf(path+".rhs", n.RHS, "binary expression must contain only scalar and instant vector types, got %s", parser.DocumentedType(rt))
+	}
+	if n.Op.IsComparisonOperator() && !n.ReturnBool && lt == parser.ValueTypeScalar && rt == parser.ValueTypeScalar {
+		v.errorf(path, node, "comparisons between scalars must use BOOL modifier")
+	}
+	if n.Op.IsSetOperator() && (lt == parser.ValueTypeScalar || rt == parser.ValueTypeScalar) {
+		v.errorf(path, node, "set operator %q not allowed in binary scalar expression", n.Op)
+	}
+	vm := n.VectorMatching
+	if vm == nil {
+		return
+	}
+	if lt == parser.ValueTypeScalar || rt == parser.ValueTypeScalar {
+		if hasVectorMatchingKeyword(vm) {
+			v.errorf(path, node, "vector matching only allowed between instant vectors")
+		}
+		return
+	}
+	if n.Op.IsSetOperator() {
+		if vm.Card == parser.CardOneToMany || vm.Card == parser.CardManyToOne {
+			v.errorf(path, node, "no grouping allowed for %q operation", n.Op)
+		}
+		if vm.FillValues.LHS != nil || vm.FillValues.RHS != nil {
+			v.errorf(path, node, "filling in missing series not allowed for set operators")
+		}
+	}
+	if vm.On {
+		for _, l1 := range vm.MatchingLabels {
+			for _, l2 := range vm.Include {
+				if l1 == l2 {
+					v.errorf(path, node, "label %q must not occur in ON and GROUP clause at once", l1)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateCall(n *parser.Call, path string) {
+	if n.Func == nil {
+		v.errorf(path, n, "missing function in call")
+		return
+	}
+	if _, ok := parser.Functions[n.Func.Name]; !ok {
+		// Custom functions are not known by Prometheus, so there is nothing to check against.
+		return
+	}
+	nargs := len(n.Func.ArgTypes)
+	if n.Func.Variadic == 0 {
+		if nargs != len(n.Args) {
+			v.errorf(path, n, "expected %d argument(s) in call to %q, got %d", nargs, n.Func.Name, len(n.Args))
+		}
+	} else {
+		na := nargs - 1
+		if na > len(n.Args) {
+			v.errorf(path, n, "expected at least %d argument(s) in call to %q, got %d", na, n.Func.Name, len(n.Args))
+		} else if nargsmax := na + n.Func.Variadic; n.Func.Variadic > 0 && nargsmax < len(n.Args) {
+			v.errorf(path, n, "expected at most %d argument(s) in call to %q, got %d", nargsmax, n.Func.Name, len(n.Args))
+		}
+	}
+	for i, arg := range n.Args {
+		j := i
+		if j >= nargs {
+			if n.Func.Variadic == 0 {
+				break
+			}
+			j = nargs - 1
+		}
+		v.expectType(arg, n.Func.ArgTypes[j], fmt.Sprintf("call to function %q", n.Func.Name), childPath(path, n, i))
+	}
+
+	argPath := func(i int) string { return childPath(path, n, i) }
+	switch n.Func.Name {
+	case "histogram_quantile", "quantile_over_time":
+		if len(n.Args) > 0 {
+			v.expectNumberBetween(n.Args[0], 0, 1, "quantile", argPath(0))
+		}
+	case "histogram_quantiles":
+		for i := 2; i < len(n.Args); i++ {
+			v.expectNumberBetween(n.Args[i], 0, 1, "quantile", argPath(i))
+		}
+	case "histogram_fraction":
+		if len(n.Args) > 1 {
+			lower, lowerOK := numberValue(n.Args[0])
+			upper, upperOK := numberValue(n.Args[1])
+			if lowerOK && upperOK && lower > upper {
+				v.errorf(path, n, "lower bound %g of histogram_fraction is greater than upper bound %g", lower, upper)
+			}
+		}
+	case "double_exponential_smoothing":
+		for i := 1; i < len(n.Args) && i < 3; i++ {
+			if f, ok := numberValue(n.Args[i]); ok && (f <= 0 || f >= 1) {
+				v.errorf(argPath(i), n.Args[i], "smoothing and trend factors must be between 0 and 1 excluded, got %g", f)
+			}
+		}
+	case "info":
+		if len(n.Args) > 1 {
+			if vs, ok := n.Args[1].(*parser.VectorSelector); !ok || vs.Name != "" {
+				v.errorf(argPath(1), n.Args[1], "expected label selectors only")
+			}
+		}
+	}
+}
+
+func (v *validator) validateMatrix(n *parser.MatrixSelector, node parser.Node, path string, rangeAsVariable string) {
+	if n == nil {
+		v.errorf(path, node, "missing range selector")
+		return
+	}
+	if _, ok := n.VectorSelector.(*parser.VectorSelector); !ok {
+		v.errorf(path, node, "range can only be applied on a vector selector, got %T, use a subquery instead", n.VectorSelector)
+	}
+	if len(rangeAsVariable) == 0 && n.Range <= 0 {
+		v.errorf(path, node, "range must be greater than 0")
+	}
+}
+
+func (v *validator) validateSubquery(n *parser.SubqueryExpr, node parser.Node, path string, rangeAsVariable string) {
+	if n == nil {
+		v.errorf(path, node, "missing subquery")
+		return
+	}
+	v.expectType(n.Expr, parser.ValueTypeVector, "subquery", childPath(path, node, 0))
+	if len(rangeAsVariable) == 0 && n.Range <= 0 {
+		v.errorf(path, node, "subquery range must be greater than 0")
+	}
+	if n.Step < 0 {
+		v.errorf(path, node, "subquery step must not be negative")
+	}
+}
+
+func (v *validator) validateVectorSelector(n *parser.VectorSelector, path string) {
+	notEmpty := len(n.Name) > 0 || n.BypassEmptyMatcherCheck
+	for _, m := range n.LabelMatchers {
+		if m == nil {
+			v.errorf(path, n, "nil label matcher")
+			continue
+		}
+		if len(variable.FindAll(m.Value)) > 0 {
+			// The value will only be known once the variables are replaced by the dashboard.
+			notEmpty = true
+			continue
+		}
+		matcher, err := labels.NewMatcher(m.Type, m.Name, m.Value)
+		if err != nil {
+			v.errorf(path, n, "invalid label matcher %s: %s", m, err)
+			continue
+		}
+		if len(n.Name) > 0 && m.Name == labels.MetricName && m.Value != n.Name {
+			v.errorf(path, n, "metric name must not be set twice: %q or %q", n.Name, m.Value)
+		}
+		if !matcher.Matches("") {
+			notEmpty = true
+		}
+	}
+	if !notEmpty {
+		v.errorf(path, n, "vector selector must contain at least one non-empty matcher")
+	}
+}
+
+func (v *validator) expectType(expr parser.Expr, want parser.ValueType, context string, path string) {
+	if expr == nil {
+		return
+	}
+	if t := typeOf(expr); isKnownType(t) && t != want {
+		v.errorf(path, expr, "expected type %s in %s, got %s", parser.DocumentedType(want), context, parser.DocumentedType(t))
+	}
+}
+
+func (v *validator) expectNumberBetween(expr parser.Expr, lower, upper float64, name string, path string) {
+	if f, ok := numberValue(expr); ok && (f < lower || f > upper) {
+		v.errorf(path, expr, "%s must be between %g and %g, got %g", name, lower, upper, f)
+	}
+}
+
+// typeOf returns the type of the expression, recovering from the panic of wrappers that are not fully built.
+func typeOf(expr parser.Expr) (t parser.ValueType) {
+	if expr == nil {
+		return parser.ValueTypeNone
+	}
+	defer func() {
+		if recover() != nil {
+			t = parser.ValueTypeNone
+		}
+	}()
+	return expr.Type()
+}
+
+// isKnownType returns false for the types of expressions we cannot reason about, like custom functions.
+func isKnownType(t parser.ValueType) bool {
+	return t != "" && t != parser.ValueTypeNone
+}
+
+// numberValue returns the value of the expression if it is a number literal, possibly in parentheses or negated.
+func numberValue(expr parser.Expr) (float64, bool) {
+	switch e := expr.(type) {
+	case *parser.NumberLiteral:
+		return e.Val, true
+	case *parser.ParenExpr:
+		return numberValue(e.Expr)
+	case *parser.UnaryExpr:
+		f, ok := numberValue(e.Expr)
+		if e.Op == parser.SUB {
+			f = -f
+		}
+		return f, ok
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	foo := func() *parser.VectorSelector { return vector.New(vector.WithMetricName("foo")) }
+	fooRange := func() *matrix.Builder {
+		return matrix.New(foo(), matrix.WithRangeAsVariable("$__rate_interval"))
+	}
+	testSuite := []struct {
+		name     string
+		expr     parser.Expr
+		expected []string
+	}{
+		{
+			name: "valid expression",
+			expr: Sum(Rate(fooRange())).By("namespace"),
+		},
+		{
+			name: "valid parsed expression",
+			expr: MustParse(`histogram_quantile(0.9, sum by (le) (rate(foo_bucket{job=~"api|web"}[5m])))`),
+		},
+		{
+			name:     "range vector in a function expecting an instant vector",
+			expr:     Sum(Abs(fooRange())),
+			expected: []string{`$.expr.args[0]: expected type instant vector in call to function "abs", got range vector`},
+		},
+		{
+			name:     "wrong number of arguments",
+			expr:     NewFunction("clamp", foo()),
+			expected: []string{`$: expected 3 argument(s) in call to "clamp", got 1`},
+		},
+		{
+			name: "quantile out of range",
+			expr: Add(Quantile(foo(), 1.7), HistogramQuantile(-0.1, foo())),
+			expected: []string{
+				"$.lhs.param: quantile must be between 0 and 1, got 1.7",
+				"$.rhs.args[0]: quantile must be between 0 and 1, got -0.1",
+			},
+		},
+		{
+			name:     "limit ratio out of range",
+			expr:     LimitRatio(foo(), 2),
+			expected: []string{"$.param: limit_ratio must be between -1 and 1, got 2"},
+		},
+		{
+			name:     "histogram fraction with inverted bounds",
+			expr:     HistogramFraction(10, 1, foo()),
+			expected: []string{"$: lower bound 10 of histogram_fraction is greater than upper bound 1"},
+		},
+		{
+			name: "invalid regexp",
+			expr: vector.New(
+				vector.WithMetricName("foo"),
+				vector.WithLabelMatchers(label.New("pod").EqualRegexp("prom-(")),
+			),
+			expected: []string{"$: invalid label matcher pod=~\"prom-(\": error parsing regexp: missing closing ): `prom-(`"},
+		},
+		{
+			name: "vector selector matching everything",
+			expr: vector.New(
+				vector.WithLabelMatchers(label.New("pod").EqualRegexp(".*")),
+			),
+			expected: []string{"$: vector selector must contain at least one non-empty matcher"},
+		},
+		{
+			name:     "comparison between scalars without bool",
+			expr:     Gtr(NewNumber(1), NewNumber(2)),
+			expected: []string{"$: comparisons between scalars must use BOOL modifier"},
+		},
+		{
+			name:     "vector matching with a scalar",
+			expr:     Mul(foo(), NewNumber(2)).On("job"),
+			expected: []string{"$: vector matching only allowed between instant vectors"},
+		},
+		{
+			name:     "missing range",
+			expr:     Rate(matrix.New(foo())),
+			expected: []string{"$.args[0]: range must be greater than 0"},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.expr)
+			if len(test.expected) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var errs ValidationErrors
+			require.True(t, errors.As(err, &errs))
+			msgs := make([]string, len(errs))
+			for i, e := range errs {
+				msgs[i] = e.Error()
+			}
+			assert.Equal(t, test.expected, msgs)
+		})
+	}
+}
+
+func TestCheckedString(t *testing.T) {
+	s, err := CheckedString(Rate(matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsString("5m"))))
+	require.NoError(t, err)
+	assert.Equal(t, "rate(foo[5m])", s)
+
+	_, err = CheckedString(TopK(Rate(matrix.New(vector.New(vector.WithMetricName("foo")), matrix.WithRangeAsString("5m"))), 5).By("job"))
+	assert.NoError(t, err)
+
+	_, err = CheckedString(Count(NewString("foo")))
+	assert.EqualError(t, err, "$.expr: expected type instant vector in aggregation expression, got string")
+}
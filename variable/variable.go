@@ -0,0 +1,115 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package variable
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+)
+
+// Pattern is the regular expression matching a reference to a dashboard variable.
+// The following syntaxes are supported: "$namespace", "${namespace}" and "${namespace:format}".
+const Pattern = `\$(?:\{[A-Za-z_]\w*(?::\w+)?\}|[A-Za-z_]\w*)`
+
+var referenceRegexp = regexp.MustCompile(Pattern)
+
+// FindAll returns all variable references contained in the given string, in order of appearance.
+func FindAll(s string) []string {
+	return referenceRegexp.FindAllString(s, -1)
+}
+
+// IsReference returns true if the given string is exactly one variable reference.
+func IsReference(s string) bool {
+	loc := referenceRegexp.FindStringIndex(s)
+	return loc != nil && loc[0] == 0 && loc[1] == len(s)
+}
+
+// Name returns the name of the variable from its reference. For example, "${env:regex}" gives "env".
+func Name(reference string) string {
+	name, _ := split(reference)
+	return name
+}
+
+// Format returns the format requested in the variable reference. For example, "${env:regex}" gives "regex".
+// It is empty when no format is specified.
+func Format(reference string) string {
+	_, format := split(reference)
+	return format
+}
+
+// durationRegexp matches a variable used as a duration, optionally followed by a unit like in "${__range_s}s".
+var durationRegexp = regexp.MustCompile(`^(` + Pattern + `)(ms|[smhdwy])?$`)
+
+// SplitDuration splits a variable used as a duration into the variable reference and the unit written after it.
+// For example, "${__range_s}s" gives "${__range_s}" and "s", while "$__range" gives "$__range" and an empty unit.
+// ok is false when the string is not a variable used as a duration.
+func SplitDuration(s string) (reference string, unit string, ok bool) {
+	m := durationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+func split(reference string) (string, string) {
+	s := strings.TrimPrefix(reference, "$")
+	if !strings.HasPrefix(s, "{") {
+		return s, ""
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	name, format, _ := strings.Cut(s, ":")
+	return name, format
+}
+
+// Expr is a dashboard variable used in place of a number, like "$k" in "topk($k, foo)".
+// It is rendered as the raw variable reference.
+type Expr struct {
+	// Reference is the variable as written in the query, like "$k" or "${k}".
+	Reference string
+}
+
+// New returns a variable that can be used anywhere a number is expected.
+// It panics if the reference is not a valid variable reference.
+func New(reference string) *Expr {
+	if !IsReference(reference) {
+		panic(fmt.Errorf("%q is not a valid variable reference", reference))
+	}
+	return &Expr{Reference: reference}
+}
+
+// Type returns the type the expression evaluates to.
+// A variable always replaces a number, so it is a scalar.
+func (e *Expr) Type() parser.ValueType {
+	return parser.ValueTypeScalar
+}
+
+// PromQLExpr ensures that no other types accidentally implement the interface.
+func (e *Expr) PromQLExpr() {}
+
+// String returns the raw variable reference.
+func (e *Expr) String() string {
+	return e.Reference
+}
+
+func (e *Expr) Pretty(level int) string {
+	return strings.Repeat("  ", level) + e.String()
+}
+
+func (e *Expr) PositionRange() posrange.PositionRange {
+	return posrange.PositionRange{}
+}
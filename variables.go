@@ -0,0 +1,64 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"sort"
+
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/variable"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// Variables returns the name of every dashboard variable referenced by the expression, sorted and without duplicates.
+// Variables are searched in ranges, steps and offsets, in parameters and in label matchers and string literals.
+// For example, "sum(rate(foo{namespace=~"${namespace:regex}"}[$__rate_interval]))" gives
+// ["__rate_interval", "namespace"].
+func Variables(expr parser.Expr) []string {
+	found := map[string]struct{}{}
+	add := func(references ...string) {
+		for _, ref := range references {
+			if len(ref) > 0 {
+				found[variable.Name(ref)] = struct{}{}
+			}
+		}
+	}
+	Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *matrix.Builder:
+			add(n.RangeAsVariable, n.OffsetAsVariable)
+		case *vector.VariableBuilder:
+			add(n.OffsetAsVariable)
+		case *subquery.VariableBuilder:
+			add(n.RangeAsVariable, n.StepAsVariable, n.OffsetAsVariable)
+		case *variable.Expr:
+			add(n.Reference)
+		case *parser.VectorSelector:
+			for _, m := range n.LabelMatchers {
+				add(variable.FindAll(m.Value)...)
+			}
+		case *parser.StringLiteral:
+			add(variable.FindAll(n.Val)...)
+		}
+		return nil
+	})
+	result := make([]string, 0, len(found))
+	for name := range found {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
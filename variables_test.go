@@ -0,0 +1,121 @@
+// Copyright The Perses Authors
+// Licensed under the Apache License, Version 2.0 (the \"License\");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an \"AS IS\" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promqlbuilder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
+	"github.com/perses/promql-builder/subquery"
+	"github.com/perses/promql-builder/vector"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariableNodes(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		expected string
+		expr     parser.Expr
+	}{
+		{
+			name:     "vector with variable offset",
+			expected: `foo{namespace="$namespace"} offset $offset`,
+			expr: vector.NewWithVariables(
+				vector.New(
+					vector.WithMetricName("foo"),
+					vector.WithLabelMatchers(label.New("namespace").Equal("$namespace")),
+				),
+				vector.WithOffsetAsVariable("$offset"),
+			),
+		},
+		{
+			name:     "range vector with variable range and offset",
+			expected: "rate(foo[$__rate_interval] offset $offset)",
+			expr: Rate(matrix.New(
+				vector.New(vector.WithMetricName("foo")),
+				matrix.WithRangeAsVariable("$__rate_interval"),
+				matrix.WithOffsetAsVariable("$offset"),
+			)),
+		},
+		{
+			name:     "subquery with variable range and step",
+			expected: "max_over_time(sum(foo)[$__range:$__interval])",
+			expr: MaxOverTime(subquery.NewWithVariables(
+				subquery.New(subquery.WithExpr(Sum(vector.New(vector.WithMetricName("foo"))))),
+				subquery.WithRangeAndStepAsVariable("$__range", "$__interval"),
+			)),
+		},
+		{
+			name:     "subquery with variable step only",
+			expected: "sum(foo)[1h:$__interval] offset 5m",
+			expr: subquery.NewWithVariables(
+				subquery.New(
+					subquery.WithExpr(Sum(vector.New(vector.WithMetricName("foo")))),
+					subquery.WithRange(time.Hour),
+					subquery.WithOffset(5*time.Minute),
+				),
+				subquery.WithStepAsVariable("$__interval"),
+			),
+		},
+		{
+			name:     "topk with variable",
+			expected: "topk($k, foo)",
+			expr:     TopKAsVariable(vector.New(vector.WithMetricName("foo")), "$k"),
+		},
+		{
+			name:     "histogram quantile with variable",
+			expected: "histogram_quantile(${quantile}, foo)",
+			expr:     HistogramQuantileAsVariable("${quantile}", vector.New(vector.WithMetricName("foo"))),
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.expr.String())
+			assert.Equal(t, test.expected, DeepCopyExpr(test.expr).String())
+			assert.NoError(t, Validate(test.expr))
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	testSuite := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "no variable",
+			query:    "sum(rate(foo[5m]))",
+			expected: []string{},
+		},
+		{
+			name:     "variables everywhere",
+			query:    `topk($k, sum by (pod) (rate(foo{namespace=~"${namespace:regex}",job="$job"}[$__rate_interval] offset $offset)))`,
+			expected: []string{"__rate_interval", "job", "k", "namespace", "offset"},
+		},
+		{
+			name:     "subquery and string literal",
+			query:    `label_replace(max_over_time(rate(foo[5m])[$__range:$__interval]), "dst", "$1-$suffix", "src", "(.*)")`,
+			expected: []string{"__interval", "__range", "suffix"},
+		},
+	}
+	for _, test := range testSuite {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Variables(MustParse(test.query)))
+		})
+	}
+}
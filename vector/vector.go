@@ -14,11 +14,14 @@
 package vector
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/perses/promql-builder/duration"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
 )
 
 type Option func(vector *Builder)
@@ -75,3 +78,59 @@ func WithAtSpecificTimeStamp(timestamp int64) Option {
 		vector.Timestamp = &timestamp
 	}
 }
+
+// VariableBuilder wraps a vector selector that uses dashboard variables,
+// like the offset in "foo offset $offset".
+type VariableBuilder struct {
+	InternalVector   *parser.VectorSelector
+	OffsetAsVariable string
+}
+
+type VariableOption func(vector *VariableBuilder)
+
+// NewWithVariables wraps the given vector selector so it can use dashboard variables.
+func NewWithVariables(v *parser.VectorSelector, options ...VariableOption) *VariableBuilder {
+	b := &VariableBuilder{
+		InternalVector: v,
+	}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// WithOffsetAsVariable sets the offset as a variable name like "$offset".
+func WithOffsetAsVariable(name string) VariableOption {
+	return func(vector *VariableBuilder) {
+		vector.OffsetAsVariable = name
+	}
+}
+
+// Type returns the type the expression evaluates to.
+func (b *VariableBuilder) Type() parser.ValueType {
+	return b.InternalVector.Type()
+}
+
+// PromQLExpr ensures that no other types accidentally implement the interface.
+func (b *VariableBuilder) PromQLExpr() {
+	b.InternalVector.PromQLExpr()
+}
+
+// String representation of the node. The variables are rendered as is.
+func (b *VariableBuilder) String() string {
+	if len(b.OffsetAsVariable) == 0 {
+		return b.InternalVector.String()
+	}
+	// Copy the Vector selector before changing the offset
+	vecSelector := *b.InternalVector
+	vecSelector.OriginalOffset = 0
+	return fmt.Sprintf("%s offset %s", vecSelector.String(), b.OffsetAsVariable)
+}
+
+func (b *VariableBuilder) Pretty(level int) string {
+	return fmt.Sprintf("%s%s", strings.Repeat("  ", level), b.String())
+}
+
+func (b *VariableBuilder) PositionRange() posrange.PositionRange {
+	return b.InternalVector.PositionRange()
+}